@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"glimmer/token"
 	"os"
 	"os/exec"
 	"time"
@@ -12,6 +13,7 @@ import (
 
 type Node interface {
 	TokenLiteral() string
+	Pos() token.Token // the token locating the node in the source, used in error messages
 	String() string
 }
 
@@ -37,6 +39,14 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Token {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	} else {
+		return token.Token{}
+	}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -47,7 +57,10 @@ func (p *Program) String() string {
 	return out.String()
 }
 
-func (p *Program) ToDot() string {
+// ToDot writes a graph of the program's AST to a dotfile under dot-outputs
+// in the working directory, rendering it to a png with the dot command.
+// It returns the name shared by the dotfile and the image.
+func (p *Program) ToDot() (string, error) {
 	buf := &bytes.Buffer{}
 	memviz.Map(buf, &p)
 
@@ -61,26 +74,26 @@ func (p *Program) ToDot() string {
 	// make dot directories if not exists
 	err := os.MkdirAll(dotDir+"dotfiles", os.ModeDir)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	err = os.MkdirAll(dotDir+"dotimages", os.ModeDir)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	// write the dotfile
 	err = os.WriteFile(dotFilePath, buf.Bytes(), 0644)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	// run the dot command with the dotfilepath and dotimagepath
 	dotCommand := exec.Command("dot", "-Tpng", dotFilePath, "-o", dotImagePath)
 	err = dotCommand.Run()
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("running dot: %w", err)
 	}
 	time.Sleep(time.Nanosecond)
 
-	return currTime
+	return currTime, nil
 }
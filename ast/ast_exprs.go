@@ -14,6 +14,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Token     { return pe.Token }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -34,6 +35,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Token     { return ie.Token }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -57,6 +59,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Token     { return ie.Token }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -83,6 +86,58 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+type TryExpression struct {
+	Token     token.Token
+	Body      *BlockStatement
+	ErrorName *Identifier // bound to the error's message in the handler
+	Handler   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Token     { return te.Token }
+func (te *TryExpression) String() string {
+	return "try " + te.Body.String() + " catch " + te.ErrorName.String() + " " + te.Handler.String()
+}
+
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+	End     token.Token // the closing brace
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Token     { return me.Token }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	return "match " + me.Subject.String() + " { " + strings.Join(arms, ", ") + " }"
+}
+
+// MatchArm runs Body when the subject is the Variant, with its payload bound
+// to Bindings in order. The variant _ matches anything.
+type MatchArm struct {
+	Variant  *Identifier
+	Bindings []*Identifier
+	Body     *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	pattern := ma.Variant.String()
+	if len(ma.Bindings) > 0 {
+		bindings := []string{}
+		for _, b := range ma.Bindings {
+			bindings = append(bindings, b.String())
+		}
+		pattern += "(" + strings.Join(bindings, ", ") + ")"
+	}
+	return pattern + " => " + ma.Body.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -91,6 +146,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Token     { return ce.Token }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -113,6 +169,58 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Token     { return ie.Token }
 func (ie *IndexExpression) String() string {
 	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
 }
+
+// SliceIndex is the index of a slice, i.e. `1:len(xs):2` of xs[1:len(xs):2],
+// whose bounds are nil where they are omitted
+type SliceIndex struct {
+	Token token.Token // the first :
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
+func (si *SliceIndex) expressionNode()      {}
+func (si *SliceIndex) TokenLiteral() string { return si.Token.Literal }
+func (si *SliceIndex) Pos() token.Token     { return si.Token }
+func (si *SliceIndex) String() string {
+	out := boundString(si.Start) + ":" + boundString(si.End)
+	if si.Step != nil {
+		out += ":" + si.Step.String()
+	}
+	return out
+}
+
+func boundString(bound Expression) string {
+	if bound == nil {
+		return ""
+	}
+	return bound.String()
+}
+
+type FieldAccessExpression struct {
+	Token token.Token
+	Left  Expression
+	Field *Identifier
+}
+
+func (fa *FieldAccessExpression) expressionNode()      {}
+func (fa *FieldAccessExpression) TokenLiteral() string { return fa.Token.Literal }
+func (fa *FieldAccessExpression) Pos() token.Token     { return fa.Token }
+func (fa *FieldAccessExpression) String() string {
+	return "(" + fa.Left.String() + "." + fa.Field.String() + ")"
+}
+
+// PipeCall rewrites a pipe expression into the call it stands for:
+// `x | f` becomes f(x) and `x | f(a, b)` becomes f(x, a, b)
+func (ie *InfixExpression) PipeCall() *CallExpression {
+	call := &CallExpression{Token: ie.Token, Function: ie.Right, Arguments: []Expression{ie.Left}}
+	if inner, ok := ie.Right.(*CallExpression); ok {
+		call.Function = inner.Function
+		call.Arguments = append(call.Arguments, inner.Arguments...)
+	}
+	return call
+}
@@ -9,14 +9,17 @@ import (
 
 type FunctionLiteral struct {
 	Token      token.Token
+	TypeParams []*Identifier
 	Parameters []*Identifier
 	ParamTypes []types.TypeNode
 	ReturnType types.TypeNode
 	Body       *BlockStatement
+	Locals     []string // the names Body binds that are its own, resolved by the evaluator before it runs
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Token     { return fl.Token }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -26,6 +29,13 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if len(fl.TypeParams) > 0 {
+		typeParams := []string{}
+		for _, tp := range fl.TypeParams {
+			typeParams = append(typeParams, tp.String())
+		}
+		out.WriteString("[" + strings.Join(typeParams, ", ") + "]")
+	}
 	out.WriteString("(" + strings.Join(params, ", ") + ")")
 	out.WriteString(" -> " + fl.ReturnType.String() + " ")
 	out.WriteString(fl.Body.String())
@@ -37,10 +47,12 @@ type ArrayLiteral struct {
 	Token        token.Token
 	Elements     []Expression
 	ExplicitType types.TypeNode
+	End          token.Token // the closing bracket
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Token     { return al.Token }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -52,20 +64,42 @@ func (al *ArrayLiteral) String() string {
 }
 
 type DictLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token        token.Token
+	Pairs        map[Expression]Expression
+	Keys         []Expression // the keys of Pairs in source order
+	ExplicitType types.TypeNode
+	End          token.Token // the closing brace
 }
 
 func (dl *DictLiteral) expressionNode()      {}
 func (dl *DictLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DictLiteral) Pos() token.Token     { return dl.Token }
 func (dl *DictLiteral) String() string {
 	pairs := []string{}
-	for key, val := range dl.Pairs {
-		pairs = append(pairs, key.String()+":"+val.String())
+	for _, key := range dl.Keys {
+		pairs = append(pairs, key.String()+":"+dl.Pairs[key].String())
 	}
 	return "{" + strings.Join(pairs, ", ") + "}"
 }
 
+type StructLiteral struct {
+	Token      token.Token
+	Name       *Identifier
+	FieldNames []*Identifier
+	Values     []Expression
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) Pos() token.Token     { return sl.Token }
+func (sl *StructLiteral) String() string {
+	fields := []string{}
+	for idx, f := range sl.FieldNames {
+		fields = append(fields, f.String()+": "+sl.Values[idx].String())
+	}
+	return sl.Name.String() + "{" + strings.Join(fields, ", ") + "}"
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -73,6 +107,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Token     { return i.Token }
 func (i *Identifier) String() string       { return i.Value }
 
 type StringLiteral struct {
@@ -82,6 +117,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Token     { return sl.Token }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type IntegerLiteral struct {
@@ -91,6 +127,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Token     { return il.Token }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type FloatLiteral struct {
@@ -100,6 +137,7 @@ type FloatLiteral struct {
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Token     { return fl.Token }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
 type Boolean struct {
@@ -109,4 +147,5 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Token     { return b.Token }
 func (b *Boolean) String() string       { return b.Token.Literal }
@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"glimmer/token"
+	"glimmer/types"
 	"strings"
 )
 
@@ -14,6 +15,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Token     { return ls.Token }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -28,15 +30,20 @@ func (ls *LetStatement) String() string {
 }
 
 type AssignStatement struct {
-	Token token.Token
-	Type  token.TokenType
-	Name  *Identifier
-	Value Expression
+	Token  token.Token
+	Type   token.TokenType
+	Name   *Identifier
+	Target Expression // nil for a bare identifier, else a field access rooted at Name (p.x = 1)
+	Value  Expression
 }
 
 func (as *AssignStatement) statementNode()       {}
 func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) Pos() token.Token     { return as.Token }
 func (as *AssignStatement) String() string {
+	if as.Target != nil {
+		return as.Target.String() + " = " + as.Value.String() + ";"
+	}
 	return as.Name.String() + " = " + as.Value.String() + ";"
 }
 
@@ -47,6 +54,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Token     { return rs.Token }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -70,6 +78,7 @@ type IfStatement struct {
 
 func (is *IfStatement) statementNode()       {}
 func (is *IfStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *IfStatement) Pos() token.Token     { return is.Token }
 func (is *IfStatement) String() string {
 	var out bytes.Buffer
 
@@ -105,6 +114,7 @@ type ForStatement struct {
 
 func (fs *ForStatement) statementNode()       {}
 func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Token     { return fs.Token }
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
 
@@ -127,6 +137,7 @@ type WhileStatement struct {
 
 func (ws *WhileStatement) statementNode()       {}
 func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Token     { return ws.Token }
 func (ws *WhileStatement) String() string {
 	var out bytes.Buffer
 
@@ -146,6 +157,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Token     { return es.Token }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -156,10 +168,12 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	End        token.Token // the closing brace, zero for the body of a match arm without braces
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Token     { return bs.Token }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -178,6 +192,7 @@ type BreakStatement struct {
 
 func (bs *BreakStatement) statementNode()       {}
 func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Token     { return bs.Token }
 func (bs *BreakStatement) String() string {
 	return bs.TokenLiteral() + ";"
 }
@@ -188,6 +203,77 @@ type ContinueStatement struct {
 
 func (cs *ContinueStatement) statementNode()       {}
 func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Token     { return cs.Token }
 func (cs *ContinueStatement) String() string {
 	return cs.TokenLiteral() + ";"
 }
+
+type StructStatement struct {
+	Token      token.Token
+	Name       *Identifier
+	FieldNames []*Identifier
+	FieldTypes []types.TypeNode
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) Pos() token.Token     { return ss.Token }
+func (ss *StructStatement) String() string {
+	fields := []string{}
+	for idx, f := range ss.FieldNames {
+		fields = append(fields, f.String()+": "+ss.FieldTypes[idx].String())
+	}
+	return "struct " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+type EnumStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Variants []*Identifier
+	Payloads [][]types.TypeNode // the payload types of each variant, empty for none
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) Pos() token.Token     { return es.Token }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for idx, v := range es.Variants {
+		if len(es.Payloads[idx]) == 0 {
+			variants = append(variants, v.String())
+			continue
+		}
+		payload := []string{}
+		for _, pt := range es.Payloads[idx] {
+			payload = append(payload, pt.String())
+		}
+		variants = append(variants, v.String()+"("+strings.Join(payload, ", ")+")")
+	}
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+type ImportStatement struct {
+	Token token.Token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Token     { return is.Token }
+func (is *ImportStatement) String() string {
+	return "import \"" + is.Path.Value + "\" as " + is.Alias.String()
+}
+
+type TestStatement struct {
+	Token token.Token
+	Name  *StringLiteral
+	Body  *BlockStatement
+}
+
+func (ts *TestStatement) statementNode()       {}
+func (ts *TestStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TestStatement) Pos() token.Token     { return ts.Token }
+func (ts *TestStatement) String() string {
+	return "test \"" + ts.Name.Value + "\" " + ts.Body.String()
+}
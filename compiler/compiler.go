@@ -0,0 +1,812 @@
+package compiler
+
+import (
+	"fmt"
+	"glimmer/ast"
+	"glimmer/code"
+	"glimmer/evaluator"
+	"glimmer/object"
+	"strings"
+)
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
+
+type loopContext struct {
+	continueTarget int
+	breakJumps     []int // positions of OpJumps to patch with the loop's exit
+	tryDepth       int   // try blocks open when the loop started
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	loops        []*loopContext
+	tryDepth     int // try blocks open at the current position
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	builtinConsts map[string]int // constant index of each builtin referenced
+	nameConsts    map[string]int // constant index of each field name referenced
+
+	importer object.Importer
+
+	tooLarge error // the first operand emitted that does not fit its width
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:     []object.Object{},
+		symbolTable:   NewSymbolTable(),
+		scopes:        []CompilationScope{{instructions: code.Instructions{}}},
+		builtinConsts: map[string]int{},
+		nameConsts:    map[string]int{},
+	}
+}
+
+// NewWithState continues compiling against the globals and constants of a
+// previous compilation, i.e. the lines of a REPL session
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SetImporter enables import statements. Modules are loaded (and run by the
+// evaluator) at compile time; the vm sees each as a constant.
+func (c *Compiler) SetImporter(importer object.Importer) {
+	c.importer = importer
+}
+
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+// Compile lowers a typechecked program. The value of the program's last
+// statement is left on top of the stack, as it is the result of evaluation.
+func (c *Compiler) Compile(program *ast.Program) error {
+	if err := c.compileStatements(program.Statements, true); err != nil {
+		return err
+	}
+	return c.tooLarge
+}
+
+func (c *Compiler) compileStatements(stmts []ast.Statement, keep bool) error {
+	if len(stmts) == 0 {
+		if keep {
+			c.emit(code.OpNull)
+		}
+		return nil
+	}
+	for i, stmt := range stmts {
+		if err := c.compileStatement(stmt, keep && i == len(stmts)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileStatement emits stmt; if keep, the statement's value (as the
+// evaluator would return it) is pushed, otherwise the stack is left as it was
+func (c *Compiler) compileStatement(stmt ast.Statement, keep bool) error {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		if stmt.Expression == nil {
+			if keep {
+				c.emit(code.OpNull)
+			}
+			return nil
+		}
+		if err := c.compileExpression(stmt.Expression); err != nil {
+			return err
+		}
+		if !keep {
+			c.emit(code.OpPop)
+		}
+
+	case *ast.AssignStatement:
+		if err := c.compileAssignStatement(stmt); err != nil {
+			return err
+		}
+		if keep {
+			if stmt.Target != nil {
+				return c.compileExpression(stmt.Target)
+			}
+			return c.compileExpression(stmt.Name)
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.compileExpression(stmt.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.IfStatement:
+		if err := c.compileIfStatement(stmt); err != nil {
+			return err
+		}
+		if keep {
+			c.emit(code.OpNull)
+		}
+
+	case *ast.ForStatement:
+		if err := c.compileForStatement(stmt); err != nil {
+			return err
+		}
+		if keep {
+			c.emit(code.OpNull)
+		}
+
+	case *ast.WhileStatement:
+		if err := c.compileWhileStatement(stmt); err != nil {
+			return err
+		}
+		if keep {
+			c.emit(code.OpNull)
+		}
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("break outside of loop")
+		}
+		c.exitTryBlocks(loop)
+		loop.breakJumps = append(loop.breakJumps, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("continue outside of loop")
+		}
+		c.exitTryBlocks(loop)
+		c.emit(code.OpJump, loop.continueTarget)
+
+	case *ast.StructStatement:
+		if keep { // struct types only matter to the typechecker
+			c.emit(code.OpNull)
+		}
+
+	case *ast.EnumStatement:
+		c.emit(code.OpConstant, c.addConstant(evaluator.EnumNamespace(stmt)))
+		c.storeSymbol(c.symbolTable.DefineForAssign(stmt.Name.Value))
+		if keep {
+			c.emit(code.OpNull)
+		}
+
+	case *ast.TestStatement:
+		if keep { // tests only run under the test runner
+			c.emit(code.OpNull)
+		}
+
+	case *ast.ImportStatement:
+		if c.importer == nil {
+			return fmt.Errorf("imports are not supported here")
+		}
+		env, err := c.importer(stmt.Path.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.Module{Name: stmt.Alias.Value, Env: env}))
+		c.storeSymbol(c.symbolTable.DefineForAssign(stmt.Alias.Value))
+		if keep {
+			c.emit(code.OpNull)
+		}
+
+	default:
+		return fmt.Errorf("statement not supported by compiler: %T", stmt)
+	}
+	return nil
+}
+
+func (c *Compiler) compileAssignStatement(stmt *ast.AssignStatement) error {
+	emitValue := func() error {
+		if stmt.Type == "=" {
+			return c.compileExpression(stmt.Value)
+		}
+
+		var prev ast.Expression = stmt.Name
+		if stmt.Target != nil {
+			prev = stmt.Target
+		}
+		if err := c.compileExpression(prev); err != nil {
+			return err
+		}
+		if err := c.compileExpression(stmt.Value); err != nil {
+			return err
+		}
+		c.emit(infixOpcodes[string(stmt.Type[0])])
+		return nil
+	}
+
+	if stmt.Target != nil {
+		return c.compileAssignToTarget(stmt.Target, emitValue)
+	}
+
+	// a function is bound before it is compiled, so it can capture itself to recurse
+	var sym Symbol
+	_, isFn := stmt.Value.(*ast.FunctionLiteral)
+	if isFn {
+		sym = c.symbolTable.DefineForAssign(stmt.Name.Value)
+	}
+	if err := emitValue(); err != nil {
+		return err
+	}
+	if !isFn {
+		sym = c.symbolTable.DefineForAssign(stmt.Name.Value)
+	}
+	c.storeSymbol(sym)
+	return nil
+}
+
+// compileAssignToTarget stores the value emitted by emitValue at target by
+// rebuilding each container on the path from the root identifier, i.e.
+// l.a.x = v is l = setField(l, "a", setField(l.a, "x", v)) and d["k"].x = v
+// is d = setIndex(d, "k", setField(d["k"], "x", v))
+func (c *Compiler) compileAssignToTarget(target ast.Expression, emitValue func() error) error {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		if err := emitValue(); err != nil {
+			return err
+		}
+		c.storeSymbol(c.symbolTable.DefineForAssign(target.Value))
+		return nil
+	case *ast.FieldAccessExpression:
+		return c.compileAssignToTarget(target.Left, func() error {
+			if err := c.compileExpression(target.Left); err != nil {
+				return err
+			}
+			if err := emitValue(); err != nil {
+				return err
+			}
+			c.emit(code.OpSetField, c.nameConstant(target.Field.Value))
+			return nil
+		})
+	case *ast.IndexExpression:
+		return c.compileAssignToTarget(target.Left, func() error {
+			if err := c.compileExpression(target.Left); err != nil {
+				return err
+			}
+			if err := c.compileExpression(target.Index); err != nil {
+				return err
+			}
+			if err := emitValue(); err != nil {
+				return err
+			}
+			c.emit(code.OpSetIndex)
+			return nil
+		})
+	default:
+		return fmt.Errorf("invalid assignment target: %s", target.String())
+	}
+}
+
+func (c *Compiler) compileIfStatement(stmt *ast.IfStatement) error {
+	conditions := append([][]ast.Statement{stmt.Condition}, stmt.ElifConditions...)
+	branches := append([]*ast.BlockStatement{stmt.TrueBranch}, stmt.ElifBranches...)
+	return c.compileBranches(conditions, branches, stmt.FalseBranch, false)
+}
+
+// compileBranches emits an if/else-if/else chain. As an expression, the taken
+// branch's value (or null without an else) is left on the stack.
+func (c *Compiler) compileBranches(conditions [][]ast.Statement, branches []*ast.BlockStatement,
+	falseBranch *ast.BlockStatement, keep bool) error {
+	endJumps := []int{}
+
+	for i, cond := range conditions {
+		if err := c.compileStatements(cond, true); err != nil {
+			return err
+		}
+		notTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileStatements(branches[i].Statements, keep); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		c.changeOperand(notTruthyPos, len(c.currentInstructions()))
+	}
+
+	if falseBranch != nil {
+		if err := c.compileStatements(falseBranch.Statements, keep); err != nil {
+			return err
+		}
+	} else if keep {
+		c.emit(code.OpNull)
+	}
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileForStatement(stmt *ast.ForStatement) error {
+	if err := c.compileExpression(stmt.Collection); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+	iterSym := c.symbolTable.Define(fmt.Sprintf("@iter%d", len(c.currentInstructions())))
+	c.storeSymbol(iterSym)
+
+	loopStart := len(c.currentInstructions())
+	c.loadSymbol(iterSym)
+	iterNextPos := c.emit(code.OpIterNext, 9999, len(stmt.LoopVars))
+
+	for i := len(stmt.LoopVars) - 1; i >= 0; i-- {
+		c.storeSymbol(c.symbolTable.DefineForAssign(stmt.LoopVars[i].Value))
+	}
+
+	loop := c.enterLoop(loopStart)
+	if err := c.compileStatements(stmt.Body.Statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart)
+	c.leaveLoop(loop)
+
+	c.changeOperand(iterNextPos, len(c.currentInstructions()), len(stmt.LoopVars))
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(stmt *ast.WhileStatement) error {
+	condStart := len(c.currentInstructions())
+	if err := c.compileStatements(stmt.Condition, true); err != nil {
+		return err
+	}
+	notTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	loop := c.enterLoop(condStart)
+	if err := c.compileStatements(stmt.Body.Statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, condStart)
+	c.leaveLoop(loop)
+
+	c.changeOperand(notTruthyPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileExpression(exp ast.Expression) error {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		if exp.Operator == "|" {
+			return c.compileExpression(exp.PipeCall())
+		}
+		if err := c.compileExpression(exp.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(exp.Right); err != nil {
+			return err
+		}
+		if exp.Operator == "not in" {
+			c.emit(code.OpIn)
+			c.emit(code.OpBang)
+			return nil
+		}
+		op, ok := infixOpcodes[exp.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", exp.Operator)
+		}
+		c.emit(op)
+
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(exp.Right); err != nil {
+			return err
+		}
+		switch exp.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", exp.Operator)
+		}
+
+	case *ast.IfExpression:
+		conditions := append([][]ast.Statement{exp.Condition}, exp.ElifConditions...)
+		branches := append([]*ast.BlockStatement{exp.TrueBranch}, exp.ElifBranches...)
+		return c.compileBranches(conditions, branches, exp.FalseBranch, true)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(exp)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(exp)
+
+	case *ast.CallExpression:
+		if err := c.compileExpression(exp.Function); err != nil {
+			return err
+		}
+		for _, arg := range exp.Arguments {
+			if err := c.compileExpression(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(exp.Arguments))
+
+	case *ast.IndexExpression:
+		if err := c.compileExpression(exp.Left); err != nil {
+			return err
+		}
+		if slice, ok := exp.Index.(*ast.SliceIndex); ok {
+			// an omitted bound is null
+			for _, bound := range []ast.Expression{slice.Start, slice.End, slice.Step} {
+				if bound == nil {
+					c.emit(code.OpNull)
+				} else if err := c.compileExpression(bound); err != nil {
+					return err
+				}
+			}
+			c.emit(code.OpSlice)
+			return nil
+		}
+		if err := c.compileExpression(exp.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FieldAccessExpression:
+		if err := c.compileExpression(exp.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpGetField, c.nameConstant(exp.Field.Value))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(exp)
+
+	case *ast.Identifier:
+		if sym, ok := c.symbolTable.Resolve(exp.Value); ok {
+			c.loadSymbol(sym)
+			return nil
+		}
+		if builtin, ok := evaluator.LookupBuiltin(exp.Value); ok {
+			c.emit(code.OpConstant, c.builtinConstant(exp.Value, builtin))
+			return nil
+		}
+		return fmt.Errorf("identifier not found: %s", exp.Value)
+
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			if err := c.compileExpression(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(exp.Elements))
+
+	case *ast.DictLiteral:
+		for key, val := range exp.Pairs {
+			if err := c.compileExpression(key); err != nil {
+				return err
+			}
+			if err := c.compileExpression(val); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpDict, len(exp.Pairs))
+
+	case *ast.StructLiteral:
+		layout := &object.Struct{Name: exp.Name.Value}
+		for idx, field := range exp.FieldNames {
+			layout.FieldNames = append(layout.FieldNames, field.Value)
+			if err := c.compileExpression(exp.Values[idx]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpStruct, c.addConstant(layout))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: exp.Value}))
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: exp.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: exp.Value}))
+
+	case *ast.Boolean:
+		if exp.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	default:
+		return fmt.Errorf("expression not supported by compiler: %T", exp)
+	}
+	return nil
+}
+
+// compileTryExpression leaves the value of the body, or of the catch block if
+// the body raised an error, on the stack
+func (c *Compiler) compileTryExpression(te *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.scopes[c.scopeIndex].tryDepth++
+	if err := c.compileStatements(te.Body.Statements, true); err != nil {
+		return err
+	}
+	c.scopes[c.scopeIndex].tryDepth--
+
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	// the vm enters the catch block with the error's message pushed
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	c.storeSymbol(c.symbolTable.DefineForAssign(te.ErrorName.Value))
+	if err := c.compileStatements(te.Handler.Statements, true); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileMatchExpression tries the arms in order with the subject on the
+// stack; the arm of the subject's variant replaces it with the payload, which
+// its bindings then store
+func (c *Compiler) compileMatchExpression(me *ast.MatchExpression) error {
+	if err := c.compileExpression(me.Subject); err != nil {
+		return err
+	}
+
+	endJumps := []int{}
+	matchesAll := false
+	for _, arm := range me.Arms {
+		matchPos := -1
+		if arm.Variant.Value == "_" {
+			c.emit(code.OpPop)
+			matchesAll = true
+		} else {
+			matchPos = c.emit(code.OpMatch, 9999, c.nameConstant(arm.Variant.Value))
+			for i := len(arm.Bindings) - 1; i >= 0; i-- {
+				if arm.Bindings[i].Value == "_" {
+					c.emit(code.OpPop)
+				} else {
+					c.storeSymbol(c.symbolTable.DefineForAssign(arm.Bindings[i].Value))
+				}
+			}
+		}
+
+		if err := c.compileStatements(arm.Body.Statements, true); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		if matchPos >= 0 {
+			c.changeOperand(matchPos, len(c.currentInstructions()), c.nameConstant(arm.Variant.Value))
+		}
+		if matchesAll {
+			break
+		}
+	}
+
+	if !matchesAll { // unreachable once typechecked, as matches are exhaustive
+		c.emit(code.OpPop)
+		c.emit(code.OpNull)
+	}
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(fun *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, param := range fun.Parameters {
+		c.symbolTable.Define(param.Value)
+	}
+
+	if err := c.compileStatements(fun.Body.Statements, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+
+	params := []string{}
+	for _, p := range fun.Parameters {
+		params = append(params, p.String())
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(fun.Parameters),
+		Source:        "fn (" + strings.Join(params, ", ") + ") " + fun.Body.String(),
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	for _, sym := range freeSymbols {
+		if sym.Scope == LocalScope {
+			c.emit(code.OpCaptureLocal, sym.Index)
+		} else {
+			c.emit(code.OpCaptureFree, sym.Index)
+		}
+	}
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+	"&&": code.OpAnd,
+	"||": code.OpOr,
+	"in": code.OpIn,
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) builtinConstant(name string, builtin *object.Builtin) int {
+	if idx, ok := c.builtinConsts[name]; ok {
+		return idx
+	}
+	c.builtinConsts[name] = c.addConstant(builtin)
+	return c.builtinConsts[name]
+}
+
+func (c *Compiler) nameConstant(name string) int {
+	if idx, ok := c.nameConsts[name]; ok {
+		return idx
+	}
+	c.nameConsts[name] = c.addConstant(&object.String{Value: name})
+	return c.nameConsts[name]
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operands)
+	newInstruction := code.Make(op, operands...)
+
+	for i := 0; i < len(newInstruction); i++ {
+		c.currentInstructions()[opPos+i] = newInstruction[i]
+	}
+}
+
+// checkOperands records an error if an operand is wider than the bytes the vm
+// reads it from, which code.Make would otherwise silently truncate
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.tooLarge != nil {
+		return
+	}
+	for i, operand := range operands {
+		max := 1<<(8*def.OperandWidths[i]) - 1
+		if operand > max {
+			c.tooLarge = fmt.Errorf("too many %s, at most %d fit", operandKind(op, i), max+1)
+			return
+		}
+	}
+}
+
+// operandKind names what the i-th operand of op counts or indexes
+func operandKind(op code.Opcode, i int) string {
+	switch {
+	case op == code.OpGetLocal || op == code.OpSetLocal || op == code.OpCaptureLocal:
+		return "local variables in one function"
+	case op == code.OpGetFree || op == code.OpSetFree || op == code.OpCaptureFree || (op == code.OpClosure && i == 1):
+		return "free variables in one function"
+	case op == code.OpGetGlobal || op == code.OpSetGlobal:
+		return "global variables"
+	case op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpTry || (op == code.OpIterNext || op == code.OpMatch) && i == 0:
+		return "bytes of instructions in one function"
+	case op == code.OpIterNext:
+		return "loop variables"
+	case op == code.OpCall:
+		return "call arguments"
+	case op == code.OpArray:
+		return "array elements"
+	case op == code.OpDict:
+		return "dict pairs"
+	default:
+		return "constants"
+	}
+}
+
+func (c *Compiler) currentLoop() *loopContext {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+func (c *Compiler) enterLoop(continueTarget int) *loopContext {
+	loop := &loopContext{continueTarget: continueTarget, tryDepth: c.scopes[c.scopeIndex].tryDepth}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+	return loop
+}
+
+// exitTryBlocks closes the try blocks a break or continue jumps out of
+func (c *Compiler) exitTryBlocks(loop *loopContext) {
+	for i := loop.tryDepth; i < c.scopes[c.scopeIndex].tryDepth; i++ {
+		c.emit(code.OpEndTry)
+	}
+}
+
+// leaveLoop points the loop's breaks at the current position, its exit
+func (c *Compiler) leaveLoop(loop *loopContext) {
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,189 @@
+package compiler
+
+import (
+	"fmt"
+	"glimmer/ast"
+	"glimmer/code"
+	"glimmer/lexer"
+	"glimmer/parser"
+	"strings"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// lines formats line with each index below n, one per line
+func lines(line string, n int) string {
+	var out strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&out, line+"\n", i)
+	}
+	return out.String()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestCompilerInstructions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+	}{
+		{
+			"1 + 2",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+			},
+		},
+		{
+			"1; 2",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+			},
+		},
+		{
+			"x = 1; x",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+			},
+		},
+		{
+			"ife true { 1 } else { 2 }",
+			[]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpConstant, 1),
+			},
+		},
+		{
+			"while true { break }",
+			[]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpJump, 10),
+				code.Make(code.OpJump, 0),
+				code.Make(code.OpNull),
+			},
+		},
+		{
+			"-1 | len",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMinus),
+				code.Make(code.OpCall, 1),
+			},
+		},
+		{
+			"enum E { A, B(int) }; match E.A { A => 1, B(x) => x }",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetField, 1),
+				code.Make(code.OpMatch, 23, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpJump, 39),
+				code.Make(code.OpMatch, 37, 3),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 39),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+
+		expected := concatInstructions(tt.expected)
+		actual := compiler.Bytecode().Instructions
+		if actual.String() != expected.String() {
+			t.Errorf("wrong instructions for %q.\nwant=\n%s\ngot=\n%s", tt.input, expected, actual)
+		}
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "break outside of loop"},
+		{"fn() -> none { continue }", "continue outside of loop"},
+		{"y", "identifier not found: y"},
+		{"fn() -> int {\n" + lines("a%d = 0", 257) + "0 }", "too many local variables in one function, at most 256 fit"},
+		{lines("%d", 65537), "too many constants, at most 65536 fit"},
+		{"x = 0\nif true {\n" + lines("x = %d", 12000) + "}", "too many bytes of instructions in one function, at most 65536 fit"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compiler error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestClosuresShareVariables(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+
+	inner := NewEnclosedSymbolTable(local)
+
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: FreeScope, Index: 0},
+	}
+	for _, name := range []string{"a", "b"} {
+		sym, ok := inner.Resolve(name)
+		if !ok {
+			t.Fatalf("name %s not resolvable", name)
+		}
+		if sym != expected[name] {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", name, expected[name], sym)
+		}
+	}
+
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("globals should not be captured. got=%+v", local.FreeSymbols)
+	}
+	if inner.FreeSymbols[0] != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("local not captured from enclosing function. got=%+v", inner.FreeSymbols[0])
+	}
+
+	if sym := inner.DefineForAssign("b"); sym != expected["b"] {
+		t.Errorf("assignment should update the captured variable. got=%+v", sym)
+	}
+	if sym := inner.DefineForAssign("c"); sym != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("assignment to a new name should define a local. got=%+v", sym)
+	}
+}
@@ -0,0 +1,81 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps identifiers to storage slots for one function (or the
+// top level). A local of an enclosing function becomes a free variable, which
+// the closure shares with that function rather than copying; globals are
+// shared by being read from the globals store directly.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	FreeSymbols    []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	return &SymbolTable{store: s}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineForAssign returns the slot an assignment to name writes to. Like the
+// evaluator, assigning to a name updates the nearest scope that has it, and
+// only creates it here when no scope does.
+func (s *SymbolTable) DefineForAssign(name string) Symbol {
+	if sym, ok := s.Resolve(name); ok {
+		return sym
+	}
+	return s.Define(name)
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	sym, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		sym, ok = s.Outer.Resolve(name)
+		if !ok || sym.Scope == GlobalScope {
+			return sym, ok
+		}
+		return s.defineFree(sym), true
+	}
+	return sym, ok
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
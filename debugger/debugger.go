@@ -0,0 +1,316 @@
+// Package debugger runs a program on the tree-walking evaluator, pausing at
+// breakpoints and steps to take commands from a terminal prompt.
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"glimmer/ast"
+	"glimmer/evaluator"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(debug) "
+
+const HELP = `commands:
+  s, step          run to the next statement, stepping into calls
+  n, next          run to the next statement, stepping over calls
+  o, out           run until the current call returns
+  c, continue      run until the next breakpoint
+  b, break <line>  set a breakpoint, or list them without a line
+  d, delete <line> remove a breakpoint
+  p, print <expr>  evaluate an expression in the paused scope
+  e, env           print the paused scope and the scopes enclosing it
+  bt, backtrace    print the active calls
+  l, list          print the source around the paused line
+  q, quit, exit    stop the program
+  h, help          print this message`
+
+// how the program runs until the next pause
+type stepMode int
+
+const (
+	stepInto stepMode = iota // pause at the next statement
+	stepOver                 // pause at the next statement no deeper than target
+	stepOut                  // pause at the next statement shallower than target
+	run                      // pause only at breakpoints
+)
+
+type frame struct {
+	name string
+	pos  token.Token
+}
+
+// Debugger is an object.Tracer that pauses the evaluator to run commands
+type Debugger struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	source []string // the program, by line
+
+	breakpoints map[int]bool
+	mode        stepMode
+	target      int     // the call depth stepOver and stepOut compare against
+	calls       []frame // the active calls, outermost first
+
+	last       ast.Statement // the statement traced before the current one
+	evaluating bool          // set while running a print command, which is not traced
+}
+
+// quitting is panicked with to unwind the evaluator when the user quits
+type quitting struct{}
+
+func New(in io.Reader, out io.Writer, source string) *Debugger {
+	return &Debugger{
+		in:          bufio.NewScanner(in),
+		out:         out,
+		source:      strings.Split(source, "\n"),
+		breakpoints: make(map[int]bool),
+		mode:        stepInto, // pause before the first statement
+	}
+}
+
+// Run evaluates program in env under the debugger, returning the result and
+// whether the program ran to its end rather than being quit
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) (result object.Object, finished bool) {
+	env.SetTracer(d)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(quitting); !ok {
+				panic(r)
+			}
+			result, finished = nil, false
+		}
+	}()
+	return evaluator.Eval(program, env), true
+}
+
+func (d *Debugger) Statement(stmt ast.Statement, env *object.Environment) {
+	if d.evaluating {
+		return
+	}
+	if d.shouldPause(stmt) {
+		d.pause(stmt, env)
+	}
+	d.last = stmt
+}
+
+func (d *Debugger) Call(name string, pos token.Token) {
+	d.calls = append(d.calls, frame{name: name, pos: pos})
+}
+
+func (d *Debugger) Return(name string) {
+	d.calls = d.calls[:len(d.calls)-1]
+}
+
+func (d *Debugger) shouldPause(stmt ast.Statement) bool {
+	line := stmt.Pos().Line
+	// break once per visit of a line, though it may hold several statements
+	if d.breakpoints[line] && (d.last == nil || d.last.Pos().Line != line || d.last == stmt) {
+		return true
+	}
+
+	switch d.mode {
+	case stepInto:
+		return true
+	case stepOver:
+		return len(d.calls) <= d.target
+	case stepOut:
+		return len(d.calls) < d.target
+	default:
+		return false
+	}
+}
+
+// pause reads and runs commands until one resumes the program
+func (d *Debugger) pause(stmt ast.Statement, env *object.Environment) {
+	line := stmt.Pos().Line
+	fmt.Fprintf(d.out, "[line %d] %s\n", line, strings.TrimSpace(d.sourceLine(line)))
+
+	for {
+		fmt.Fprint(d.out, PROMPT)
+		if !d.in.Scan() { // out of input: run the rest of the program undisturbed
+			d.mode = run
+			d.breakpoints = make(map[int]bool)
+			fmt.Fprintln(d.out)
+			return
+		}
+
+		command, arg := splitCommand(d.in.Text())
+		switch command {
+		case "s", "step":
+			d.mode = stepInto
+			return
+		case "n", "next":
+			d.mode, d.target = stepOver, len(d.calls)
+			return
+		case "o", "out":
+			d.mode, d.target = stepOut, len(d.calls)
+			return
+		case "c", "continue":
+			d.mode = run
+			return
+		case "b", "break":
+			d.setBreakpoint(arg)
+		case "d", "delete":
+			d.deleteBreakpoint(arg)
+		case "p", "print":
+			d.print(arg, env)
+		case "e", "env":
+			d.printEnv(env)
+		case "bt", "backtrace":
+			d.printBacktrace(line)
+		case "l", "list":
+			d.list(line)
+		case "q", "quit", "exit":
+			panic(quitting{})
+		case "h", "help":
+			fmt.Fprintln(d.out, HELP)
+		case "":
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, h for help\n", command)
+		}
+	}
+}
+
+func splitCommand(input string) (string, string) {
+	input = strings.TrimSpace(input)
+	if idx := strings.IndexAny(input, " \t"); idx >= 0 {
+		return input[:idx], strings.TrimSpace(input[idx+1:])
+	}
+	return input, ""
+}
+
+func (d *Debugger) setBreakpoint(arg string) {
+	if arg == "" {
+		lines := []int{}
+		for line := range d.breakpoints {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(d.out, "breakpoint at line %d: %s\n", line, strings.TrimSpace(d.sourceLine(line)))
+		}
+		return
+	}
+
+	line, ok := d.parseLine(arg)
+	if !ok {
+		return
+	}
+	d.breakpoints[line] = true
+	fmt.Fprintf(d.out, "breakpoint set at line %d\n", line)
+}
+
+func (d *Debugger) deleteBreakpoint(arg string) {
+	line, ok := d.parseLine(arg)
+	if !ok {
+		return
+	}
+	if !d.breakpoints[line] {
+		fmt.Fprintf(d.out, "no breakpoint at line %d\n", line)
+		return
+	}
+	delete(d.breakpoints, line)
+	fmt.Fprintf(d.out, "breakpoint at line %d deleted\n", line)
+}
+
+func (d *Debugger) parseLine(arg string) (int, bool) {
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(d.source) {
+		fmt.Fprintf(d.out, "not a line of the program: %q\n", arg)
+		return 0, false
+	}
+	return line, true
+}
+
+// print evaluates input in env. It is not typechecked, and assignments in it
+// change the paused program's variables.
+func (d *Debugger) print(input string, env *object.Environment) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.Errors() {
+			fmt.Fprintln(d.out, err)
+		}
+		return
+	}
+
+	d.evaluating = true
+	evaluated := evaluator.Eval(program, env)
+	d.evaluating = false
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(d.out, errObj.Traceback())
+	} else if evaluated != nil {
+		fmt.Fprintln(d.out, evaluated.Inspect())
+	}
+}
+
+// printEnv prints each scope from env outwards, the last being the globals
+func (d *Debugger) printEnv(env *object.Environment) {
+	for depth, scope := 0, env; scope != nil; depth, scope = depth+1, scope.Outer() {
+		if scope.Outer() == nil {
+			fmt.Fprintln(d.out, "globals:")
+		} else {
+			fmt.Fprintf(d.out, "scope %d:\n", depth)
+		}
+		for _, name := range scope.Names() {
+			val, _ := scope.Get(name)
+			fmt.Fprintf(d.out, "  %s = %s\n", name, summarize(val))
+		}
+	}
+}
+
+// summarize inspects val, showing only the parameters of a function
+func summarize(val object.Object) string {
+	if fn, ok := val.(*object.Function); ok {
+		params := []string{}
+		for _, p := range fn.Parameters {
+			params = append(params, p.Value)
+		}
+		return "fn(" + strings.Join(params, ", ") + ")"
+	}
+	return val.Inspect()
+}
+
+func (d *Debugger) printBacktrace(line int) {
+	fmt.Fprintf(d.out, "at line %d\n", line)
+	for idx := len(d.calls) - 1; idx >= 0; idx-- {
+		call := d.calls[idx]
+		fmt.Fprintf(d.out, "\tin %s, called at [%d,%d]\n", call.name, call.pos.Line, call.pos.Col)
+	}
+}
+
+// list prints the source around line, marking it and any breakpoints
+func (d *Debugger) list(line int) {
+	from, to := line-3, line+3
+	if from < 1 {
+		from = 1
+	}
+	if to > len(d.source) {
+		to = len(d.source)
+	}
+	for l := from; l <= to; l++ {
+		marker := "  "
+		if l == line {
+			marker = "->"
+		} else if d.breakpoints[l] {
+			marker = " *"
+		}
+		fmt.Fprintf(d.out, "%s %3d  %s\n", marker, l, d.sourceLine(l))
+	}
+}
+
+func (d *Debugger) sourceLine(line int) string {
+	if line < 1 || line > len(d.source) {
+		return ""
+	}
+	return strings.TrimRight(d.source[line-1], "\r")
+}
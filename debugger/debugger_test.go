@@ -0,0 +1,146 @@
+package debugger
+
+import (
+	"bytes"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"strings"
+	"testing"
+)
+
+const program = `n = 3
+square = fn(x: int) -> int {
+    y = x * x
+    y
+}
+total = 0
+for i in range(n) {
+    total += square(i)
+}
+total`
+
+// debug runs program under a debugger fed commands, returning its output
+func debug(t *testing.T, commands ...string) (string, object.Object, bool) {
+	p := parser.New(lexer.New(program))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var out bytes.Buffer
+	d := New(strings.NewReader(strings.Join(commands, "\n")+"\n"), &out, program)
+	result, finished := d.Run(prog, object.NewEnvironment())
+	return out.String(), result, finished
+}
+
+func TestDebuggerSession(t *testing.T) {
+	out, result, finished := debug(t, "b 3", "c", "bt", "e", "p x + 100", "n", "n", "o", "p total", "d 3", "c")
+
+	expected := `[line 1] n = 3
+(debug) breakpoint set at line 3
+(debug) [line 3] y = x * x
+(debug) at line 3
+	in square, called at [8,20]
+(debug) scope 0:
+  x = 0
+globals:
+  i = 0
+  n = 3
+  square = fn(x)
+  total = 0
+(debug) 100
+(debug) [line 4] y
+(debug) [line 8] total += square(i)
+(debug) [line 3] y = x * x
+(debug) 0
+(debug) breakpoint at line 3 deleted
+(debug) `
+	if out != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out)
+	}
+	if !finished || result.Inspect() != "5" {
+		t.Errorf("program did not finish with 5. got=%v, finished=%t", result, finished)
+	}
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	tests := []struct {
+		commands []string
+		lines    []int // the lines paused at, in order
+	}{
+		{[]string{"s", "s", "s", "s", "s", "s"}, []int{1, 2, 6, 7, 8, 3, 4}},
+		{[]string{"n", "n", "n", "n", "n", "n"}, []int{1, 2, 6, 7, 8, 8, 8}},
+		{[]string{"b 4", "c", "o", "c", "s"}, []int{1, 4, 8, 4, 8}},
+		{[]string{"b 8", "c", "c", "d 8", "c"}, []int{1, 8, 8}},
+	}
+
+	for _, tt := range tests {
+		out, _, finished := debug(t, tt.commands...)
+		lines := pausedLines(out)
+		if len(lines) < len(tt.lines) {
+			t.Errorf("%v: expected pauses at %v, got=%v", tt.commands, tt.lines, lines)
+			continue
+		}
+		for idx, line := range tt.lines {
+			if lines[idx] != line {
+				t.Errorf("%v: expected pauses at %v, got=%v", tt.commands, tt.lines, lines)
+				break
+			}
+		}
+		if !finished {
+			t.Errorf("%v: program did not finish", tt.commands)
+		}
+	}
+}
+
+func TestDebuggerPrintAssigns(t *testing.T) {
+	out, result, _ := debug(t, "b 10", "c", "p total = 42", "p total", "c")
+	if !strings.Contains(out, "(debug) 42\n(debug) 42\n") {
+		t.Errorf("print did not assign. got=%q", out)
+	}
+	if result.Inspect() != "42" {
+		t.Errorf("assignment did not reach the program. got=%s", result.Inspect())
+	}
+}
+
+func TestDebuggerQuit(t *testing.T) {
+	out, result, finished := debug(t, "n", "q")
+	if finished || result != nil {
+		t.Errorf("program was not stopped. got=%v, finished=%t", result, finished)
+	}
+	if !strings.HasSuffix(out, "[line 2] square = fn(x: int) -> int {\n(debug) ") {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func TestDebuggerErrors(t *testing.T) {
+	out, _, _ := debug(t, "b 99", "d 2", "p 1 +", "p nope", "frobnicate", "c")
+	for _, expected := range []string{
+		`not a line of the program: "99"`,
+		"no breakpoint at line 2",
+		"no prefix parse function for EOF found",
+		"Runtime Error at [1,5]: identifier not found: nope",
+		`unknown command "frobnicate", h for help`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("output does not contain %q. got=%q", expected, out)
+		}
+	}
+}
+
+// pausedLines returns the lines of the [line N] pause messages in out
+func pausedLines(out string) []int {
+	lines := []int{}
+	for _, part := range strings.Split(out, "[line ")[1:] {
+		var line int
+		for _, ch := range part {
+			if ch < '0' || ch > '9' {
+				break
+			}
+			line = line*10 + int(ch-'0')
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
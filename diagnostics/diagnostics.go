@@ -0,0 +1,185 @@
+// Package diagnostics describes the errors found in Glimmer source by the
+// parser and the typechecker, and renders them for people, with the source
+// line they are on, or as JSON for tools.
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"glimmer/lexer"
+	"glimmer/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Position is a 1-based line and column of the source
+type Position struct {
+	Line int `json:"line"`
+	Col  int `json:"col"`
+}
+
+// Span is the source a diagnostic is about, from Start to End inclusive
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is a problem found in a source file. Code names the kind of
+// problem, i.e. "unexpected-token", for tools to tell them apart. A
+// Diagnostic without a position, such as an error reading the file, has the
+// zero Span.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	File     string   `json:"file,omitempty"`
+	Span     Span     `json:"span"`
+	Message  string   `json:"message"`
+	Hints    []string `json:"hints,omitempty"`
+}
+
+// TokenSpan returns the span of tok in the source. The lexer positions words
+// and numbers one past their end, strings at their closing quote and
+// everything else at its last character.
+func TokenSpan(tok token.Token) Span {
+	end := tok.Col
+	length := len(tok.Literal)
+	switch {
+	case tok.Type == token.STRING:
+		length += 2
+	case length > 0 && isWordChar(rune(tok.Literal[0])):
+		end--
+	}
+	if length == 0 {
+		length = 1
+	}
+	start := end - length + 1
+	if start < 1 {
+		start = 1
+	}
+	return Span{Start: Position{Line: tok.Line, Col: start}, End: Position{Line: tok.Line, Col: end}}
+}
+
+func isWordChar(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// Locate returns the span of the token of src the lexer positions at line and
+// col, as the typechecker positions its errors, or the column alone if there
+// is none
+func Locate(src string, line, col int) Span {
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Line == line && tok.Col == col {
+			return TokenSpan(tok)
+		}
+	}
+	pos := Position{Line: line, Col: col}
+	return Span{Start: pos, End: pos}
+}
+
+// Render formats d with the line of src it starts on, underlining its span:
+//
+//	error[unexpected-token]: no prefix parse function for ) found
+//	  --> main.gli:1:5
+//	  |
+//	1 | 1 + )
+//	  |     ^
+func Render(d Diagnostic, src string) string {
+	var out strings.Builder
+	if d.Code != "" {
+		fmt.Fprintf(&out, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+	} else {
+		fmt.Fprintf(&out, "%s: %s\n", d.Severity, d.Message)
+	}
+
+	start := d.Span.Start
+	lines := strings.Split(src, "\n")
+	if start.Line < 1 || start.Line > len(lines) {
+		if d.File != "" {
+			fmt.Fprintf(&out, "  --> %s\n", d.File)
+		}
+		writeHints(&out, d.Hints, "  ")
+		return strings.TrimSuffix(out.String(), "\n")
+	}
+
+	location := fmt.Sprintf("%d:%d", start.Line, start.Col)
+	if d.File != "" {
+		location = d.File + ":" + location
+	}
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	text := strings.TrimRight(lines[start.Line-1], "\r")
+
+	fmt.Fprintf(&out, "%s --> %s\n", gutter, location)
+	fmt.Fprintf(&out, "%s |\n", gutter)
+	fmt.Fprintf(&out, "%d | %s\n", start.Line, text)
+	fmt.Fprintf(&out, "%s | %s\n", gutter, underline(text, start.Col, endCol(d.Span, len(text))))
+	writeHints(&out, d.Hints, gutter+" ")
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// endCol is the column the underline of span stops at on its first line
+func endCol(span Span, lineLen int) int {
+	if span.End.Line > span.Start.Line {
+		return lineLen
+	}
+	if span.End.Col < span.Start.Col {
+		return span.Start.Col
+	}
+	return span.End.Col
+}
+
+// underline marks the columns start to end of text with `^~~~`, keeping the
+// tabs before start so that the marks line up under them
+func underline(text string, start, end int) string {
+	var pad strings.Builder
+	for idx := 0; idx < start-1; idx++ {
+		if idx < len(text) && text[idx] == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	return pad.String() + "^" + strings.Repeat("~", end-start)
+}
+
+func writeHints(out *strings.Builder, hints []string, indent string) {
+	for _, hint := range hints {
+		fmt.Fprintf(out, "%s= hint: %s\n", indent, hint)
+	}
+}
+
+// SourceError is a Diagnostic found in src, as an error rendering it
+type SourceError struct {
+	Diagnostic
+	Source string
+}
+
+func (e *SourceError) Error() string {
+	return Render(e.Diagnostic, e.Source)
+}
+
+// FromError returns the Diagnostic of a SourceError, or one with only the
+// message of any other error
+func FromError(err error) Diagnostic {
+	if srcErr, ok := err.(*SourceError); ok {
+		return srcErr.Diagnostic
+	}
+	return Diagnostic{Severity: Error, Message: err.Error()}
+}
+
+// JSON encodes the diagnostics of errs as a JSON array
+func JSON(errs []error) ([]byte, error) {
+	diags := make([]Diagnostic, len(errs))
+	for idx, err := range errs {
+		diags[idx] = FromError(err)
+	}
+	return json.Marshal(diags)
+}
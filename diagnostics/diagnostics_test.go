@@ -0,0 +1,126 @@
+package diagnostics
+
+import (
+	"errors"
+	"glimmer/lexer"
+	"glimmer/token"
+	"testing"
+)
+
+func TestTokenSpan(t *testing.T) {
+	input := "if count >= 12 {\n\t\"ab\" + 1.5\n}"
+	expected := []Span{
+		{Position{1, 1}, Position{1, 2}},   // if
+		{Position{1, 4}, Position{1, 8}},   // count
+		{Position{1, 10}, Position{1, 11}}, // >=
+		{Position{1, 13}, Position{1, 14}}, // 12
+		{Position{1, 16}, Position{1, 16}}, // {
+		{Position{2, 2}, Position{2, 5}},   // "ab"
+		{Position{2, 7}, Position{2, 7}},   // +
+		{Position{2, 9}, Position{2, 11}},  // 1.5
+		{Position{3, 1}, Position{3, 1}},   // }
+	}
+
+	l := lexer.New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if got := TokenSpan(tok); got != want {
+			t.Errorf("tests[%d] wrong span of %q. expected=%v, got=%v", i, tok.Literal, want, got)
+		}
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF, got=%s", tok.Type)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		line, col int
+		expected  Span
+	}{
+		{1, 6, Span{Position{1, 5}, Position{1, 5}}},   // the error of `1 + x` at the ID
+		{1, 3, Span{Position{1, 3}, Position{1, 3}}},   // at the +
+		{2, 4, Span{Position{2, 4}, Position{2, 4}}},   // no token there
+		{2, 12, Span{Position{2, 5}, Position{2, 11}}}, // the ( of the call, sharing its position with missing
+	}
+
+	for _, tt := range tests {
+		if got := Locate("1 + x\ny = missing()", tt.line, tt.col); got != tt.expected {
+			t.Errorf("wrong span at [%d,%d]. expected=%v, got=%v", tt.line, tt.col, tt.expected, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		diag     Diagnostic
+		src      string
+		expected string
+	}{
+		{
+			Diagnostic{Severity: Error, Code: "unexpected-token", File: "main.gli",
+				Span: Span{Position{1, 5}, Position{1, 5}}, Message: "no prefix parse function for ) found"},
+			"1 + )",
+			"error[unexpected-token]: no prefix parse function for ) found\n" +
+				"  --> main.gli:1:5\n" +
+				"  |\n" +
+				"1 | 1 + )\n" +
+				"  |     ^",
+		},
+		{
+			Diagnostic{Severity: Error, Code: "type-error", Span: Span{Position{10, 2}, Position{10, 8}},
+				Message: "identifier not found: missing", Hints: []string{"define it first"}},
+			"\n\n\n\n\n\n\n\n\n\tmissing + 1",
+			"error[type-error]: identifier not found: missing\n" +
+				"   --> 10:2\n" +
+				"   |\n" +
+				"10 | \tmissing + 1\n" +
+				"   | \t^~~~~~~\n" +
+				"   = hint: define it first",
+		},
+		{
+			Diagnostic{Severity: Warning, Span: Span{Position{1, 3}, Position{2, 1}}, Message: "spans lines"},
+			"x = \"a\nb\"",
+			"warning: spans lines\n" +
+				"  --> 1:3\n" +
+				"  |\n" +
+				"1 | x = \"a\n" +
+				"  |   ^~~~",
+		},
+		{
+			Diagnostic{Severity: Error, File: "main.gli", Message: "no such file"},
+			"",
+			"error: no such file\n" +
+				"  --> main.gli",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Render(tt.diag, tt.src); got != tt.expected {
+			t.Errorf("wrong rendering.\nexpected=\n%s\ngot=\n%s", tt.expected, got)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	errs := []error{
+		&SourceError{Diagnostic: Diagnostic{Severity: Error, Code: "type-error", File: "main.gli",
+			Span: Span{Position{1, 3}, Position{1, 3}}, Message: "infix operator for 'int + string' not found"}},
+		errors.New("Runtime Error at [1,1]: divide by zero"),
+	}
+	expected := `[{"severity":"error","code":"type-error","file":"main.gli",` +
+		`"span":{"start":{"line":1,"col":3},"end":{"line":1,"col":3}},"message":"infix operator for 'int + string' not found"},` +
+		`{"severity":"error","span":{"start":{"line":0,"col":0},"end":{"line":0,"col":0}},"message":"Runtime Error at [1,1]: divide by zero"}]`
+
+	got, err := JSON(errs)
+	if err != nil {
+		t.Fatalf("JSON returned error: %v", err)
+	}
+	if string(got) != expected {
+		t.Errorf("wrong json.\nexpected=%s\ngot=%s", expected, got)
+	}
+
+	if got, _ := JSON(nil); string(got) != "[]" {
+		t.Errorf("expected an empty array, got=%s", got)
+	}
+}
@@ -3,6 +3,8 @@ package evaluator
 import (
 	"fmt"
 	"glimmer/object"
+	"sort"
+	"strings"
 )
 
 var builtins = map[string]*object.Builtin{
@@ -76,7 +78,7 @@ var builtins = map[string]*object.Builtin{
 		}
 		return &object.Array{Elements: arr.Elements[start:end]}
 	}},
-	"push": {Fn: func(args ...object.Object) object.Object {
+	"push": {Cost: pushCost, Fn: func(args ...object.Object) object.Object {
 		if err := enforceNumArgs(2, args...); err != nil {
 			return err
 		}
@@ -95,9 +97,12 @@ var builtins = map[string]*object.Builtin{
 		}
 		arr := args[0].(*object.Array)
 		length := len(arr.Elements)
+		if length == 0 {
+			return newError("can not pop from an empty array")
+		}
 		return &object.Array{Elements: arr.Elements[0 : length-1]}
 	}},
-	"range": {Fn: func(args ...object.Object) object.Object {
+	"range": {Cost: rangeCost, Fn: func(args ...object.Object) object.Object {
 		switch len(args) {
 		case 1:
 			return singleArgRange(args...) // (top-exclusive)
@@ -109,6 +114,408 @@ var builtins = map[string]*object.Builtin{
 			return newError("wrong number of arguments to range. got=%d, want=[1-3]", len(args))
 		}
 	}},
+	"throw": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("throw", args, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		return newError("%s", args[0].(*object.String).Value)
+	}},
+	"assert": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("assert", args, object.BOOLEAN_OBJ); typeErr != nil {
+			return typeErr
+		}
+		if !args[0].(*object.Boolean).Value {
+			return newError("assertion failed")
+		}
+		return NULL
+	}},
+	"assert_eq": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if !objectsEqual(args[0], args[1]) {
+			return newError("assertion failed: %s != %s", args[0].Inspect(), args[1].Inspect())
+		}
+		return NULL
+	}},
+	// string builtins count positions in bytes, like len
+	"split": {Cost: splitCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("split", args, object.STRING_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		parts := strings.Split(args[0].(*object.String).Value, args[1].(*object.String).Value)
+		return stringArray(parts)
+	}},
+	"join": {Cost: joinCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("join", args, object.ARRAY_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		parts := []string{}
+		for _, el := range args[0].(*object.Array).Elements {
+			str, ok := el.(*object.String)
+			if !ok {
+				return newError("argument 1 to `join` must hold strings, got=%s", el.Type())
+			}
+			parts = append(parts, str.Value)
+		}
+		return &object.String{Value: strings.Join(parts, args[1].(*object.String).Value)}
+	}},
+	"trim":        stringTransform("trim", strings.TrimSpace),
+	"upper":       stringTransform("upper", strings.ToUpper),
+	"lower":       stringTransform("lower", strings.ToLower),
+	"contains":    stringPredicate("contains", strings.Contains),
+	"starts_with": stringPredicate("starts_with", strings.HasPrefix),
+	"ends_with":   stringPredicate("ends_with", strings.HasSuffix),
+	"index_of": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("index_of", args, object.STRING_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		idx := strings.Index(args[0].(*object.String).Value, args[1].(*object.String).Value)
+		return &object.Integer{Value: int64(idx)}
+	}},
+	"replace": {Cost: replaceCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(3, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("replace", args, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		str, from, to := args[0].(*object.String).Value, args[1].(*object.String).Value, args[2].(*object.String).Value
+		return &object.String{Value: strings.ReplaceAll(str, from, to)}
+	}},
+	"substr": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(3, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("substr", args, object.STRING_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); typeErr != nil {
+			return typeErr
+		}
+		str := args[0].(*object.String).Value
+		start := int(args[1].(*object.Integer).Value)
+		end := int(args[2].(*object.Integer).Value)
+		length := len(str)
+
+		if start > end {
+			return newError("invalid substr index %d > %d", start, end)
+		}
+		if start < 0 || start > length {
+			return newError("start index %d out of range for string of length %d", start, length)
+		}
+		if end > length {
+			return newError("end index %d out of range for string of length %d", end, length)
+		}
+		return &object.String{Value: str[start:end]}
+	}},
+	"chars": {Cost: charsCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("chars", args, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		chars := []string{}
+		for _, ch := range args[0].(*object.String).Value {
+			chars = append(chars, string(ch))
+		}
+		return stringArray(chars)
+	}},
+	"format": {Cost: formatCost, Fn: func(args ...object.Object) object.Object {
+		if len(args) == 0 {
+			return newError("wrong number of arguments. got=0, want=1 or more")
+		}
+		if typeErr := enforceArgType("format", args, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		formatted, err := format(args[0].(*object.String).Value, args[1:])
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: formatted}
+	}},
+	// higher-order builtins, which call the functions they are passed
+	"map": {Cost: arrayCost, HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("map", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		mapped := &object.Array{Elements: []object.Object{}}
+		for _, el := range args[0].(*object.Array).Elements {
+			result := apply(args[1], el)
+			if isError(result) {
+				return result
+			}
+			mapped.Elements = append(mapped.Elements, result)
+		}
+		return mapped
+	}},
+	"filter": {Cost: arrayCost, HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("filter", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		kept := &object.Array{Elements: []object.Object{}}
+		for _, el := range args[0].(*object.Array).Elements {
+			result := apply(args[1], el)
+			if isError(result) {
+				return result
+			}
+			if isTruthy(result) {
+				kept.Elements = append(kept.Elements, el)
+			}
+		}
+		return kept
+	}},
+	"reduce": {HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(3, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("reduce", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		acc := args[2]
+		for _, el := range args[0].(*object.Array).Elements {
+			acc = apply(args[1], acc, el)
+			if isError(acc) {
+				return acc
+			}
+		}
+		return acc
+	}},
+	"any": {HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		idx, err := findIndex("any", apply, args)
+		if err != nil {
+			return err
+		}
+		return boolToBoolObj(idx != -1)
+	}},
+	"all": {HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		// all holds unless an element fails the predicate
+		negated := func(fn object.Object, args ...object.Object) object.Object {
+			result := apply(fn, args...)
+			if isError(result) {
+				return result
+			}
+			return boolToBoolObj(!isTruthy(result))
+		}
+		idx, err := findIndex("all", negated, args)
+		if err != nil {
+			return err
+		}
+		return boolToBoolObj(idx == -1)
+	}},
+	"find": {HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		idx, err := findIndex("find", apply, args)
+		if err != nil {
+			return err
+		}
+		return &object.Integer{Value: int64(idx)}
+	}},
+	"sort": {Cost: arrayCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("sort", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		elements := args[0].(*object.Array).Elements
+		return sortByKeys(elements, elements)
+	}},
+	"sort_by": {Cost: arrayCost, HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("sort_by", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		elements := args[0].(*object.Array).Elements
+		keys := make([]object.Object, len(elements))
+		for idx, el := range elements {
+			keys[idx] = apply(args[1], el)
+			if isError(keys[idx]) {
+				return keys[idx]
+			}
+		}
+		return sortByKeys(elements, keys)
+	}},
+	"zip": {Cost: zipCost, HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if len(args) != 2 && len(args) != 3 {
+			return newError("wrong number of arguments to zip. got=%d, want=[2-3]", len(args))
+		}
+		if typeErr := enforceArgType("zip", args, object.ARRAY_OBJ, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		left, right := args[0].(*object.Array).Elements, args[1].(*object.Array).Elements
+		zipped := &object.Array{Elements: []object.Object{}}
+		for idx := 0; idx < len(left) && idx < len(right); idx++ {
+			if len(args) == 2 {
+				zipped.Elements = append(zipped.Elements, &object.Array{Elements: []object.Object{left[idx], right[idx]}})
+				continue
+			}
+			result := apply(args[2], left[idx], right[idx])
+			if isError(result) {
+				return result
+			}
+			zipped.Elements = append(zipped.Elements, result)
+		}
+		return zipped
+	}},
+	"enumerate": {Cost: arrayCost, HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("enumerate", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		mapped := &object.Array{Elements: []object.Object{}}
+		for idx, el := range args[0].(*object.Array).Elements {
+			result := apply(args[1], &object.Integer{Value: int64(idx)}, el)
+			if isError(result) {
+				return result
+			}
+			mapped.Elements = append(mapped.Elements, result)
+		}
+		return mapped
+	}},
+	"flatten": {Cost: flattenCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("flatten", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		flat := &object.Array{Elements: []object.Object{}}
+		for _, el := range args[0].(*object.Array).Elements {
+			inner, ok := el.(*object.Array)
+			if !ok {
+				return newError("argument 1 to `flatten` must hold arrays, got=%s", el.Type())
+			}
+			flat.Elements = append(flat.Elements, inner.Elements...)
+		}
+		return flat
+	}},
+	"reverse": {Cost: arrayCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("reverse", args, object.ARRAY_OBJ); typeErr != nil {
+			return typeErr
+		}
+		elements := args[0].(*object.Array).Elements
+		reversed := &object.Array{Elements: make([]object.Object, len(elements))}
+		for idx, el := range elements {
+			reversed.Elements[len(elements)-1-idx] = el
+		}
+		return reversed
+	}},
+	"keys": {Cost: dictCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("keys", args, object.DICT_OBJ); typeErr != nil {
+			return typeErr
+		}
+		return stringArray(args[0].(*object.Dict).Keys())
+	}},
+	"values": {Cost: dictCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("values", args, object.DICT_OBJ); typeErr != nil {
+			return typeErr
+		}
+		dict := args[0].(*object.Dict)
+		vals := &object.Array{Elements: []object.Object{}}
+		for _, key := range dict.Keys() {
+			vals.Elements = append(vals.Elements, dict.Pairs[key])
+		}
+		return vals
+	}},
+	"items": {Cost: dictCost, HigherOrder: func(apply object.Applier, args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("items", args, object.DICT_OBJ); typeErr != nil {
+			return typeErr
+		}
+		dict := args[0].(*object.Dict)
+		mapped := &object.Array{Elements: []object.Object{}}
+		for _, key := range dict.Keys() {
+			result := apply(args[1], &object.String{Value: key}, dict.Pairs[key])
+			if isError(result) {
+				return result
+			}
+			mapped.Elements = append(mapped.Elements, result)
+		}
+		return mapped
+	}},
+	"has": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("has", args, object.DICT_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		_, ok := args[0].(*object.Dict).Pairs[args[1].(*object.String).Value]
+		return boolToBoolObj(ok)
+	}},
+	"get": {Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(3, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("get", args, object.DICT_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		if val, ok := args[0].(*object.Dict).Pairs[args[1].(*object.String).Value]; ok {
+			return val
+		}
+		return args[2]
+	}},
+	"delete": {Cost: dictCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("delete", args, object.DICT_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		deleted := args[0].(*object.Dict).Copy()
+		delete(deleted.Pairs, args[1].(*object.String).Value)
+		return deleted
+	}},
+	"merge": {Cost: mergeCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType("merge", args, object.DICT_OBJ, object.DICT_OBJ); typeErr != nil {
+			return typeErr
+		}
+		merged := args[0].(*object.Dict).Copy()
+		for key, val := range args[1].(*object.Dict).Pairs {
+			merged.Pairs[key] = val
+		}
+		return merged
+	}},
 }
 
 func enforceNumArgs(numArgs int, args ...object.Object) *object.Error {
@@ -162,9 +569,137 @@ func tripleArgRange(args ...object.Object) object.Object {
 	bot := args[0].(*object.Integer)
 	top := args[1].(*object.Integer)
 	step := args[2].(*object.Integer)
+	if step.Value <= 0 {
+		return newError("step of range must be positive, got=%d", step.Value)
+	}
 	rng := &object.Array{}
 	for i := int(bot.Value); i < int(top.Value); i += int(step.Value) {
 		rng.Elements = append(rng.Elements, &object.Integer{Value: int64(i)})
 	}
 	return rng
 }
+
+// stringTransform is a builtin mapping its string argument by fn
+func stringTransform(fnName string, fn func(string) string) *object.Builtin {
+	return &object.Builtin{Cost: stringCost, Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(1, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType(fnName, args, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		return &object.String{Value: fn(args[0].(*object.String).Value)}
+	}}
+}
+
+// stringPredicate is a builtin testing its two string arguments with fn
+func stringPredicate(fnName string, fn func(string, string) bool) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if err := enforceNumArgs(2, args...); err != nil {
+			return err
+		}
+		if typeErr := enforceArgType(fnName, args, object.STRING_OBJ, object.STRING_OBJ); typeErr != nil {
+			return typeErr
+		}
+		return boolToBoolObj(fn(args[0].(*object.String).Value, args[1].(*object.String).Value))
+	}}
+}
+
+func stringArray(strs []string) *object.Array {
+	arr := &object.Array{Elements: make([]object.Object, len(strs))}
+	for idx, str := range strs {
+		arr.Elements[idx] = &object.String{Value: str}
+	}
+	return arr
+}
+
+// format replaces each `{}` of layout with the next of args, as print shows it
+func format(layout string, args []object.Object) (string, *object.Error) {
+	pieces := strings.Split(layout, "{}")
+	if len(pieces)-1 != len(args) {
+		return "", newError("format string has %d placeholders, got %d arguments", len(pieces)-1, len(args))
+	}
+	var out strings.Builder
+	for idx, piece := range pieces {
+		out.WriteString(piece)
+		if idx < len(args) {
+			out.WriteString(args[idx].Inspect())
+		}
+	}
+	return out.String(), nil
+}
+
+// findIndex is the index of the first element of the array args[0] that the
+// predicate args[1] holds for, or -1 if there is none
+func findIndex(fnName string, apply object.Applier, args []object.Object) (int, *object.Error) {
+	if err := enforceNumArgs(2, args...); err != nil {
+		return 0, err
+	}
+	if typeErr := enforceArgType(fnName, args, object.ARRAY_OBJ); typeErr != nil {
+		return 0, typeErr
+	}
+	for idx, el := range args[0].(*object.Array).Elements {
+		result := apply(args[1], el)
+		if err, ok := result.(*object.Error); ok {
+			return 0, err
+		}
+		if isTruthy(result) {
+			return idx, nil
+		}
+	}
+	return -1, nil
+}
+
+// sortByKeys sorts elements by the key at the same index of keys, keeping the
+// order of elements with equal keys. Keys are ints, floats or strings.
+func sortByKeys(elements, keys []object.Object) object.Object {
+	order := make([]int, len(elements))
+	for idx := range order {
+		order[idx] = idx
+		if _, ok := compareKeys(keys[idx], keys[0]); !ok {
+			return newError("can not sort by %s", keys[idx].Type())
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		cmp, _ := compareKeys(keys[order[i]], keys[order[j]])
+		return cmp < 0
+	})
+
+	sorted := &object.Array{Elements: make([]object.Object, len(elements))}
+	for idx, from := range order {
+		sorted.Elements[idx] = elements[from]
+	}
+	return sorted
+}
+
+// compareKeys orders two ints, floats or strings, reporting false for
+// anything else
+func compareKeys(a, b object.Object) (int, bool) {
+	switch a := a.(type) {
+	case *object.Integer:
+		if b, ok := b.(*object.Integer); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1, true
+			case a.Value > b.Value:
+				return 1, true
+			}
+			return 0, true
+		}
+	case *object.Float:
+		if b, ok := b.(*object.Float); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1, true
+			case a.Value > b.Value:
+				return 1, true
+			}
+			return 0, true
+		}
+	case *object.String:
+		if b, ok := b.(*object.String); ok {
+			return strings.Compare(a.Value, b.Value), true
+		}
+	}
+	return 0, false
+}
@@ -15,6 +15,22 @@ var (
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if err := step(env); err != nil {
+		result = err
+	} else {
+		result = evalNode(node, env)
+	}
+
+	// the innermost node an error comes from is where it happened
+	if err, ok := result.(*object.Error); ok && err.Line == 0 {
+		tok := node.Pos()
+		err.Line, err.Col = tok.Line, tok.Col
+	}
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
@@ -27,6 +43,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.ReturnValue{Value: val}
 
 	case *ast.AssignStatement:
+		if node.Target != nil {
+			return evalTargetAssignStatement(node, env)
+		}
+
 		prevVal, ok := env.Get(node.Name.Value)
 
 		val := Eval(node.Value, env)
@@ -38,13 +58,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			if !ok {
 				return newError("identifier not found: %s", node.Name.Value)
 			}
-			val = evalInfixExpression(string(node.Type[0]), prevVal, val)
+			val = evalSandboxedInfixExpression(string(node.Type[0]), prevVal, val, env)
 		}
 
-		env.Set(node.Name.Value, val)
-		if fun, ok := val.(*object.Function); ok {
-			fun.Env.Set(node.Name.Value, val) // fn name goes in fn's environment, allows recursion
-		}
+		env.Assign(node.Name.Value, val)
 		return val
 
 	case *ast.IfStatement:
@@ -56,6 +73,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.WhileStatement:
 		return evalWhileStatement(node, env)
 
+	case *ast.StructStatement:
+		return NULL // struct types only matter to the typechecker
+
+	case *ast.EnumStatement:
+		env.Assign(node.Name.Value, EnumNamespace(node))
+		return NULL
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
+	case *ast.TestStatement:
+		return NULL // tests only run under the test runner
+
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 
@@ -65,6 +95,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	case *ast.BreakStatement:
 		return BREAK
 
@@ -79,6 +115,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
+		if node.Operator == "|" {
+			return Eval(node.PipeCall(), env)
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -87,7 +126,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalSandboxedInfixExpression(node.Operator, left, right, env)
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
@@ -98,24 +137,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if err := allocate(env, builtinAllocation(function, args)); err != nil {
+			return err
+		}
+		return evalCallExpression(node, function, args)
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if slice, ok := node.Index.(*ast.SliceIndex); ok {
+			return evalSlice(left, slice, env)
+		}
 		index := Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 
+	case *ast.FieldAccessExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalFieldAccessExpression(left, node.Field.Value)
+
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env.DeepCopy(), Body: body}
-		// deepcopy for static scoping, no copy = dynamic scoping
+		// closing over env itself shares its variables, so recursion needs no extra binding
+		return &object.Function{Parameters: params, Env: env, Body: body, Locals: node.Locals}
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
@@ -125,10 +177,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
+		if err := allocate(env, int64(len(elements))); err != nil {
+			return err
+		}
 		return &object.Array{Elements: elements}
 
 	case *ast.DictLiteral:
-		return evalDictLiteral(node, env)
+		dict := evalDictLiteral(node, env)
+		if dict, ok := dict.(*object.Dict); ok {
+			if err := allocate(env, int64(len(dict.Pairs))); err != nil {
+				return err
+			}
+		}
+		return dict
+
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
@@ -143,13 +207,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return boolToBoolObj(node.Value)
 	}
 
-	return nil
+	if node == nil {
+		return nil // the missing expression of a statement that failed to parse
+	}
+	return newError("can not evaluate %T", node)
 }
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	resolveLocals(program, env)
 	var result object.Object
 
 	for _, stmt := range program.Statements {
+		traceStatement(stmt, env)
 		result = Eval(stmt, env)
 
 		switch result := result.(type) {
@@ -44,6 +44,42 @@ func trueElifBranch_Stmt(ie *ast.IfStatement, env *object.Environment) (*ast.Blo
 	return nil, false
 }
 
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Body, env)
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Limit { // a program may not recover from exceeding its limits
+		return result
+	}
+
+	env.Assign(te.ErrorName.Value, &object.String{Value: errObj.Message})
+	return Eval(te.Handler, env)
+}
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	ev, ok := subject.(*object.EnumValue)
+	if !ok {
+		return newError("match subject must be an enum, got=%s", subject.Type())
+	}
+
+	for _, arm := range me.Arms {
+		if arm.Variant.Value != "_" && arm.Variant.Value != ev.Variant {
+			continue
+		}
+		for idx, binding := range arm.Bindings {
+			if binding.Value != "_" && idx < len(ev.Payload) {
+				env.Assign(binding.Value, ev.Payload[idx])
+			}
+		}
+		return Eval(arm.Body, env)
+	}
+
+	return newError("no match arm for %s", ev.Inspect())
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
@@ -82,6 +118,158 @@ func evalDictIndexExpression(dict, index object.Object) object.Object {
 	return val
 }
 
+// evalSetIndex returns a copy of container with val stored at index, adding
+// the key to a dict if it is missing
+func evalSetIndex(container, index, val object.Object) object.Object {
+	switch {
+	case container.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := container.(*object.Array).Elements
+		idx := index.(*object.Integer).Value
+		if idx < 0 || idx >= int64(len(elements)) {
+			return newError("Index %d out of range for array of length %d", idx, len(elements))
+		}
+		updated := &object.Array{Elements: make([]object.Object, len(elements))}
+		copy(updated.Elements, elements)
+		updated.Elements[idx] = val
+		return updated
+	case container.Type() == object.DICT_OBJ && index.Type() == object.STRING_OBJ:
+		updated := container.(*object.Dict).Copy()
+		updated.Pairs[index.(*object.String).Value] = val
+		return updated
+	default:
+		return newError("index assignment not supported: %s[%s]", container.Type(), index.Type())
+	}
+}
+
+func evalSlice(left object.Object, slice *ast.SliceIndex, env *object.Environment) object.Object {
+	bounds := []object.Object{NULL, NULL, NULL}
+	for idx, bound := range []ast.Expression{slice.Start, slice.End, slice.Step} {
+		if bound == nil {
+			continue
+		}
+		bounds[idx] = Eval(bound, env)
+		if isError(bounds[idx]) {
+			return bounds[idx]
+		}
+	}
+
+	sliced := evalSliceExpression(left, bounds[0], bounds[1], bounds[2])
+	if err := allocate(env, sliceAllocation(sliced)); err != nil {
+		return err
+	}
+	return sliced
+}
+
+// evalSliceExpression slices an array or string (by bytes, like len) from
+// start up to end by step, where a NULL bound is omitted. Negative bounds
+// count back from the end and out of range ones are clamped, as in Python.
+func evalSliceExpression(left, start, end, step object.Object) object.Object {
+	var length int64
+	switch left := left.(type) {
+	case *object.Array:
+		length = int64(len(left.Elements))
+	case *object.String:
+		length = int64(len(left.Value))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	by := int64(1)
+	if step != NULL {
+		num, ok := step.(*object.Integer)
+		if !ok {
+			return newError("slice bound is not of type INTEGER. got=%s", step.Type())
+		}
+		by = num.Value
+	}
+	if by == 0 {
+		return newError("slice step can not be zero")
+	}
+
+	from, to := int64(0), length
+	if by < 0 {
+		from, to = length-1, -1
+	}
+	from, err := sliceBound(start, from, length, by)
+	if err != nil {
+		return err
+	}
+	to, err = sliceBound(end, to, length, by)
+	if err != nil {
+		return err
+	}
+
+	positions := []int64{}
+	for idx := from; (by > 0 && idx < to) || (by < 0 && idx > to); idx += by {
+		positions = append(positions, idx)
+	}
+
+	if arr, ok := left.(*object.Array); ok {
+		sliced := &object.Array{Elements: make([]object.Object, len(positions))}
+		for i, idx := range positions {
+			sliced.Elements[i] = arr.Elements[idx]
+		}
+		return sliced
+	}
+	str := left.(*object.String).Value
+	sliced := make([]byte, len(positions))
+	for i, idx := range positions {
+		sliced[i] = str[idx]
+	}
+	return &object.String{Value: string(sliced)}
+}
+
+// sliceBound resolves a bound of a slice of length elements into a position,
+// which is def if the bound is omitted. A stepping back slice may stop at -1,
+// before the first element.
+func sliceBound(bound object.Object, def, length, step int64) (int64, *object.Error) {
+	if bound == NULL {
+		return def, nil
+	}
+	num, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bound is not of type INTEGER. got=%s", bound.Type())
+	}
+
+	idx := num.Value
+	if idx < 0 {
+		idx += length
+	}
+	lowest, highest := int64(0), length
+	if step < 0 {
+		lowest, highest = -1, length-1
+	}
+	if idx < lowest {
+		return lowest, nil
+	}
+	if idx > highest {
+		return highest, nil
+	}
+	return idx, nil
+}
+
+func evalFieldAccessExpression(left object.Object, field string) object.Object {
+	if mod, ok := left.(*object.Module); ok {
+		val, ok := mod.Env.Get(field)
+		if !ok {
+			return newError("module %s has no member %s", mod.Name, field)
+		}
+		return val
+	}
+
+	st, ok := left.(*object.Struct)
+	if !ok {
+		return newError("field access not supported: %s.%s", left.Type(), field)
+	}
+
+	val, ok := st.Fields[field]
+	if !ok {
+		return newError("struct %s has no field %s", st.Name, field)
+	}
+
+	return val
+}
+
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
@@ -95,6 +283,15 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
+	case operator == "in":
+		return evalInExpression(left, right)
+	case operator == "not in":
+		result := evalInExpression(left, right)
+		if isError(result) {
+			return result
+		}
+		return boolToBoolObj(result == FALSE)
+
 	// left and right are both integers
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
@@ -125,12 +322,40 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	case left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalStringIntInfixExpression(operator, left, right)
 
-	// TODO: Pipe
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// evalInExpression reports whether right holds left: an equal element of an
+// array, a key of a dict or a substring of a string
+func evalInExpression(left, right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Array:
+		for _, el := range right.Elements {
+			if objectsEqual(left, el) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.Dict:
+		key, ok := left.(*object.String)
+		if !ok {
+			return newError("key is not of type string. got=%s", left.Type())
+		}
+		_, ok = right.Pairs[key.Value]
+		return boolToBoolObj(ok)
+	case *object.String:
+		sub, ok := left.(*object.String)
+		if !ok {
+			return newError("unknown operator: %s in %s", left.Type(), right.Type())
+		}
+		return boolToBoolObj(strings.Contains(right.Value, sub.Value))
+	default:
+		return newError("unknown operator: %s in %s", left.Type(), right.Type())
+	}
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
@@ -294,6 +519,9 @@ func evalStringIntInfixExpression(operator string, left, right object.Object) ob
 
 	switch operator {
 	case "*":
+		if rightVal < 0 {
+			return newError("can not repeat a string %d times", rightVal)
+		}
 		return &object.String{Value: strings.Repeat(leftVal, int(rightVal))}
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
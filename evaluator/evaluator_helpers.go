@@ -129,6 +129,106 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+func evalCallExpression(node *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
+	if fun, ok := fn.(*object.Function); ok && fun.Env.Sandbox() != nil {
+		if err := fun.Env.Sandbox().Enter(); err != nil {
+			return err
+		}
+		defer fun.Env.Sandbox().Leave()
+	}
+	if fun, ok := fn.(*object.Function); ok && fun.Env.Tracer() != nil {
+		name := callName(node)
+		fun.Env.Tracer().Call(name, node.Pos())
+		defer fun.Env.Tracer().Return(name)
+	}
+
+	result := applyFunction(fn, args)
+
+	// an error from within a user function's body already has a position,
+	// the call is recorded as a frame of its traceback
+	if err, ok := result.(*object.Error); ok && err.Line != 0 {
+		if _, ok := fn.(*object.Function); ok {
+			tok := node.Pos()
+			err.Stack = append(err.Stack, object.CallFrame{Name: callName(node), Line: tok.Line, Col: tok.Col})
+		}
+	}
+
+	// a failed assertion names the expression that failed
+	if err, ok := result.(*object.Error); ok && isAssertion(fn) {
+		err.Message += " in " + node.String()
+	}
+	return result
+}
+
+func isAssertion(fn object.Object) bool {
+	return fn == builtins["assert"] || fn == builtins["assert_eq"]
+}
+
+// objectsEqual compares values structurally, as assert_eq does
+func objectsEqual(a, b object.Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *object.Array:
+		return elementsEqual(a.Elements, b.(*object.Array).Elements)
+	case *object.Dict:
+		return pairsEqual(a.Pairs, b.(*object.Dict).Pairs)
+	case *object.Struct:
+		b := b.(*object.Struct)
+		return a.Name == b.Name && pairsEqual(a.Fields, b.Fields)
+	case *object.EnumValue:
+		b := b.(*object.EnumValue)
+		return a.Enum == b.Enum && a.Variant == b.Variant && elementsEqual(a.Payload, b.Payload)
+	default:
+		return a == b || a.Inspect() == b.Inspect()
+	}
+}
+
+func elementsEqual(a, b []object.Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if !objectsEqual(a[idx], b[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func pairsEqual(a, b map[string]object.Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, val := range a {
+		other, ok := b[key]
+		if !ok || !objectsEqual(val, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// traceStatement tells the Environment's tracer, if any, that stmt is about to run
+func traceStatement(stmt ast.Statement, env *object.Environment) {
+	if tracer := env.Tracer(); tracer != nil {
+		tracer.Statement(stmt, env)
+	}
+}
+
+// callName names the function of a call for tracebacks
+func callName(node *ast.CallExpression) string {
+	switch fn := node.Function.(type) {
+	case *ast.Identifier:
+		return fn.Value
+	case *ast.FieldAccessExpression:
+		return fn.Left.String() + "." + fn.Field.Value
+	default:
+		return "anonymous function"
+	}
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
@@ -139,6 +239,9 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
+		if fn.HigherOrder != nil {
+			return fn.HigherOrder(callback, args...)
+		}
 		return fn.Fn(args...)
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -146,12 +249,27 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 
 }
 
+// callback applies a function passed to a higher-order builtin, counting it
+// against the call depth of its sandbox like any other call
+func callback(fn object.Object, args ...object.Object) object.Object {
+	if fun, ok := fn.(*object.Function); ok && fun.Env.Sandbox() != nil {
+		if err := fun.Env.Sandbox().Enter(); err != nil {
+			return err
+		}
+		defer fun.Env.Sandbox().Leave()
+	}
+	return applyFunction(fn, args)
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
 	}
+	for _, name := range fn.Locals {
+		env.Declare(name)
+	}
 
 	return env
 }
@@ -39,3 +39,17 @@ func evalDictLiteral(node *ast.DictLiteral, env *object.Environment) object.Obje
 	}
 	return &object.Dict{Pairs: pairs}
 }
+
+func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	st := &object.Struct{Name: node.Name.Value, Fields: make(map[string]object.Object)}
+
+	for idx, field := range node.FieldNames {
+		val := Eval(node.Values[idx], env)
+		if isError(val) {
+			return val
+		}
+		st.FieldNames = append(st.FieldNames, field.Value)
+		st.Fields[field.Value] = val
+	}
+	return st
+}
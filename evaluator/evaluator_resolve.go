@@ -0,0 +1,198 @@
+package evaluator
+
+import (
+	"glimmer/ast"
+	"glimmer/object"
+)
+
+// resolveLocals sets the Locals of every function literal in program before
+// it runs: the names its body binds that no scope it is written in has bound
+// before it. That is decided where the function is written, as the compiler's
+// symbol table and the typechecker do, and not from what env holds whenever
+// the literal is evaluated. Tests are resolved after the other statements,
+// which run before them, and the names the top level binds are declared in env.
+func resolveLocals(program *ast.Program, env *object.Environment) {
+	r := &resolver{env: env, scopes: []*scope{newScope()}}
+	tests := []*ast.TestStatement{}
+	for _, stmt := range program.Statements {
+		if test, ok := stmt.(*ast.TestStatement); ok {
+			tests = append(tests, test)
+			continue
+		}
+		r.statement(stmt)
+	}
+	for _, test := range tests {
+		r.scopes = append(r.scopes, newScope())
+		r.block(test.Body)
+		r.scopes = r.scopes[:len(r.scopes)-1]
+	}
+
+	// a function assigning a name the top level binds, even in a branch not
+	// yet taken, assigns the top level's
+	for _, name := range r.scopes[0].assigned {
+		env.Declare(name)
+	}
+}
+
+// resolver walks a program in source order, tracking the names each
+// enclosing scope has bound so far. The top level's scope also holds the
+// names env had before the program.
+type resolver struct {
+	env    *object.Environment
+	scopes []*scope // innermost last
+}
+
+// scope is the names a function, test or the top level has bound so far
+type scope struct {
+	names    map[string]bool
+	assigned []string // the names bound by assignment rather than as parameters, in order
+}
+
+func newScope() *scope {
+	return &scope{names: map[string]bool{}}
+}
+
+func (r *resolver) bound(name string) bool {
+	for _, scope := range r.scopes {
+		if scope.names[name] {
+			return true
+		}
+	}
+	_, ok := r.env.Get(name)
+	return ok
+}
+
+// bind binds name in the innermost scope, unless a scope already has it, in
+// which case assigning it updates that scope
+func (r *resolver) bind(name string) {
+	if !r.bound(name) {
+		inner := r.scopes[len(r.scopes)-1]
+		inner.names[name] = true
+		inner.assigned = append(inner.assigned, name)
+	}
+}
+
+func (r *resolver) block(block *ast.BlockStatement) {
+	if block != nil {
+		r.statements(block.Statements)
+	}
+}
+
+func (r *resolver) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.AssignStatement:
+		if stmt.Target != nil {
+			r.expression(stmt.Target)
+			r.expression(stmt.Value)
+			return
+		}
+		// a function is bound before its body, so it can capture itself to recurse
+		if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			r.bind(stmt.Name.Value)
+			r.expression(stmt.Value)
+			return
+		}
+		r.expression(stmt.Value)
+		r.bind(stmt.Name.Value)
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue)
+	case *ast.BlockStatement:
+		r.block(stmt)
+	case *ast.IfStatement:
+		r.conditional(stmt.Condition, stmt.TrueBranch, stmt.ElifConditions, stmt.ElifBranches, stmt.FalseBranch)
+	case *ast.WhileStatement:
+		r.statements(stmt.Condition)
+		r.block(stmt.Body)
+	case *ast.ForStatement:
+		r.expression(stmt.Collection)
+		for _, lv := range stmt.LoopVars {
+			r.bind(lv.Value)
+		}
+		r.block(stmt.Body)
+	case *ast.ImportStatement:
+		r.bind(stmt.Alias.Value)
+	case *ast.EnumStatement:
+		r.bind(stmt.Name.Value)
+	}
+}
+
+func (r *resolver) conditional(cond []ast.Statement, branch *ast.BlockStatement,
+	elifConds [][]ast.Statement, elifBranches []*ast.BlockStatement, elseBranch *ast.BlockStatement) {
+	r.statements(cond)
+	r.block(branch)
+	for idx, elif := range elifBranches {
+		r.statements(elifConds[idx])
+		r.block(elif)
+	}
+	r.block(elseBranch)
+}
+
+func (r *resolver) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.FunctionLiteral:
+		fnScope := newScope()
+		for _, param := range exp.Parameters {
+			fnScope.names[param.Value] = true
+		}
+		r.scopes = append(r.scopes, fnScope)
+		r.block(exp.Body)
+		r.scopes = r.scopes[:len(r.scopes)-1]
+		exp.Locals = fnScope.assigned
+	case *ast.IfExpression:
+		r.conditional(exp.Condition, exp.TrueBranch, exp.ElifConditions, exp.ElifBranches, exp.FalseBranch)
+	case *ast.TryExpression:
+		r.block(exp.Body)
+		r.bind(exp.ErrorName.Value)
+		r.block(exp.Handler)
+	case *ast.MatchExpression:
+		r.expression(exp.Subject)
+		for _, arm := range exp.Arms {
+			for _, binding := range arm.Bindings {
+				if binding.Value != "_" {
+					r.bind(binding.Value)
+				}
+			}
+			r.block(arm.Body)
+		}
+	case *ast.CallExpression:
+		r.expression(exp.Function)
+		for _, arg := range exp.Arguments {
+			r.expression(arg)
+		}
+	case *ast.InfixExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Right)
+	case *ast.PrefixExpression:
+		r.expression(exp.Right)
+	case *ast.IndexExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Index)
+	case *ast.SliceIndex:
+		r.expression(exp.Start)
+		r.expression(exp.End)
+		r.expression(exp.Step)
+	case *ast.FieldAccessExpression:
+		r.expression(exp.Left)
+	case *ast.ArrayLiteral:
+		for _, elem := range exp.Elements {
+			r.expression(elem)
+		}
+	case *ast.DictLiteral:
+		for _, key := range exp.Keys {
+			r.expression(key)
+			r.expression(exp.Pairs[key])
+		}
+	case *ast.StructLiteral:
+		for _, val := range exp.Values {
+			r.expression(val)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package evaluator
+
+import (
+	"glimmer/object"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// The functions below charge the work of an evaluation to the sandbox of its
+// Environment, if it has one, returning the error of a limit it exceeds.
+
+func step(env *object.Environment) *object.Error {
+	if sandbox := env.Sandbox(); sandbox != nil {
+		return sandbox.Step()
+	}
+	return nil
+}
+
+func allocate(env *object.Environment, n int64) *object.Error {
+	if sandbox := env.Sandbox(); sandbox != nil && n > 0 {
+		return sandbox.Alloc(n)
+	}
+	return nil
+}
+
+// evalSandboxedInfixExpression charges the string an infix operator builds
+// before building it, as `"a" * n` is only bounded by n
+func evalSandboxedInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
+	if err := allocate(env, infixAllocation(operator, left, right)); err != nil {
+		return err
+	}
+	return evalInfixExpression(operator, left, right)
+}
+
+func infixAllocation(operator string, left, right object.Object) int64 {
+	leftStr, ok := left.(*object.String)
+	if !ok {
+		return 0
+	}
+	switch right := right.(type) {
+	case *object.String:
+		if operator == "+" {
+			return int64(len(leftStr.Value) + len(right.Value))
+		}
+	case *object.Integer:
+		if operator == "*" && right.Value > 0 && len(leftStr.Value) > 0 {
+			if right.Value > math.MaxInt64/int64(len(leftStr.Value)) {
+				return math.MaxInt64
+			}
+			return int64(len(leftStr.Value)) * right.Value
+		}
+	}
+	return 0
+}
+
+// setIndexAllocation is the number of elements copied to assign to an index
+// of container, one more than it holds for a dict that may gain a key
+func setIndexAllocation(container object.Object) int64 {
+	switch container := container.(type) {
+	case *object.Array:
+		return int64(len(container.Elements))
+	case *object.Dict:
+		return int64(len(container.Pairs)) + 1
+	}
+	return 0
+}
+
+// sliceAllocation is the number of elements, or bytes of a string, a slice
+// copied
+func sliceAllocation(sliced object.Object) int64 {
+	switch sliced := sliced.(type) {
+	case *object.Array:
+		return int64(len(sliced.Elements))
+	case *object.String:
+		return int64(len(sliced.Value))
+	}
+	return 0
+}
+
+// builtinAllocation is the Cost of a call to a builtin, none for anything else
+func builtinAllocation(fn object.Object, args []object.Object) int64 {
+	if builtin, ok := fn.(*object.Builtin); ok && builtin.Cost != nil {
+		return builtin.Cost(args...)
+	}
+	return 0
+}
+
+// The functions below are the Costs of the builtins: the elements, or bytes
+// of a string, each allocates for its result, known before the call as
+// range's is only bounded by its arguments.
+
+func rangeCost(args ...object.Object) int64 {
+	bounds := []int64{0, 0, 1} // bottom, top, step
+	for idx, arg := range args {
+		num, ok := arg.(*object.Integer)
+		if !ok || idx > 2 {
+			return 0
+		}
+		bounds[idx] = num.Value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	if bounds[2] <= 0 || bounds[1] <= bounds[0] {
+		return 0
+	}
+	return (bounds[1] - bounds[0] + bounds[2] - 1) / bounds[2]
+}
+
+func pushCost(args ...object.Object) int64 {
+	if len(args) > 0 {
+		if arr, ok := args[0].(*object.Array); ok {
+			return int64(len(arr.Elements)) + 1
+		}
+	}
+	return 0
+}
+
+func splitCost(args ...object.Object) int64 {
+	str, sep := stringArg(args, 0), stringArg(args, 1)
+	if sep == "" {
+		return int64(utf8.RuneCountInString(str))
+	}
+	return int64(strings.Count(str, sep)) + 1
+}
+
+func charsCost(args ...object.Object) int64 {
+	return int64(utf8.RuneCountInString(stringArg(args, 0)))
+}
+
+// stringCost is that of a builtin transforming a string into one no longer
+func stringCost(args ...object.Object) int64 {
+	return int64(len(stringArg(args, 0)))
+}
+
+func replaceCost(args ...object.Object) int64 {
+	str, from, to := stringArg(args, 0), stringArg(args, 1), stringArg(args, 2)
+	return int64(len(str)) + int64(strings.Count(str, from))*int64(len(to)-len(from))
+}
+
+func joinCost(args ...object.Object) int64 {
+	elements := arrayArg(args, 0)
+	total := int64(len(elements)) * int64(len(stringArg(args, 1)))
+	for _, el := range elements {
+		if str, ok := el.(*object.String); ok {
+			total += int64(len(str.Value))
+		}
+	}
+	return total
+}
+
+// arrayCost is that of a builtin building an array as long as its first argument
+func arrayCost(args ...object.Object) int64 {
+	return int64(len(arrayArg(args, 0)))
+}
+
+func zipCost(args ...object.Object) int64 {
+	pairs := len(arrayArg(args, 0))
+	if other := len(arrayArg(args, 1)); other < pairs {
+		pairs = other
+	}
+	if len(args) == 2 {
+		return int64(pairs) * 3 // a two element array for each pair
+	}
+	return int64(pairs)
+}
+
+func flattenCost(args ...object.Object) int64 {
+	total := int64(0)
+	for _, el := range arrayArg(args, 0) {
+		if inner, ok := el.(*object.Array); ok {
+			total += int64(len(inner.Elements))
+		}
+	}
+	return total
+}
+
+// dictCost is that of a builtin building a dict or array as long as its first argument
+func dictCost(args ...object.Object) int64 {
+	return int64(len(dictArg(args, 0)))
+}
+
+func mergeCost(args ...object.Object) int64 {
+	return int64(len(dictArg(args, 0)) + len(dictArg(args, 1)))
+}
+
+func formatCost(args ...object.Object) int64 {
+	total := int64(0)
+	for idx := range args {
+		total += int64(len(stringArg(args, idx)))
+	}
+	return total
+}
+
+// arrayArg is the elements of the array argument at idx, or nil if there is none
+func arrayArg(args []object.Object, idx int) []object.Object {
+	if idx < len(args) {
+		if arr, ok := args[idx].(*object.Array); ok {
+			return arr.Elements
+		}
+	}
+	return nil
+}
+
+// dictArg is the pairs of the dict argument at idx, or nil if there is none
+func dictArg(args []object.Object, idx int) map[string]object.Object {
+	if idx < len(args) {
+		if dict, ok := args[idx].(*object.Dict); ok {
+			return dict.Pairs
+		}
+	}
+	return nil
+}
+
+// stringArg is the value of the string argument at idx, or "" if there is none
+func stringArg(args []object.Object, idx int) string {
+	if idx < len(args) {
+		if str, ok := args[idx].(*object.String); ok {
+			return str.Value
+		}
+	}
+	return ""
+}
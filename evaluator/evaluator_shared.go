@@ -0,0 +1,74 @@
+package evaluator
+
+import (
+	"glimmer/ast"
+	"glimmer/object"
+)
+
+// The functions below expose the evaluator's object-level semantics so that
+// other backends (i.e. the vm) behave identically to the tree-walker.
+
+func ApplyInfixOperator(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func ApplyPrefixOperator(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func ApplyIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// ApplySetIndex returns a copy of container with val stored at index
+func ApplySetIndex(container, index, val object.Object) object.Object {
+	return evalSetIndex(container, index, val)
+}
+
+// ApplySlice slices left by the bounds of a slice expression, which are NULL
+// where they are omitted
+func ApplySlice(left, start, end, step object.Object) object.Object {
+	return evalSliceExpression(left, start, end, step)
+}
+
+func ApplyFieldAccess(left object.Object, field string) object.Object {
+	return evalFieldAccessExpression(left, field)
+}
+
+// ApplyFunction calls a tree-walked function (or builtin) with args
+func ApplyFunction(fn object.Object, args []object.Object) object.Object {
+	return applyFunction(fn, args)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+func BoolToBoolObj(input bool) *object.Boolean {
+	return boolToBoolObj(input)
+}
+
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// EnumNamespace is what an enum declaration binds its name to: a namespace of
+// constructors for its variants, where a variant without a payload is a value
+func EnumNamespace(node *ast.EnumStatement) *object.Module {
+	env := object.NewEnvironment()
+	for idx, variant := range node.Variants {
+		enum, name, arity := node.Name.Value, variant.Value, len(node.Payloads[idx])
+		if arity == 0 {
+			env.Set(name, &object.EnumValue{Enum: enum, Variant: name})
+			continue
+		}
+		env.Set(name, &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != arity {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), arity)
+			}
+			return &object.EnumValue{Enum: enum, Variant: name, Payload: args}
+		}})
+	}
+	return &object.Module{Name: node.Name.Value, Env: env}
+}
@@ -13,17 +13,17 @@ func evalIfStatement(is *ast.IfStatement, env *object.Environment) object.Object
 
 	if isTruthy(condition) {
 		tr := Eval(is.TrueBranch, env)
-		if isError(tr) || tr.Type() == object.RETURN_VALUE_OBJ {
+		if isControlFlow(tr) {
 			return tr
 		}
 	} else if branch, ok := trueElifBranch_Stmt(is, env); ok {
 		elif := Eval(branch, env)
-		if isError(elif) || elif.Type() == object.RETURN_VALUE_OBJ {
+		if isControlFlow(elif) {
 			return elif
 		}
 	} else if is.FalseBranch != nil {
 		els := Eval(is.FalseBranch, env)
-		if isError(els) || els.Type() == object.RETURN_VALUE_OBJ {
+		if isControlFlow(els) {
 			return els
 		}
 	}
@@ -44,32 +44,38 @@ func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Obje
 func evalForArrayStatement(lvs []*ast.Identifier, arr *object.Array, body *ast.BlockStatement, env *object.Environment) object.Object {
 	elemIdx := len(lvs) - 1
 	for index, element := range arr.Elements {
-		env.Set(lvs[elemIdx].Value, element)
+		env.Assign(lvs[elemIdx].Value, element)
 
 		if len(lvs) > 1 { // len==2
-			env.Set(lvs[0].Value, &object.Integer{Value: int64(index)})
+			env.Assign(lvs[0].Value, &object.Integer{Value: int64(index)})
 		}
 
 		evaledBody := Eval(body, env)
-		if isError(evaledBody) || evaledBody.Type() == object.RETURN_VALUE_OBJ {
+		if exitsLoop(evaledBody) {
 			return evaledBody
 		}
+		if evaledBody == BREAK {
+			break
+		}
 	}
 	return NULL
 }
 
 func evalForDictStatement(lvs []*ast.Identifier, dict *object.Dict, body *ast.BlockStatement, env *object.Environment) object.Object {
-	for key, value := range dict.Pairs {
-		env.Set(lvs[0].Value, &object.String{Value: key})
+	for _, key := range dict.Keys() {
+		env.Assign(lvs[0].Value, &object.String{Value: key})
 
 		if len(lvs) > 1 { // len==2
-			env.Set(lvs[1].Value, value)
+			env.Assign(lvs[1].Value, dict.Pairs[key])
 		}
 
 		evaledBody := Eval(body, env)
-		if isError(evaledBody) || evaledBody.Type() == object.RETURN_VALUE_OBJ {
+		if exitsLoop(evaledBody) {
 			return evaledBody
 		}
+		if evaledBody == BREAK {
+			break
+		}
 	}
 	return NULL
 }
@@ -82,10 +88,12 @@ func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.
 
 	for isTruthy(condition) {
 		loop := Eval(ws.Body, env)
-		if isError(loop) || loop.Type() == object.RETURN_VALUE_OBJ ||
-			loop.Type() == object.BREAK_OBJ || loop.Type() == object.CONT_OBJ {
+		if exitsLoop(loop) {
 			return loop
 		}
+		if loop == BREAK {
+			break
+		}
 		condition = evalStatements(ws.Condition, env)
 		if isError(condition) {
 			return condition
@@ -98,19 +106,37 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	var result object.Object
 
 	for _, stmt := range block.Statements {
+		traceStatement(stmt, env)
 		result = Eval(stmt, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if isControlFlow(result) {
+			return result
 		}
 	}
 
 	return result
 }
 
+// isControlFlow reports whether obj must stop the enclosing block: a return,
+// an error, or a break/continue headed for the enclosing loop
+func isControlFlow(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONT_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitsLoop reports whether the result of a loop's body, nil for an empty
+// body, is a return or an error that ends the loop's enclosing block
+func exitsLoop(obj object.Object) bool {
+	return obj != nil && (obj.Type() == object.RETURN_VALUE_OBJ || obj.Type() == object.ERROR_OBJ)
+}
+
 func evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object = NULL
 
@@ -127,3 +153,80 @@ func evalStatements(stmts []ast.Statement, env *object.Environment) object.Objec
 
 	return result
 }
+
+func evalTargetAssignStatement(node *ast.AssignStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	if node.Type != "=" {
+		prevVal := Eval(node.Target, env)
+		if isError(prevVal) {
+			return prevVal
+		}
+		val = evalSandboxedInfixExpression(string(node.Type[0]), prevVal, val, env)
+		if isError(val) {
+			return val
+		}
+	}
+
+	if err := assignToTarget(node.Target, val, env); err != nil {
+		return err
+	}
+	return val
+}
+
+// assignToTarget stores val at target by copying each container on the path
+// from the root identifier, so other references to the old value are unaffected
+func assignToTarget(target ast.Expression, val object.Object, env *object.Environment) object.Object {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		env.Assign(target.Value, val)
+		return nil
+	case *ast.FieldAccessExpression:
+		container := Eval(target.Left, env)
+		if isError(container) {
+			return container
+		}
+		st, ok := container.(*object.Struct)
+		if !ok {
+			return newError("field assignment not supported: %s.%s", container.Type(), target.Field.Value)
+		}
+		if _, ok := st.Fields[target.Field.Value]; !ok {
+			return newError("struct %s has no field %s", st.Name, target.Field.Value)
+		}
+		updated := st.Copy()
+		updated.Fields[target.Field.Value] = val
+		return assignToTarget(target.Left, updated, env)
+	case *ast.IndexExpression:
+		container := Eval(target.Left, env)
+		if isError(container) {
+			return container
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		if err := allocate(env, setIndexAllocation(container)); err != nil {
+			return err
+		}
+		updated := evalSetIndex(container, index, val)
+		if isError(updated) {
+			return updated
+		}
+		return assignToTarget(target.Left, updated, env)
+	default:
+		return newError("invalid assignment target: %s", target.String())
+	}
+}
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	modEnv, err := env.Import(node.Path.Value)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	env.Assign(node.Alias.Value, &object.Module{Name: node.Alias.Value, Env: modEnv})
+	return NULL
+}
@@ -1,12 +1,14 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"glimmer/lexer"
 	"glimmer/object"
 	"glimmer/parser"
 	"glimmer/typechecker"
 	"glimmer/types"
+	"strings"
 	"testing"
 )
 
@@ -172,6 +174,16 @@ func TestBuiltinFunctions(t *testing.T) {
 		{"range(5)[4]", 4},
 		{"range(1, 5)[3]", 4},
 		{"range(1, 5, 2)[1]", 3},
+		{"range(1, 5, 0)", "step of range must be positive, got=0"},
+		{"len(pop([1, 2]))", 1},
+		{"pop([]int)", "can not pop from an empty array"},
+		{`"ab" * -1`, "can not repeat a string -1 times"},
+		{"f = fn(n: int) -> int { f(n + 1) }; f(0)", "stack overflow: calls nested over 10000 deep"},
+		{"assert(1 > 2)", "assertion failed in assert((1 > 2))"},
+		{"assert_eq(1 + 1, 3)", "assertion failed: 2 != 3 in assert_eq((1 + 1), 3)"},
+		{`assert_eq({"a": [1, 2]}, {"a": [1, 2]}); 1`, 1},
+		{`assert_eq({"a": [1, 2]}, {"a": [2, 1]})`, `assertion failed: {a: [1, 2]} != {a: [2, 1]} in assert_eq({a:[1, 2]}, {a:[2, 1]})`},
+		{`test "only under the runner" { throw("ran") }; 2`, 2},
 	}
 
 	for _, tt := range tests {
@@ -193,26 +205,210 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
-func TestClosures(t *testing.T) {
-	input := `
-	newAdder = fn(x: int) -> fn(int) -> int {
-		fn(y: int) -> int { x + y };
-	};
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("ab", "")`, "[a, b]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join([]string, ",")`, ""},
+		{`trim("  a b  ")`, "a b"},
+		{`upper("aBc")`, "ABC"},
+		{`lower("aBc")`, "abc"},
+		{`contains("glimmer", "mm")`, "true"},
+		{`starts_with("glimmer", "gl")`, "true"},
+		{`ends_with("glimmer", "gl")`, "false"},
+		{`index_of("glimmer", "m")`, "3"},
+		{`index_of("glimmer", "z")`, "-1"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`substr("glimmer", 1, 4)`, "lim"},
+		{`substr("glimmer", 7, 7)`, ""},
+		{`chars("héllo")`, "[h, é, l, l, o]"},
+		{`format("{} + {} = {}", 1, 2.5, [3])`, "1 + 2.5 = [3]"},
+		{`"a,b" | split(",") | join(";")`, "a;b"},
+		{`substr("abc", 2, 1)`, "ERROR: invalid substr index 2 > 1"},
+		{`substr("abc", -1, 1)`, "ERROR: start index -1 out of range for string of length 3"},
+		{`substr("abc", 1, 4)`, "ERROR: end index 4 out of range for string of length 3"},
+		{`fmt = "{}"; format(fmt)`, "ERROR: format string has 1 placeholders, got 0 arguments"},
+	}
 
-	addTwo = newAdder(2);
-	addTwo(2);`
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x: int) -> int { x * x })`, "[1, 4, 9]"},
+		{`map([]int, fn(x: int) -> string { "a" })`, "[]"},
+		{`filter(range(6), fn(x: int) -> bool { x / 2 * 2 == x })`, "[0, 2, 4]"},
+		{`reduce([1, 2, 3], fn(acc: int, x: int) -> int { acc * 10 + x }, 0)`, "123"},
+		{`reduce([]string, fn(acc: int, s: string) -> int { acc + 1 }, 7)`, "7"},
+		{`any([1, 2], fn(x: int) -> bool { x > 1 })`, "true"},
+		{`any([]int, fn(x: int) -> bool { true })`, "false"},
+		{`all([1, 2], fn(x: int) -> bool { x > 1 })`, "false"},
+		{`all([]int, fn(x: int) -> bool { false })`, "true"},
+		{`find(["a", "b", "b"], fn(s: string) -> bool { s == "b" })`, "1"},
+		{`find([1], fn(x: int) -> bool { x > 1 })`, "-1"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort_by([[2, 1], [1], [3, 1, 1]], fn(p: array[int]) -> int { len(p) })`, "[[1], [2, 1], [3, 1, 1]]"},
+		{`sort_by(["bb", "a", "cc", "d"], fn(s: string) -> int { len(chars(s)) })`, "[a, d, bb, cc]"},
+		{`zip([1, 2, 3], [4, 5])`, "[[1, 4], [2, 5]]"},
+		{`zip([1, 2], ["a", "b"], fn(x: int, s: string) -> string { s * x })`, "[a, bb]"},
+		{`enumerate(["a", "b"], fn(i: int, s: string) -> string { format("{}:{}", i, s) })`, "[0:a, 1:b]"},
+		{`flatten([[1], []int, [2, 3]])`, "[1, 2, 3]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`xs = [3, 1, 2]; sort(xs); xs`, "[3, 1, 2]"},
+		{`[1, 2, 3] | map(fn(x: int) -> int { x + 1 }) | reverse`, "[4, 3, 2]"},
+		{`map([1, 0], fn(x: int) -> int { 10 / x })`, "ERROR: divide by zero"},
+		{`try { map([1], fn(x: int) -> int { throw("bad"); x }); "ok" } catch e { e }`, "bad"},
+	}
 
-	testLiteralObject(t, testEval(input), 4)
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
 }
 
-func TestStaticScoping(t *testing.T) {
-	input := `
-	n = 5;
-	addN = fn(x: int) -> int { x + n };
-	n = 6;
-	addN(5);`
+func TestDicts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`d = {}int; d["b"] = 2; d["a"] = 1; d`, "{a: 1, b: 2}"},
+		{`d = {"a": 1}; d["a"] += 4; d["a"] *= 2; d["a"]`, "10"},
+		{`d = {"a": 1}; e = d; e["a"] = 2; d["a"] * 10 + e["a"]`, "12"},
+		{`m = {"in": {"x": 1}}; m["in"]["y"] = 2; m`, "{in: {x: 1, y: 2}}"},
+		{`struct P { x: int }; d = {"p": P{x: 1}}; d["p"].x = 5; d`, "{p: P{x: 5}}"},
+		{`d = {"a": 1}; d["b"] += 1`, "ERROR: key `b` not found in dict"},
+		{`keys({"b": 1, "a": 2, "c": 3})`, "[a, b, c]"},
+		{`values({"b": 1, "a": 2, "c": 3})`, "[2, 1, 3]"},
+		{`items({"a": 1, "b": 2}, fn(k: string, v: int) -> string { format("{}={}", k, v) })`, "[a=1, b=2]"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`get({"a": 1}, "a", 0) + get({"a": 1}, "b", 10)`, "11"},
+		{`d = {"a": 1, "b": 2}; [delete(d, "a"), delete(d, "z"), d]`, "[{b: 2}, {a: 1, b: 2}, {a: 1, b: 2}]"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1, b: 3, c: 4}"},
+		{`s = ""; for k, v in {"c": 1, "a": 2, "b": 3} { s += k } s`, "abc"},
+	}
 
-	testLiteralObject(t, testEval(input), 10)
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIndexAssignmentAndSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = [1, 2, 3]; a[0] = 7; a[2] += 1; a", "[7, 2, 4]"},
+		{"a = [1, 2]; b = a; a[0] = 5; [a, b]", "[[5, 2], [1, 2]]"},
+		{`m = {"k": [1, 2]}; m["k"][1] *= 10; m`, "{k: [1, 20]}"},
+		{"g = [[1, 2], [3, 4]]; g[1][0] = 0; g", "[[1, 2], [0, 4]]"},
+		{"a = [1]; a[1] = 2", "ERROR: Index 1 out of range for array of length 1"},
+		{"a = [1]; a[-1] = 2", "ERROR: Index -1 out of range for array of length 1"},
+		{"a = [0, 1, 2, 3, 4]; a[1:3]", "[1, 2]"},
+		{"a = [0, 1, 2, 3, 4]; a[:2]", "[0, 1]"},
+		{"a = [0, 1, 2, 3, 4]; a[3:]", "[3, 4]"},
+		{"a = [0, 1, 2, 3, 4]; a[:]", "[0, 1, 2, 3, 4]"},
+		{"a = [0, 1, 2, 3, 4]; a[-2:]", "[3, 4]"},
+		{"a = [0, 1, 2, 3, 4]; a[:-1]", "[0, 1, 2, 3]"},
+		{"a = [0, 1, 2, 3, 4]; a[::2]", "[0, 2, 4]"},
+		{"a = [0, 1, 2, 3, 4]; a[::-1]", "[4, 3, 2, 1, 0]"},
+		{"a = [0, 1, 2, 3, 4]; a[3:0:-1]", "[3, 2, 1]"},
+		{"a = [0, 1, 2, 3, 4]; a[-1:-4:-2]", "[4, 2]"},
+		{"a = [0, 1, 2, 3, 4]; a[-10:10]", "[0, 1, 2, 3, 4]"},
+		{"a = [0, 1, 2, 3, 4]; a[4:1]", "[]"},
+		{`"glimmer"[1:4]`, "lim"},
+		{`"glimmer"[-3:]`, "mer"},
+		{`"glimmer"[::-2]`, "rmig"},
+		{"[1, 2][::0]", "ERROR: slice step can not be zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMembership(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 in [1, 2, 3]", "true"},
+		{"4 in [1, 2, 3]", "false"},
+		{"4 not in [1, 2, 3]", "true"},
+		{"1 in []int", "false"},
+		{`[1, 2] in [[1], [1, 2]]`, "true"},
+		{`"b" in ["a", "b"]`, "true"},
+		{`"a" in {"a": 1}`, "true"},
+		{`"b" in {"a": 1}`, "false"},
+		{`"b" not in {"a": 1}`, "true"},
+		{`"imm" in "glimmer"`, "true"},
+		{`"" in "glimmer"`, "true"},
+		{`"x" not in "glimmer"`, "true"},
+		{"xs = [1, 2]; n = 0; for x in range(4) { if x in xs { n += 1 } } n", "2"},
+		{"1 + 1 in [2] == true", "true"},
+		{"not = 3; not not in [1, 2]", "true"},
+		{"xs = [1]; for not in xs { not } not", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`newAdder = fn(x: int) -> fn(int) -> int { fn(y: int) -> int { x + y } }; addTwo = newAdder(2); addTwo(2)`, 4},
+		{`n = 5; addN = fn(x: int) -> int { x + n }; n = 6; addN(5)`, 11},
+		{`counter = 0; inc = fn() -> int { counter += 1; counter }; inc(); inc(); counter`, 2},
+		{`makeCounter = fn() -> fn() -> int {
+			count = 0
+			fn() -> int { count += 1; count }
+		}
+		c1 = makeCounter(); c2 = makeCounter()
+		c1(); c1(); c2()
+		c1() * 10 + c2()`, 32},
+		{`makeAcc = fn(total: int) -> fn(int) -> int { fn(x: int) -> int { total = total + x; total } }
+		acc = makeAcc(10); acc(5); acc(5)`, 20},
+		{`f = fn() -> int { local = 3; local }; f(); local = "outer"; local`, "outer"},
+		{`outer = fn() -> int {
+			n = 1
+			bump = fn() -> none { n = n + 1 }
+			bump(); bump()
+			n
+		}
+		outer()`, 3},
+	}
+
+	for _, tt := range tests {
+		testLiteralObject(t, testEval(tt.input), tt.expected)
+	}
 }
 
 func TestRecursion(t *testing.T) {
@@ -231,6 +427,41 @@ func TestRecursion(t *testing.T) {
 	testLiteralObject(t, testEval(input), 5)
 }
 
+func TestPipeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"inc = fn(x: int) -> int { x + 1 }; 1 | inc", 2},
+		{"inc = fn(x: int) -> int { x + 1 }; 1 | inc | inc | inc", 4},
+		{"sub = fn(x: int, y: int) -> int { x - y }; 10 | sub(3)", 7},
+		{"sub = fn(x: int, y: int) -> int { x - y }; 10 | sub(3) | sub(2)", 5},
+		{"[1, 2, 3] | push(4) | len", 4},
+		{"[1, 2, 3] | tail", 3},
+		{`"abc" | fn(s: string) -> string { s * 2 }`, "abcabc"},
+	}
+
+	for _, tt := range tests {
+		testLiteralObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestGenericFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"id = fn[T](x: T) -> T { x }; id(5)", 5},
+		{`id = fn[T](x: T) -> T { x }; id("five")`, "five"},
+		{"first = fn[T](xs: array[T]) -> T { head(xs) }; first([2.5, 1.0])", 2.5},
+		{"app = fn[T, U](x: T, f: fn(T) -> U) -> U { f(x) }; app(3, fn(x: int) -> bool { x > 2 })", true},
+	}
+
+	for _, tt := range tests {
+		testLiteralObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestEvalIntegerExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -428,6 +659,8 @@ func TestForStatements(t *testing.T) {
 		{"x = 0; for i, val in [1,2,3,4,5] { x += i; x += val }; x", 25},
 		{`dct = {"a": 1, "b": 2}; x = 0; for key in dct { x += dct[key] }; x`, 3},
 		{`dct = {"a": 1, "b": 2}; x = 0; for _, val in dct { x += val }; x`, 3},
+		{"x = 1\nfor _ in [1, 2] {}\nx", 1},
+		{"x = 1\nfor _ in {\"a\": 2} {}\nx", 1},
 	}
 
 	for _, tt := range tests {
@@ -441,6 +674,31 @@ func TestWhileStatements(t *testing.T) {
 
 	evaluated := testEval(input)
 	testIntegerObject(t, evaluated, int64(10))
+
+	// an empty body loops until the step limit
+	program := parser.New(lexer.New("while true {}")).ParseProgram()
+	env := object.NewEnvironment()
+	env.SetSandbox(object.NewSandbox(object.Limits{MaxSteps: 100}))
+	if errObj, ok := Eval(program, env).(*object.Error); !ok || !errObj.Limit {
+		t.Errorf("expected a limit error from an empty loop")
+	}
+}
+
+func TestBreakContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"x = 0; for v in [1,2,3,4] { if v == 3 { break } x += v }; x", 3},
+		{"x = 0; for v in [1,2,3,4] { if v == 2 { continue } x += v }; x", 8},
+		{"x = 0; i = 0; while i < 10 { i += 1; if i == 5 { continue } if i == 8 { break } x += i }; x", 23},
+		{"x = 0; for v in [1,2] { for w in [1,2,3] { if w == 2 { break } x += w } }; x", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, int64(tt.expected))
+	}
 }
 
 func TestReturnStatements(t *testing.T) {
@@ -514,6 +772,212 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestSandboxLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{"x = 0; while true { x += 1 }", object.Limits{MaxSteps: 1000},
+			"Limit Error at [1,18]: step limit of 1000 exceeded"},
+		{"f = fn(n: int) -> int { f(n + 1) }; f(0)", object.Limits{MaxCallDepth: 50},
+			"Limit Error at [1,26]: call depth limit of 50 exceeded"},
+		{"r = range(1000000000)", object.Limits{MaxElements: 100},
+			"Limit Error at [1,10]: allocation limit of 100 elements exceeded"},
+		{`s = "ab" * 1000`, object.Limits{MaxElements: 1000},
+			"Limit Error at [1,10]: allocation limit of 1000 elements exceeded"},
+		{`s = "x"; while true { s += s }`, object.Limits{MaxElements: 1000},
+			"Limit Error at [1,26]: allocation limit of 1000 elements exceeded"},
+		{"a = []int; for i in range(10) { a = push(a, i) }", object.Limits{MaxElements: 30},
+			"Limit Error at [1,41]: allocation limit of 30 elements exceeded"},
+		{`s = "x"; while true { s = replace(s, "x", "xx") }`, object.Limits{MaxElements: 1000},
+			"Limit Error at [1,34]: allocation limit of 1000 elements exceeded"},
+		{`parts = split("a" * 400, "")`, object.Limits{MaxElements: 600},
+			"Limit Error at [1,14]: allocation limit of 600 elements exceeded"},
+		{`d = {}int; for i in range(100) { d[format("{}", i)] = i }`, object.Limits{MaxElements: 1000},
+			"Limit Error at [1,42]: allocation limit of 1000 elements exceeded"},
+		{"r = range(400); s = r[::-1]", object.Limits{MaxElements: 600},
+			"Limit Error at [1,22]: allocation limit of 600 elements exceeded"},
+		{"a = range(100); for i in range(10) { a[i] = 0 }", object.Limits{MaxElements: 500},
+			"Limit Error at [1,43]: allocation limit of 500 elements exceeded"},
+		{"m = map(range(500), fn(x: int) -> int { x })", object.Limits{MaxElements: 600},
+			"Limit Error at [1,8]: allocation limit of 600 elements exceeded"},
+		{"m = map([1], fn(x: int) -> int { while true { x += 1 }; x })", object.Limits{MaxSteps: 100},
+			"Limit Error at [1,44]: step limit of 100 exceeded"},
+		{"while true { try { 1 } catch e { 0 } }", object.Limits{MaxSteps: 100},
+			"Limit Error at [1,12]: step limit of 100 exceeded"},
+		{"x = 1", object.Limits{Context: canceled},
+			"Limit Error at [1,3]: context canceled"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		env.SetSandbox(object.NewSandbox(tt.limits))
+
+		errObj, ok := Eval(program, env).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		// the first line, without the calls unwound through
+		got := strings.SplitN(errObj.Traceback(), "\n", 2)[0]
+		if !errObj.Limit || got != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSandboxWithinLimits(t *testing.T) {
+	input := `fib = fn(n: int) -> int { ife n < 2 { n } else { fib(n - 1) + fib(n - 2) } }
+s = ""
+for i in range(10) { s += "ab" }
+fib(10) + len(s)`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironment()
+	env.SetSandbox(object.NewSandbox(object.Limits{MaxSteps: 100000, MaxCallDepth: 11, MaxElements: 1000}))
+
+	testIntegerObject(t, Eval(program, env), 75)
+}
+
+func FuzzEval(f *testing.F) {
+	seeds := []string{
+		"x = 1 + 2.5 * -3",
+		"fib = fn(n: int) -> int { ife n < 2 { n } else { fib(n - 1) + fib(n - 2) } }; fib(5)",
+		"a = []int; for i in range(10) { if i == 2 { continue }; a = push(a, i) }; pop(a)",
+		`s = "ab" * 3; s + s`,
+		"struct P { x: int }; p = P{x: 1}; p.x += 1; p",
+		"enum Color { Red, Green }; match Color.Red { Color.Red => 1, _ => 2 }",
+		`try { {"a": 1}["b"] } catch e { e }`,
+		"first = fn<T>(xs: array[T]) -> T { xs[0] }; first([1.5])",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 || typechecker.Typeof(program, types.NewContext()).Type() == types.ERROR {
+			return
+		}
+		// programs that typecheck may fail at runtime, but never panic
+		env := object.NewEnvironment()
+		env.SetSandbox(object.NewSandbox(object.Limits{MaxSteps: 10000, MaxCallDepth: 100, MaxElements: 100000}))
+		Eval(program, env)
+	})
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 / 0 } catch e { 5 }", 5},
+		{"try { 10 / 2 } catch e { 5 }", 5},
+		{"try { [1][3] } catch e { e }", "Index 3 out of range for array of length 1"},
+		{`try { throw("bad record") } catch e { e }`, "bad record"},
+		{`x = 0; try { x = 1; throw("oops"); x = 2 } catch e { x += 10 }; x`, 11},
+		{"f = fn(x: int) -> int { 10 / x }; try { f(0) } catch e { -1 }", -1},
+		{"f = fn(x: int) -> int { try { return 10 / x } catch e { 0 } }; f(0) + f(5)", 2},
+		{"s = 0; for x in [1, 0, 2] { try { s += 2 / x } catch e { continue } } s", 3},
+		{`try { try { throw("in") } catch e { throw(e + "out") } } catch e { e }`, "inout"},
+		{`f = fn(x: int) -> int { ife x > 0 { x } else { throw("neg") } }; try { f(-1) } catch e { 0 }`, 0},
+		{`f = fn(x: int) -> int { ife x > 0 { x } else { throw("neg") } }; f(2)`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	shapes := "enum Shape { Circle(float), Rect(float, float), Empty }; "
+	area := "area = fn(s: Shape) -> float { match s { Circle(r) => 3.0 * r * r, Rect(w, h) => w * h, Empty => 0.0 } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{shapes + "Shape.Circle(1.5)", "Shape.Circle(1.5)"},
+		{shapes + "Shape.Empty", "Shape.Empty"},
+		{shapes + area + "area(Shape.Rect(2.0, 4.5))", 9.0},
+		{shapes + area + "area(Shape.Circle(2.0))", 12.0},
+		{shapes + area + "area(Shape.Empty)", 0.0},
+		{shapes + `match Shape.Rect(1.0, 2.0) { Circle(_) => "round", _ => "other" }`, "other"},
+		{shapes + `match Shape.Rect(1.0, 2.0) { Rect(_, h) => { x = h * 2.0; x }, _ => 0.0 }`, 4.0},
+		{`enum Tree { Leaf, Node(Tree, int, Tree) }
+		sum = fn(t: Tree) -> int { match t { Leaf => 0, Node(l, v, r) => sum(l) + v + sum(r) } }
+		sum(Tree.Node(Tree.Node(Tree.Leaf, 1, Tree.Leaf), 2, Tree.Node(Tree.Leaf, 3, Tree.Leaf)))`, 6},
+		{`enum Res { Ok(int), Err(string) }
+		div = fn(a: int, b: int) -> Res { ife b == 0 { Res.Err("divide by zero") } else { Res.Ok(a / b) } }
+		match div(1, 0) { Ok(v) => "ok", Err(msg) => msg }`, "divide by zero"},
+		{"match 1 { _ => 2 }", "match subject must be an enum, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int, float64:
+			testLiteralObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				if obj.Inspect() != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, obj.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func TestErrorTracebacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "Runtime Error at [1,3]: divide by zero"},
+		{"x = [1, 2]\nx[5]", "Runtime Error at [2,2]: Index 5 out of range for array of length 2"},
+		{"len(1)", "Runtime Error at [1,4]: argument to `len` not supported, got=INTEGER"},
+		{"f = fn(x: int) -> int { x }; f(1, 2)", "Runtime Error at [1,31]: wrong number of arguments. got=2, want=1"},
+		{
+			"div = fn(a: int, b: int) -> int {\n  a / b\n}\nhalf = fn(x: int) -> int { div(x, 0) }\nhalf(3)",
+			"Runtime Error at [2,5]: divide by zero\n\tin div, called at [4,31]\n\tin half, called at [5,5]",
+		},
+		{
+			"fn(x: int) -> int { x / 0 }(1)",
+			"Runtime Error at [1,23]: divide by zero\n\tin anonymous function, called at [1,28]",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Traceback() != tt.expected {
+			t.Errorf("wrong traceback.\nexpected=%q\ngot=%q", tt.expected, errObj.Traceback())
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 	testLiteralObject(t, testEval(input), "Hello World!")
@@ -641,3 +1105,68 @@ func TestDictIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct P { x: int, y: int }; P{x: 1, y: 2}.y", 2},
+		{"struct P { x: int, y: int }; p = P{x: 1, y: 2}; p.x = 5; p.x + p.y", 7},
+		{"struct P { x: int }; p = P{x: 1}; p.x += 4; p.x *= 2; p.x", 10},
+		{"struct P { x: int }; p = P{x: 1}; q = p; p.x = 5; q.x", 1},
+		{"struct P { x: int }; struct L { a: P }; l = L{a: P{x: 1}}; l.a.x = 3; l.a.x", 3},
+		{`struct P { name: string }; greet = fn(p: P) -> string { "hi " + p.name }; greet(P{name: "bob"})`, "hi bob"},
+	}
+
+	for _, tt := range tests {
+		testLiteralObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	modEnv := object.NewEnvironment()
+	Eval(parser.New(lexer.New("n = 2; twice = fn(x: int) -> int { x * n }")).ParseProgram(), modEnv)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib.gli" as lib; lib.n`, 2},
+		{`import "lib.gli" as lib; lib.twice(5)`, 10},
+		{`import "lib.gli" as lib; f = fn() -> int { lib.twice(1) }; f()`, 2},
+		{`import "lib.gli" as lib; lib`, "module lib"},
+		{`import "nope.gli" as lib`, "ERROR: module not found: nope.gli"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetImporter(func(path string) (*object.Environment, error) {
+			if path != "lib.gli" {
+				return nil, fmt.Errorf("module not found: %s", path)
+			}
+			return modEnv, nil
+		})
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	input := "struct P { x: int, y: float }; P{y: 2.5, x: 1}"
+
+	evaluated := testEval(input)
+	st, ok := evaluated.(*object.Struct)
+	if !ok {
+		t.Fatalf("object is not Struct. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if st.Inspect() != "P{y: 2.5, x: 1}" {
+		t.Errorf("struct Inspect wrong. got=%s", st.Inspect())
+	}
+}
@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"fmt"
+	"glimmer/debugger"
+	"glimmer/lexer"
+	"glimmer/modules"
+	"glimmer/parser"
+	"glimmer/typechecker"
+	"io"
+	"io/ioutil"
+)
+
+// DebugFile runs the file at fpath under the debugger, taking its commands
+// from in. The program stops before its first statement.
+func DebugFile(fpath string, in io.Reader, out io.Writer) []error {
+	content, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return []error{err}
+	}
+
+	src := string(content)
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return sourceErrors(fpath, src, p.Diagnostics())
+	}
+
+	loader := modules.NewLoader(modules.SearchPathFromEnv())
+	if typeErrs := typechecker.Check(program, loader.NewContext(fpath)); len(typeErrs) != 0 {
+		return sourceErrors(fpath, src, typeDiagnostics(typeErrs, src))
+	}
+
+	d := debugger.New(in, out, src)
+	evaluated, finished := d.Run(program, loader.NewEnvironment(fpath))
+	if !finished {
+		fmt.Fprintln(out, "program stopped")
+		return nil
+	}
+	if _, errs := runtimeResult(evaluated); errs != nil {
+		return errs
+	}
+	fmt.Fprintln(out, "program finished")
+	return nil
+}
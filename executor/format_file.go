@@ -0,0 +1,38 @@
+package executor
+
+import (
+	"fmt"
+	"glimmer/formatter"
+	"io"
+	"io/ioutil"
+)
+
+// FormatFiles formats each of fpaths, writing the result back to files whose
+// layout changed if write is set, and printing it to out otherwise
+func FormatFiles(fpaths []string, write bool, out io.Writer) []error {
+	var errObjs []error
+	for _, fpath := range fpaths {
+		content, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			errObjs = append(errObjs, err)
+			continue
+		}
+
+		formatted, errs := formatter.Format(string(content))
+		if len(errs) != 0 {
+			for _, err := range errs {
+				errObjs = append(errObjs, fmt.Errorf("%s: %s", fpath, err))
+			}
+			continue
+		}
+
+		if !write {
+			fmt.Fprint(out, formatted)
+		} else if formatted != string(content) {
+			if err := ioutil.WriteFile(fpath, []byte(formatted), 0644); err != nil {
+				errObjs = append(errObjs, err)
+			}
+		}
+	}
+	return errObjs
+}
@@ -1,33 +1,34 @@
 package executor
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
 
+	"glimmer/ast"
+	"glimmer/compiler"
 	"glimmer/evaluator"
 	"glimmer/lexer"
+	"glimmer/modules"
 	"glimmer/object"
 	"glimmer/parser"
 	"glimmer/token"
 	"glimmer/typechecker"
 	"glimmer/types"
+	"glimmer/vm"
 )
 
 const PROMPT = ">> "
 
 func StartRLPL(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	reader := newLineReader(in, out)
+	defer reader.Close()
 
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-
-		line := scanner.Text()
-		if line == "exit" {
+		line, err := readEntry(reader)
+		if err != nil || line == "exit" {
 			return
 		}
 		l := lexer.New(line)
@@ -39,17 +40,12 @@ func StartRLPL(in io.Reader, out io.Writer) {
 }
 
 func StartRPPL(in io.Reader, out io.Writer, dot bool) {
-	scanner := bufio.NewScanner(in)
+	reader := newLineReader(in, out)
+	defer reader.Close()
 
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-
-		line := scanner.Text()
-		if line == "exit" {
+		line, err := readEntry(reader)
+		if err != nil || line == "exit" {
 			return
 		}
 		l := lexer.New(line)
@@ -66,56 +62,138 @@ func StartRPPL(in io.Reader, out io.Writer, dot bool) {
 		io.WriteString(out, program.String()+"\n")
 
 		if dot {
-			currTime := program.ToDot()
-			io.WriteString(out, "Dot file & image "+currTime+" created in /dot/dotfiles & /dot/dotimages\n")
+			if currTime, err := program.ToDot(); err != nil {
+				io.WriteString(out, "\tdot output failed: "+err.Error()+"\n")
+			} else {
+				io.WriteString(out, "Dot file & image "+currTime+" created in /dot/dotfiles & /dot/dotimages\n")
+			}
 		}
 	}
 }
 
-func StartREPL(in io.Reader, out io.Writer, dot bool) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	ctx := types.NewContext()
+func StartREPL(in io.Reader, out io.Writer, dot bool, useVM bool) {
+	reader := newLineReader(in, out)
+	defer reader.Close()
+	session := newReplSession(out, dot, useVM)
 
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := readEntry(reader)
+		if err != nil || line == "exit" {
 			return
 		}
 
-		line := scanner.Text()
-		if line == "exit" {
-			return
+		if isCommand(line) {
+			session.command(line)
+		} else {
+			session.run(line)
 		}
+	}
+}
 
-		l := lexer.New(line)
-		p := parser.New(l)
+// replSession is the state the REPL keeps between entries
+type replSession struct {
+	out    io.Writer
+	dot    bool
+	useVM  bool
+	loader *modules.Loader
+	dir    string // imports are relative to it
+	env    *object.Environment
+	ctx    *types.Context
+
+	// compiled entries share globals, so state persists as with env
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+}
 
-		program := p.ParseProgram()
-		errors := p.Errors()
-		if len(p.Errors()) != 0 {
-			for _, err := range errors {
-				io.WriteString(out, err+"\n")
-			}
-			continue
+func newReplSession(out io.Writer, dot bool, useVM bool) *replSession {
+	s := &replSession{out: out, dot: dot, useVM: useVM, loader: modules.NewLoader(modules.SearchPathFromEnv())}
+	s.reset()
+	return s
+}
+
+// reset forgets every binding of the session
+func (s *replSession) reset() {
+	s.dir = "."
+	s.env = s.loader.NewEnvironment("")
+	s.ctx = s.loader.NewContext("")
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	s.symbolTable = compiler.NewSymbolTable()
+}
+
+// setDir resolves the imports of later entries relative to dir
+func (s *replSession) setDir(dir string) {
+	s.dir = dir
+	s.env.SetImporter(s.loader.EnvironmentImporter(dir))
+	s.ctx.SetImporter(s.loader.ContextImporter(dir))
+}
+
+// run parses, typechecks and evaluates src, printing its result or error
+func (s *replSession) run(src string) {
+	out := s.out
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	errors := p.Errors()
+	if len(p.Errors()) != 0 {
+		for _, err := range errors {
+			io.WriteString(out, err+"\n")
 		}
+		return
+	}
 
-		pType := typechecker.Typeof(program, ctx)
-		if pType.Type() == types.ERROR {
-			io.WriteString(out, pType.String()+"\n")
-			continue
+	if typeErrs := typechecker.Check(program, s.ctx); len(typeErrs) != 0 {
+		for _, err := range typeErrs {
+			io.WriteString(out, err.String()+"\n")
 		}
+		return
+	}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	var evaluated object.Object
+	if s.useVM {
+		comp := compiler.NewWithState(s.symbolTable, s.constants)
+		comp.SetImporter(s.loader.EnvironmentImporter(s.dir))
+		if err := comp.Compile(program); err != nil {
+			io.WriteString(out, "Compilation error: "+err.Error()+"\n")
+			return
+		}
+		bytecode := comp.Bytecode()
+		s.constants = bytecode.Constants
+
+		machine := vm.NewWithGlobalsStore(bytecode, s.globals)
+		if err := machine.Run(); err != nil {
+			evaluated = &object.Error{Message: err.Error()}
+		} else {
+			evaluated = machine.Result()
 		}
+	} else {
+		evaluated = evalInterruptible(program, s.env)
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		io.WriteString(out, errObj.Traceback()+"\n")
+	} else if evaluated != nil {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
 
-		if dot {
-			currTime := program.ToDot()
+	if s.dot {
+		if currTime, err := program.ToDot(); err != nil {
+			io.WriteString(out, "\tdot output failed: "+err.Error()+"\n")
+		} else {
 			io.WriteString(out, "Dot file & image "+currTime+" created in /dot/dotfiles & /dot/dotimages\n")
 		}
 	}
 }
+
+// evalInterruptible evaluates program in env, stopping it with a limit error
+// if Ctrl-C is pressed before it finishes
+func evalInterruptible(program *ast.Program, env *object.Environment) object.Object {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// reset in place, as the functions of earlier entries share the sandbox
+	*env.Sandbox() = *object.NewSandbox(object.Limits{Context: ctx})
+	return evaluator.Eval(program, env)
+}
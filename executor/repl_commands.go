@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"glimmer/ast"
+	"glimmer/compiler"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/token"
+	"glimmer/typechecker"
+	"glimmer/types"
+)
+
+const REPL_HELP = `:type <expr>    print the type of expr, without evaluating it
+:ast <expr>     print the tree expr parses to
+:tokens <expr>  print the tokens of expr
+:env            list the bindings of the session, with their types
+:load <file>    evaluate a source file into the session
+:reset          forget every binding of the session
+:help           print this help`
+
+// argUsage is the usage of the commands that take an argument
+var argUsage = map[string]string{
+	"type":   ":type <expr>",
+	"ast":    ":ast <expr>",
+	"tokens": ":tokens <expr>",
+	"load":   ":load <file>",
+}
+
+// isCommand reports whether a REPL entry is a command for the REPL itself,
+// i.e. `:type x + 1`, rather than source
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ":")
+}
+
+func (s *replSession) command(line string) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), ":")
+	name, arg := line, ""
+	if idx := strings.IndexFunc(line, unicode.IsSpace); idx != -1 {
+		name, arg = line[:idx], strings.TrimSpace(line[idx:])
+	}
+
+	if usage, ok := argUsage[name]; ok && arg == "" {
+		fmt.Fprintln(s.out, "usage: "+usage)
+		return
+	}
+
+	switch name {
+	case "type":
+		s.printType(arg)
+	case "ast":
+		if program, ok := s.parse(arg); ok {
+			fmt.Fprintln(s.out, program.String())
+		}
+	case "tokens":
+		l := lexer.New(arg)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			fmt.Fprintf(s.out, "%+v\n", tok)
+		}
+	case "env":
+		s.printEnv()
+	case "load":
+		s.load(arg)
+	case "reset":
+		s.reset()
+	case "help":
+		fmt.Fprintln(s.out, REPL_HELP)
+	default:
+		fmt.Fprintf(s.out, "unknown command :%s, :help lists them\n", name)
+	}
+}
+
+// parse parses src, printing its errors if it has any
+func (s *replSession) parse(src string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		fmt.Fprintln(s.out, err)
+	}
+	return program, len(p.Errors()) == 0
+}
+
+// printType typechecks src in a scope of its own, so that its assignments do
+// not define names that were never evaluated
+func (s *replSession) printType(src string) {
+	program, ok := s.parse(src)
+	if !ok {
+		return
+	}
+	pType := typechecker.Typeof(program, types.NewEnclosedContext(s.ctx, nil))
+	fmt.Fprintln(s.out, pType.String())
+}
+
+// printEnv lists the globals of the session by name, with their types and,
+// but for functions and modules, their values
+func (s *replSession) printEnv() {
+	members := s.ctx.Members()
+	if len(members) == 0 {
+		fmt.Fprintln(s.out, "no bindings")
+		return
+	}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		typ := members[name]
+		val, ok := s.lookup(name)
+		if !ok || typ.Type() == types.FUNCTION || typ.Type() == types.MODULE {
+			fmt.Fprintf(s.out, "%s: %s\n", name, typ.String())
+		} else {
+			fmt.Fprintf(s.out, "%s: %s = %s\n", name, typ.String(), val.Inspect())
+		}
+	}
+}
+
+// lookup finds the value of a global in whichever of the evaluator and the
+// vm the session runs entries on
+func (s *replSession) lookup(name string) (object.Object, bool) {
+	if !s.useVM {
+		return s.env.Get(name)
+	}
+	sym, ok := s.symbolTable.Resolve(name)
+	if !ok || sym.Scope != compiler.GlobalScope || s.globals[sym.Index] == nil {
+		return nil, false
+	}
+	return s.globals[sym.Index], true
+}
+
+// load runs the source file at path as an entry, importing relative to it
+func (s *replSession) load(path string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+
+	prev := s.dir
+	s.setDir(filepath.Dir(path))
+	defer s.setDir(prev)
+	s.run(string(src))
+}
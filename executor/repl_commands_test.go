@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplCommands(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.gli")
+	err := os.WriteFile(lib, []byte("double = fn(x: int) -> int { x * 2 }\nscale = 3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":type 1 + 2.5", "float"},
+		{":type y = 1\ny", "none\nStatic TypeError at [1,2]: identifier not found: y"},
+		{":type x", "Static TypeError at [1,2]: identifier not found: x"},
+		{":ast fn(a: int) -> int { a + 1 }", "fn(a : int) -> int { (a + 1) }"},
+		{":ast 1 + )", "[1,5]: no prefix parse function for ) found"},
+		{":tokens x += 1", "{Type:ID Literal:x Line:1 Col:2}\n{Type:+= Literal:+= Line:1 Col:4}\n{Type:INT Literal:1 Line:1 Col:7}"},
+		{":env", "no bindings"},
+		{"x = [1]\nf = fn() -> int { 1 }\n:env", "[1]\nfn () { 1 }\nf: fn() -> int\nx: array[int] = [1]"},
+		{":load " + lib + "\ndouble(scale)", "3\n6"},
+		{"x = 1\n:reset\n:env\nx", "1\nno bindings\nStatic TypeError at [1,2]: identifier not found: x"},
+		{":type", "usage: :type <expr>"},
+		{":load " + filepath.Join(dir, "none.gli"), "open " + filepath.Join(dir, "none.gli") + ": no such file or directory"},
+		{":quit", "unknown command :quit, :help lists them"},
+	}
+
+	for _, tt := range tests {
+		for _, useVM := range []bool{false, true} {
+			out := &bytes.Buffer{}
+			StartREPL(strings.NewReader(tt.input), out, false, useVM)
+
+			got := strings.TrimSpace(strings.ReplaceAll(out.String(), PROMPT, ""))
+			if got != tt.expected {
+				t.Errorf("wrong output for %q (vm=%t). expected=%q, got=%q", tt.input, useVM, tt.expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterh/liner"
+
+	"glimmer/lexer"
+	"glimmer/token"
+)
+
+// CONT_PROMPT continues an entry spanning several lines
+const CONT_PROMPT = ".. "
+
+// HISTORY_FILE keeps the lines entered at the terminal between sessions, in
+// the home directory
+const HISTORY_FILE = ".glimmer_history"
+
+// errInterrupted is returned by a lineReader when Ctrl-C is pressed at a prompt
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the lines of REPL input after a prompt, returning io.EOF
+// once there are no more
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// newLineReader edits lines at the terminal, with history, when reading from
+// a terminal on stdin and writing to stdout, and otherwise reads in as it is
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if in == os.Stdin && out == os.Stdout && isTerminal(os.Stdin) {
+		return newTerminalReader()
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *scannerReader) Close() error {
+	return nil
+}
+
+type terminalReader struct {
+	state       *liner.State
+	historyPath string
+}
+
+func newTerminalReader() *terminalReader {
+	r := &terminalReader{state: liner.NewLiner()}
+	r.state.SetCtrlCAborts(true)
+
+	if home, err := os.UserHomeDir(); err == nil {
+		r.historyPath = filepath.Join(home, HISTORY_FILE)
+		if f, err := os.Open(r.historyPath); err == nil {
+			r.state.ReadHistory(f)
+			f.Close()
+		}
+	}
+	return r
+}
+
+func (r *terminalReader) ReadLine(prompt string) (string, error) {
+	line, err := r.state.Prompt(prompt)
+	if err == liner.ErrPromptAborted {
+		return "", errInterrupted
+	}
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(line) != "" {
+		r.state.AppendHistory(line)
+	}
+	return line, nil
+}
+
+// Close restores the terminal, saving the history
+func (r *terminalReader) Close() error {
+	defer r.state.Close()
+	if r.historyPath == "" {
+		return nil
+	}
+	f, err := os.Create(r.historyPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = r.state.WriteHistory(f)
+	return err
+}
+
+// readEntry reads lines until they form a whole entry, prompting for more
+// with CONT_PROMPT. Ctrl-C discards the lines read so far and starts over.
+func readEntry(r lineReader) (string, error) {
+	lines := []string{}
+	for {
+		prompt := PROMPT
+		if len(lines) > 0 {
+			prompt = CONT_PROMPT
+		}
+
+		line, err := r.ReadLine(prompt)
+		if err == errInterrupted {
+			lines = lines[:0]
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, line)
+		if entry := strings.Join(lines, "\n"); !incomplete(entry) {
+			return entry, nil
+		}
+	}
+}
+
+// continuesEntry are the tokens that can not end an entry, as more must follow them
+var continuesEntry = map[token.TokenType]bool{
+	token.ASSIGN: true, token.PLUS: true, token.MINUS: true, token.NOT: true,
+	token.MULT: true, token.DIV: true, token.PLUSEQ: true, token.MINUSEQ: true,
+	token.MULTEQ: true, token.DIVEQ: true, token.LT: true, token.GT: true,
+	token.LTE: true, token.GTE: true, token.EQ: true, token.NEQ: true,
+	token.AND: true, token.OR: true, token.PIPE: true, token.COMMA: true,
+	token.COLON: true, token.ARROW: true, token.FATARROW: true, token.DOT: true,
+	token.ELSE: true, token.IN: true, token.NOTIN: true, token.AS: true,
+}
+
+// endsOperand are the tokens an operand can end with, after which a `not`
+// can only begin `not in`
+var endsOperand = map[token.TokenType]bool{
+	token.ID: true, token.INT: true, token.FLOAT: true, token.STRING: true,
+	token.TRUE: true, token.FALSE: true, token.RPAR: true, token.RBRACKET: true,
+}
+
+// incomplete reports whether src needs more lines: a bracket is left open,
+// or it ends in an operator
+func incomplete(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAR, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAR, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.ID:
+			if tok.Literal == "not" && endsOperand[last.Type] {
+				tok.Type = token.NOTIN
+			}
+		}
+		last = tok
+	}
+	return depth > 0 || continuesEntry[last.Type]
+}
@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"x = 1", false},
+		{"x = ", true},
+		{"add = fn(a: int, b: int) -> int {", true},
+		{"add = fn(a: int, b: int) -> int {\n  a + b\n}", false},
+		{"[1, 2,", true},
+		{"[1, 2,\n 3]", false},
+		{"ife x > 1 { 1 } else", true},
+		{`"a" |`, true},
+		{"x not", true},
+		{"x = not", false},
+		{"x = 1 +\n 2", false},
+		{"}", false},
+		{"", false},
+		{"# a comment {", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) wrong. expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestReadEntry(t *testing.T) {
+	input := "f = fn(x: int) -> int {\n  x + 1\n}\nf(1)\n[1,\n"
+	out := &bytes.Buffer{}
+	reader := newLineReader(strings.NewReader(input), out)
+
+	expected := []string{"f = fn(x: int) -> int {\n  x + 1\n}", "f(1)"}
+	for _, want := range expected {
+		entry, err := readEntry(reader)
+		if err != nil {
+			t.Fatalf("readEntry returned error: %v", err)
+		}
+		if entry != want {
+			t.Errorf("wrong entry. expected=%q, got=%q", want, entry)
+		}
+	}
+
+	// input ending mid-entry has nothing more to give
+	if _, err := readEntry(reader); err != io.EOF {
+		t.Errorf("expected io.EOF, got=%v", err)
+	}
+	if prompts := out.String(); prompts != ">> .. .. >> >> .. " {
+		t.Errorf("wrong prompts, got=%q", prompts)
+	}
+}
@@ -1,17 +1,26 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
+	"glimmer/ast"
+	"glimmer/compiler"
+	"glimmer/diagnostics"
 	"glimmer/evaluator"
 	"glimmer/lexer"
+	"glimmer/modules"
 	"glimmer/object"
 	"glimmer/parser"
 	"glimmer/typechecker"
 	"glimmer/types"
+	"glimmer/vm"
 	"io/ioutil"
+	"path/filepath"
 )
 
-func RunFile(fpath string, dot bool) (object.Object, []error) {
+// RunFile runs the file at fpath, on the VM if useVM is set. The tree-walking
+// evaluator stops the program with a limit error once it exceeds limits.
+func RunFile(fpath string, dot bool, useVM bool, limits object.Limits) (object.Object, []error) {
 	content, err := ioutil.ReadFile(fpath)
 	if err != nil {
 		return nil, []error{err}
@@ -21,30 +30,76 @@ func RunFile(fpath string, dot bool) (object.Object, []error) {
 
 	l := lexer.New(contentString)
 	p := parser.New(l)
-	ctx := types.NewContext()
+	loader := modules.NewLoader(modules.SearchPathFromEnv())
+	ctx := loader.NewContext(fpath)
 
 	program := p.ParseProgram()
-	errors := p.Errors()
-	var errObjs []error
 	if len(p.Errors()) != 0 {
-		for _, err := range errors {
-			errObjs = append(errObjs, fmt.Errorf(err))
-		}
-		return nil, errObjs
+		return nil, sourceErrors(fpath, contentString, p.Diagnostics())
 	}
 
-	pType := typechecker.Typeof(program, ctx)
-	if pType.Type() == types.ERROR {
-		errObjs = append(errObjs, fmt.Errorf(pType.String()))
-		return nil, errObjs
+	if typeErrs := typechecker.Check(program, ctx); len(typeErrs) != 0 {
+		return nil, sourceErrors(fpath, contentString, typeDiagnostics(typeErrs, contentString))
 	}
 
 	if dot {
-		program.ToDot()
+		if _, err := program.ToDot(); err != nil {
+			return nil, []error{fmt.Errorf("dot output failed: %s", err)}
+		}
+	}
+
+	if useVM {
+		if limits != (object.Limits{}) {
+			return nil, []error{fmt.Errorf("execution limits are not supported by the vm")}
+		}
+		return runCompiled(program, loader.EnvironmentImporter(filepath.Dir(fpath)))
 	}
 
-	env := object.NewEnvironment()
+	env := loader.NewEnvironment(fpath)
+	env.SetSandbox(object.NewSandbox(limits))
 	evaluated := evaluator.Eval(program, env)
 
+	return runtimeResult(evaluated)
+}
+
+// sourceErrors returns the diagnostics of the file at fpath as errors
+// rendering them with its source src
+func sourceErrors(fpath string, src string, diags []diagnostics.Diagnostic) []error {
+	errObjs := make([]error, len(diags))
+	for idx, diag := range diags {
+		diag.File = fpath
+		errObjs[idx] = &diagnostics.SourceError{Diagnostic: diag, Source: src}
+	}
+	return errObjs
+}
+
+func typeDiagnostics(typeErrs []*types.ErrorType, src string) []diagnostics.Diagnostic {
+	diags := make([]diagnostics.Diagnostic, len(typeErrs))
+	for idx, err := range typeErrs {
+		diags[idx] = err.Diagnostic(src)
+	}
+	return diags
+}
+
+// runtimeResult reports an error object as a traceback rather than a result
+func runtimeResult(evaluated object.Object) (object.Object, []error) {
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, []error{errors.New(errObj.Traceback())}
+	}
 	return evaluated, nil
 }
+
+func runCompiled(program *ast.Program, importer object.Importer) (object.Object, []error) {
+	comp := compiler.New()
+	comp.SetImporter(importer)
+	if err := comp.Compile(program); err != nil {
+		return nil, []error{fmt.Errorf("Compilation error: %s", err)}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return runtimeResult(&object.Error{Message: err.Error()})
+	}
+
+	return runtimeResult(machine.Result())
+}
@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"fmt"
+	"glimmer/lexer"
+	"glimmer/modules"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/testrunner"
+	"glimmer/typechecker"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// TestDir runs the tests of every *_test.gli file under dir, printing each
+// result and the totals to out. ok is false if a test failed or a file could
+// not be run, in which case its errors are returned.
+func TestDir(dir string, out io.Writer) (ok bool, errObjs []error) {
+	fpaths := []string{}
+	err := filepath.WalkDir(dir, func(fpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(fpath, "_test.gli") {
+			fpaths = append(fpaths, fpath)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, []error{err}
+	}
+	if len(fpaths) == 0 {
+		fmt.Fprintf(out, "no test files in %s\n", dir)
+		return true, nil
+	}
+
+	passed, failed := 0, 0
+	for _, fpath := range fpaths {
+		fmt.Fprintf(out, "=== %s\n", fpath)
+		p, f, errs := testFile(fpath, out)
+		passed, failed = passed+p, failed+f
+		errObjs = append(errObjs, errs...)
+	}
+
+	fmt.Fprintf(out, "%d passed, %d failed\n", passed, failed)
+	return failed == 0 && len(errObjs) == 0, errObjs
+}
+
+func testFile(fpath string, out io.Writer) (passed, failed int, errObjs []error) {
+	content, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return 0, 0, []error{err}
+	}
+
+	src := string(content)
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return 0, 0, sourceErrors(fpath, src, p.Diagnostics())
+	}
+
+	loader := modules.NewLoader(modules.SearchPathFromEnv())
+	if typeErrs := typechecker.Check(program, loader.NewContext(fpath)); len(typeErrs) != 0 {
+		return 0, 0, sourceErrors(fpath, src, typeDiagnostics(typeErrs, src))
+	}
+
+	passed, failed = testrunner.Run(program, func() *object.Environment {
+		return loader.NewEnvironment(fpath)
+	}, out)
+	return passed, failed, nil
+}
@@ -0,0 +1,574 @@
+// Package formatter prints glimmer programs in their canonical layout: four
+// space indentation, one statement per line, single spaces around operators
+// and after commas, and the source's comments and blank lines kept in place.
+package formatter
+
+import (
+	"glimmer/ast"
+	"glimmer/lexer"
+	"glimmer/parser"
+	"glimmer/token"
+	"math"
+	"reflect"
+	"strings"
+)
+
+const indentUnit = "    "
+
+// Format returns src in canonical layout, or the parser's errors if src does
+// not parse. Formatting is idempotent, and the result parses to the same AST.
+func Format(src string) (string, []string) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", p.Errors()
+	}
+
+	pr := &printer{src: strings.Split(src, "\n"), comments: l.Comments()}
+	lines := pr.lines(program.Statements, math.MaxInt)
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+type printer struct {
+	src      []string      // the source, by line
+	comments []token.Token // the comments not yet printed, in source order
+	depth    int
+
+	// mirrors the parser's flag of the same name: set where `x {` would open
+	// a body, so struct literals must be parenthesized
+	noStructLiteral bool
+}
+
+// item is one line of a statement list: a statement, possibly followed by a
+// comment on its last line, or a comment on a line of its own
+type item struct {
+	text        string
+	trailing    string
+	first, last int // the source lines the item spans
+	stmt        ast.Statement
+}
+
+// lines prints stmts at the current depth, along with the comments that come
+// before the source line end
+func (p *printer) lines(stmts []ast.Statement, end int) []string {
+	items := []item{}
+	for idx, stmt := range stmts {
+		first, last := span(stmt)
+		items = append(items, p.commentsBefore(first)...)
+
+		it := item{text: p.statement(stmt), first: first, last: last, stmt: stmt}
+		nextOnLastLine := idx+1 < len(stmts) && firstLine(stmts[idx+1]) == last
+		if len(p.comments) > 0 && p.comments[0].Line == last && !nextOnLastLine {
+			it.trailing = p.comments[0].Literal
+			p.comments = p.comments[1:]
+		}
+		items = append(items, it)
+	}
+	items = append(items, p.commentsBefore(end)...)
+
+	out := []string{}
+	for idx, it := range items {
+		if idx > 0 && p.blankBetween(items[idx-1].last, it.first) {
+			out = append(out, "")
+		}
+		line := p.indent() + it.text
+		if needsSemicolon(it.stmt) && startsExpression(nextStatement(items[idx+1:])) {
+			line += ";" // the lexer ignores newlines, so the next line would continue this one
+		}
+		if it.trailing != "" {
+			line += " " + it.trailing
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// commentsBefore takes the comments before source line end as items
+func (p *printer) commentsBefore(end int) []item {
+	items := []item{}
+	for len(p.comments) > 0 && p.comments[0].Line < end {
+		c := p.comments[0]
+		items = append(items, item{text: c.Literal, first: c.Line, last: c.Line})
+		p.comments = p.comments[1:]
+	}
+	return items
+}
+
+// blankBetween reports whether the source has an empty line strictly between
+// lines from and to, which is kept as a single one
+func (p *printer) blankBetween(from, to int) bool {
+	for line := from + 1; line < to && line <= len(p.src); line++ {
+		if strings.TrimSpace(p.src[line-1]) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) indent() string {
+	return strings.Repeat(indentUnit, p.depth)
+}
+
+func (p *printer) statement(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.AssignStatement:
+		var target ast.Expression = stmt.Name
+		if stmt.Target != nil {
+			target = stmt.Target
+		}
+		return p.expression(target) + " " + stmt.Token.Literal + " " + p.expression(stmt.Value)
+
+	case *ast.ReturnStatement:
+		return "return " + p.expression(stmt.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		return p.expression(stmt.Expression)
+
+	case *ast.IfStatement:
+		return p.conditional("if", stmt.Condition, stmt.TrueBranch, stmt.ElifConditions, stmt.ElifBranches, stmt.FalseBranch)
+
+	case *ast.ForStatement:
+		vars := []string{}
+		for _, lv := range stmt.LoopVars {
+			vars = append(vars, lv.Value)
+		}
+		prev := p.noStructLiteral
+		p.noStructLiteral = true
+		collection := p.expression(stmt.Collection)
+		p.noStructLiteral = prev
+		return "for " + strings.Join(vars, ", ") + " in " + collection + " " + p.block(stmt.Body)
+
+	case *ast.WhileStatement:
+		return "while " + p.conditions(stmt.Condition) + " " + p.block(stmt.Body)
+
+	case *ast.TestStatement:
+		return "test " + p.expression(stmt.Name) + " " + p.block(stmt.Body)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return stmt.TokenLiteral()
+
+	case *ast.StructStatement, *ast.EnumStatement, *ast.ImportStatement:
+		return stmt.String() // already canonical, and contain no expressions
+
+	default:
+		return stmt.String()
+	}
+}
+
+// conditional prints an if statement or ife expression
+func (p *printer) conditional(keyword string, cond []ast.Statement, branch *ast.BlockStatement,
+	elifConds [][]ast.Statement, elifBranches []*ast.BlockStatement, elseBranch *ast.BlockStatement) string {
+	out := keyword + " " + p.conditions(cond) + " " + p.block(branch)
+	for idx, elif := range elifBranches {
+		out += " else " + keyword + " " + p.conditions(elifConds[idx]) + " " + p.block(elif)
+	}
+	if elseBranch != nil {
+		out += " else " + p.block(elseBranch)
+	}
+	return out
+}
+
+func (p *printer) conditions(stmts []ast.Statement) string {
+	prev := p.noStructLiteral
+	p.noStructLiteral = true
+	defer func() { p.noStructLiteral = prev }()
+
+	conds := []string{}
+	for _, stmt := range stmts {
+		conds = append(conds, p.statement(stmt))
+	}
+	return strings.Join(conds, "; ")
+}
+
+// block prints a braced block. A block written on one line with at most one
+// simple statement stays on one line.
+func (p *printer) block(b *ast.BlockStatement) string {
+	prev := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prev }()
+
+	// a comment runs to the end of its line, so none can be inside a block on one line
+	if b.Token.Line == b.End.Line && len(b.Statements) <= 1 {
+		if len(b.Statements) == 0 {
+			return "{}"
+		}
+		if simple(b.Statements[0]) {
+			p.depth++
+			text := p.statement(b.Statements[0])
+			p.depth--
+			if !strings.Contains(text, "\n") {
+				return "{ " + text + " }"
+			}
+			// a match spreads over lines even when written on one
+			return "{\n" + p.indent() + indentUnit + text + "\n" + p.indent() + "}"
+		}
+	}
+
+	p.depth++
+	lines := p.lines(b.Statements, b.End.Line)
+	p.depth--
+	if len(lines) == 0 {
+		return "{}"
+	}
+	return "{\n" + strings.Join(lines, "\n") + "\n" + p.indent() + "}"
+}
+
+func (p *printer) expression(exp ast.Expression) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Value
+
+	case *ast.IntegerLiteral, *ast.Boolean:
+		return exp.TokenLiteral()
+
+	case *ast.FloatLiteral:
+		if !strings.Contains(exp.Token.Literal, ".") { // the lexer drops the dot of `1.`
+			return exp.Token.Literal + ".0"
+		}
+		return exp.Token.Literal
+
+	case *ast.StringLiteral:
+		return "\"" + exp.Token.Literal + "\""
+
+	case *ast.PrefixExpression:
+		if _, ok := exp.Right.(*ast.InfixExpression); ok {
+			return exp.Operator + p.group(exp.Right)
+		}
+		return exp.Operator + p.expression(exp.Right)
+
+	case *ast.InfixExpression:
+		// operators are left associative, so an equal one on the right needs parentheses
+		prec := parser.Precedence(exp.Token.Type)
+		return p.operatorOperand(exp.Left, prec-1) + " " + exp.Operator + " " + p.operatorOperand(exp.Right, prec)
+
+	case *ast.CallExpression:
+		return p.operand(exp.Function) + "(" + p.list(exp.Arguments) + ")"
+
+	case *ast.IndexExpression:
+		return p.operand(exp.Left) + "[" + p.expression(exp.Index) + "]"
+
+	case *ast.SliceIndex:
+		slice := p.bound(exp.Start) + ":" + p.bound(exp.End)
+		if exp.Step != nil {
+			slice += ":" + p.expression(exp.Step)
+		}
+		return slice
+
+	case *ast.FieldAccessExpression:
+		return p.operand(exp.Left) + "." + exp.Field.Value
+
+	case *ast.ArrayLiteral:
+		if len(exp.Elements) == 0 && exp.ExplicitType != nil {
+			return "[]" + exp.ExplicitType.String()
+		}
+		if p.commentedWithin(exp.Token, exp.End) {
+			items := []interface{}{}
+			for _, el := range exp.Elements {
+				items = append(items, el)
+			}
+			return p.spread("[", items, func(idx int) string { return p.expression(exp.Elements[idx]) }, exp.End)
+		}
+		return "[" + p.list(exp.Elements) + "]"
+
+	case *ast.DictLiteral:
+		if len(exp.Keys) == 0 && exp.ExplicitType != nil {
+			return "{}" + exp.ExplicitType.String()
+		}
+		if p.commentedWithin(exp.Token, exp.End) {
+			items := []interface{}{}
+			for _, key := range exp.Keys {
+				items = append(items, []ast.Expression{key, exp.Pairs[key]})
+			}
+			return p.spread("{", items, func(idx int) string {
+				key := exp.Keys[idx]
+				return p.expression(key) + ": " + p.expression(exp.Pairs[key])
+			}, exp.End)
+		}
+		pairs := []string{}
+		for _, key := range exp.Keys {
+			pairs = append(pairs, p.expression(key)+": "+p.expression(exp.Pairs[key]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+
+	case *ast.StructLiteral:
+		fields := []string{}
+		for idx, f := range exp.FieldNames {
+			fields = append(fields, f.Value+": "+p.expression(exp.Values[idx]))
+		}
+		lit := exp.Name.Value + "{" + strings.Join(fields, ", ") + "}"
+		if p.noStructLiteral {
+			return "(" + lit + ")"
+		}
+		return lit
+
+	case *ast.FunctionLiteral:
+		out := "fn"
+		if len(exp.TypeParams) > 0 {
+			typeParams := []string{}
+			for _, tp := range exp.TypeParams {
+				typeParams = append(typeParams, tp.Value)
+			}
+			out += "[" + strings.Join(typeParams, ", ") + "]"
+		}
+		params := []string{}
+		for idx, param := range exp.Parameters {
+			params = append(params, param.Value+": "+exp.ParamTypes[idx].String())
+		}
+		return out + "(" + strings.Join(params, ", ") + ") -> " + exp.ReturnType.String() + " " + p.block(exp.Body)
+
+	case *ast.IfExpression:
+		return p.conditional("ife", exp.Condition, exp.TrueBranch, exp.ElifConditions, exp.ElifBranches, exp.FalseBranch)
+
+	case *ast.TryExpression:
+		return "try " + p.block(exp.Body) + " catch " + exp.ErrorName.Value + " " + p.block(exp.Handler)
+
+	case *ast.MatchExpression:
+		return p.match(exp)
+
+	default:
+		return exp.String()
+	}
+}
+
+// match prints a match expression with one arm per line
+func (p *printer) match(exp *ast.MatchExpression) string {
+	prev := p.noStructLiteral
+	p.noStructLiteral = true
+	subject := p.expression(exp.Subject)
+	p.noStructLiteral = prev
+
+	p.depth++
+	arms := []string{}
+	for idx, arm := range exp.Arms {
+		for _, c := range p.commentsBefore(arm.Variant.Token.Line) {
+			arms = append(arms, p.indent()+c.text)
+		}
+		_, last := span(arm)
+
+		pattern := arm.Variant.Value
+		if len(arm.Bindings) > 0 {
+			bindings := []string{}
+			for _, b := range arm.Bindings {
+				bindings = append(bindings, b.Value)
+			}
+			pattern += "(" + strings.Join(bindings, ", ") + ")"
+		}
+
+		var body string
+		if arm.Body.Token.Type == token.LBRACE {
+			body = p.block(arm.Body)
+		} else { // an expression the parser wrapped in a block
+			body = p.statement(arm.Body.Statements[0])
+		}
+		line := p.indent() + pattern + " => " + body + ","
+
+		nextOnLastLine := idx+1 < len(exp.Arms) && exp.Arms[idx+1].Variant.Token.Line == last
+		if len(p.comments) > 0 && p.comments[0].Line == last && !nextOnLastLine {
+			line += " " + p.comments[0].Literal
+			p.comments = p.comments[1:]
+		}
+		arms = append(arms, line)
+	}
+	for _, c := range p.commentsBefore(exp.End.Line) {
+		arms = append(arms, p.indent()+c.text)
+	}
+	p.depth--
+
+	return "match " + subject + " {\n" + strings.Join(arms, "\n") + "\n" + p.indent() + "}"
+}
+
+// commentedWithin reports whether a comment not yet printed is on a line from
+// that of open up to that of the closing end, after which it would follow end
+func (p *printer) commentedWithin(open, end token.Token) bool {
+	return len(p.comments) > 0 && p.comments[0].Line >= open.Line && p.comments[0].Line < end.Line
+}
+
+// spread prints the items of an array or dict literal one per line, by
+// print, so the comments among them are kept in place
+func (p *printer) spread(open string, items []interface{}, print func(idx int) string, end token.Token) string {
+	prev := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prev }()
+
+	p.depth++
+	lines := []string{}
+	for idx, it := range items {
+		first, last := span(it)
+		for _, c := range p.commentsBefore(first) {
+			lines = append(lines, p.indent()+c.text)
+		}
+		line := p.indent() + print(idx)
+		if idx+1 < len(items) {
+			line += ","
+		}
+
+		nextOnLastLine := false
+		if idx+1 < len(items) {
+			next, _ := span(items[idx+1])
+			nextOnLastLine = next == last
+		}
+		if len(p.comments) > 0 && p.comments[0].Line == last && !nextOnLastLine {
+			line += " " + p.comments[0].Literal
+			p.comments = p.comments[1:]
+		}
+		lines = append(lines, line)
+	}
+	for _, c := range p.commentsBefore(end.Line) {
+		lines = append(lines, p.indent()+c.text)
+	}
+	p.depth--
+
+	return open + "\n" + strings.Join(lines, "\n") + "\n" + p.indent() + end.Literal
+}
+
+// group prints exp in parentheses, inside which the parser allows struct
+// literals again
+func (p *printer) group(exp ast.Expression) string {
+	prev := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prev }()
+	return "(" + p.expression(exp) + ")"
+}
+
+// operatorOperand prints an operand of an infix operator, parenthesized if
+// it is itself an infix expression binding no tighter than prec
+func (p *printer) operatorOperand(exp ast.Expression, prec int) string {
+	if inner, ok := exp.(*ast.InfixExpression); ok && parser.Precedence(inner.Token.Type) <= prec {
+		return p.group(exp)
+	}
+	return p.expression(exp)
+}
+
+// operand prints the left side of a call, index or field access, which binds
+// tighter than any operator
+func (p *printer) operand(exp ast.Expression) string {
+	switch exp.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression:
+		return p.group(exp)
+	}
+	return p.expression(exp)
+}
+
+// bound prints a bound of a slice, which is empty where it is omitted
+func (p *printer) bound(exp ast.Expression) string {
+	if exp == nil {
+		return ""
+	}
+	return p.expression(exp)
+}
+
+// list prints the comma separated arguments of a call or array literal
+func (p *printer) list(exps []ast.Expression) string {
+	prev := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prev }()
+
+	out := []string{}
+	for _, exp := range exps {
+		out = append(out, p.expression(exp))
+	}
+	return strings.Join(out, ", ")
+}
+
+// simple reports whether stmt can sit on one line inside braces
+func simple(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ExpressionStatement, *ast.AssignStatement, *ast.ReturnStatement,
+		*ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	}
+	return false
+}
+
+// needsSemicolon reports whether stmt ends in an expression that the first
+// token of a following statement could continue
+func needsSemicolon(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ExpressionStatement, *ast.AssignStatement, *ast.ReturnStatement:
+		return true
+	}
+	return false
+}
+
+// startsExpression reports whether text begins with a token that can both
+// start a statement and continue an expression
+func startsExpression(text string) bool {
+	return text != "" && strings.ContainsRune("-([{", rune(text[0]))
+}
+
+func nextStatement(items []item) string {
+	for _, it := range items {
+		if it.stmt != nil {
+			return it.text
+		}
+	}
+	return ""
+}
+
+func firstLine(node ast.Node) int {
+	first, _ := span(node)
+	return first
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// span returns the first and last source lines of the tokens in node, an AST
+// node or part of one. It walks the node's fields, so it needs no updating as
+// the AST grows.
+func span(node interface{}) (int, int) {
+	first, last := math.MaxInt, 0
+	var visit func(v reflect.Value)
+	visit = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !v.IsNil() {
+				visit(v.Elem())
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				visit(v.Index(i))
+			}
+		case reflect.Map:
+			for iter := v.MapRange(); iter.Next(); {
+				visit(iter.Key())
+				visit(iter.Value())
+			}
+		case reflect.Struct:
+			if v.Type() == tokenType {
+				if line := int(v.FieldByName("Line").Int()); line > 0 {
+					first, last = min(first, line), max(last, line)
+				}
+				return
+			}
+			if v.Type().PkgPath() != "glimmer/ast" {
+				return // types carry no positions
+			}
+			for i := 0; i < v.NumField(); i++ {
+				visit(v.Field(i))
+			}
+		}
+	}
+	visit(reflect.ValueOf(node))
+	if last == 0 {
+		return 0, 0
+	}
+	return first, last
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
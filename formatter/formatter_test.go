@@ -0,0 +1,201 @@
+package formatter
+
+import (
+	"glimmer/lexer"
+	"glimmer/parser"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x=1;y=x+2", "x = 1\ny = x + 2\n"},
+		{"x  +=  (1)", "x += 1\n"},
+		{"y = (x+2)*3-(4-1)", "y = (x + 2) * 3 - (4 - 1)\n"},
+		{"y = x - (a - b)", "y = x - (a - b)\n"},
+		{"y = (x - a) - b", "y = x - a - b\n"},
+		{"z = -(x+1) * !(a)", "z = -(x + 1) * !a\n"},
+		{"w = (f | g)(1)", "w = (f | g)(1)\n"},
+		{"a = [1,2,3] ; [4,5][0]", "a = [1, 2, 3];\n[4, 5][0]\n"},
+		{"a = 1; -2", "a = 1;\n-2\n"},
+		{"e = []int", "e = []int\n"},
+		{"d = {}int; d[\"a\"]+=1", "d = {}int\nd[\"a\"] += 1\n"},
+		{"b = a[1 : n-1]; c = a[::-1]; d = a[:(n)]", "b = a[1:n - 1]\nc = a[::-1]\nd = a[:n]\n"},
+		{"x = (a+1) in xs; y = a not  in (xs)", "x = a + 1 in xs\ny = a not in xs\n"},
+		{"f = 1.", "f = 1.0\n"},
+		{`d = {"a":1,"b":2}`, "d = {\"a\": 1, \"b\": 2}\n"},
+		{"struct Point {x: int,y: int}\np = Point{x:1,y:2}",
+			"struct Point { x: int, y: int }\np = Point{x: 1, y: 2}\n"},
+		{"if p == (Point{x:1,y:2}) { p.x }", "if p == (Point{x: 1, y: 2}) { p.x }\n"},
+		{"for i, v in a { print(i+v) }", "for i, v in a { print(i + v) }\n"},
+		{"while x < 10 {\nx += 1\n}", "while x < 10 {\n    x += 1\n}\n"},
+		{"f = fn[T](v: T, n: int) -> array[T] { [v] }", "f = fn[T](v: T, n: int) -> array[T] { [v] }\n"},
+		{"v = ife x {1} else ife y {2} else {3}", "v = ife x { 1 } else ife y { 2 } else { 3 }\n"},
+		{"r = try { throw(\"x\"); 1 } catch e { 2 }", "r = try {\n    throw(\"x\")\n    1\n} catch e { 2 }\n"},
+		{"import \"lib.gli\" as lib", "import \"lib.gli\" as lib\n"},
+		{"test  \"adds\"  {assert_eq(1+1, 2)}", "test \"adds\" { assert_eq(1 + 1, 2) }\n"},
+		{"enum Shape { Circle(float), Empty }\na = match s { Circle(r) => r * r, Empty => { 0.0 } }",
+			"enum Shape { Circle(float), Empty }\na = match s {\n    Circle(r) => r * r,\n    Empty => { 0.0 },\n}\n"},
+		{"f = fn() -> int {\n\n\n  x = 1\n\n\n\n  x\n}", "f = fn() -> int {\n    x = 1\n\n    x\n}\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got, errs := Format(tt.input)
+		if len(errs) != 0 {
+			t.Errorf("Format(%q) returned errors: %v", tt.input, errs)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("wrong format of %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	input := `# header
+
+x=1   # trailing
+if x > 0 { # opens
+  # inside
+  print(x) # call
+  # closing
+}
+f = fn() -> int { 1 } # one line
+m = match s {
+  # first
+  A => 1,
+  B => 2, # second
+  # last
+}
+# the end`
+
+	expected := `# header
+
+x = 1 # trailing
+if x > 0 {
+    # opens
+    # inside
+    print(x) # call
+    # closing
+}
+f = fn() -> int { 1 } # one line
+m = match s {
+    # first
+    A => 1,
+    B => 2, # second
+    # last
+}
+# the end
+`
+
+	got, errs := Format(input)
+	if len(errs) != 0 {
+		t.Fatalf("Format returned errors: %v", errs)
+	}
+	if got != expected {
+		t.Errorf("wrong format.\nexpected=%s\ngot=%s", expected, got)
+	}
+	if again, _ := Format(got); again != got {
+		t.Errorf("formatting comments is not idempotent.\nonce=%s\ntwice=%s", got, again)
+	}
+}
+
+func TestFormatCommentsInLiterals(t *testing.T) {
+	input := `xs = [ # opens
+  1, # one
+  # before two
+  2,3
+  # closing
+]
+d = {
+  "a": [1, 2], # a
+  "b": [
+    3 # three
+  ]
+}
+ys = [1,
+  2] # after`
+
+	expected := `xs = [
+    # opens
+    1, # one
+    # before two
+    2,
+    3
+    # closing
+]
+d = {
+    "a": [1, 2], # a
+    "b": [
+        3 # three
+    ]
+}
+ys = [1, 2] # after
+`
+
+	got, errs := Format(input)
+	if len(errs) != 0 {
+		t.Fatalf("Format returned errors: %v", errs)
+	}
+	if got != expected {
+		t.Errorf("wrong format.\nexpected=%s\ngot=%s", expected, got)
+	}
+	if again, _ := Format(got); again != got {
+		t.Errorf("formatting comments in literals is not idempotent.\nonce=%s\ntwice=%s", got, again)
+	}
+	if original, formatted := parse(t, input), parse(t, got); original != formatted {
+		t.Errorf("formatting changed the AST.\nbefore=%s\nafter=%s", original, formatted)
+	}
+}
+
+func TestFormatIsIdempotentAndPreservesAST(t *testing.T) {
+	inputs := []string{
+		`n = 20
+
+fib = fn(fibnum: int) -> int {
+    ife fibnum == 0 { 0 } else ife fibnum == 1 {
+        1
+    } else { fib(fibnum - 1) + fib(fibnum-2) }
+}
+print(fib(n))`,
+		"a = [1,2] ;  [3][0]; x = -1 ;-x",
+		"d = {\"k\": [1, 2] | len, \"j\": -(1 - 2) * 3}; d[\"k\"]",
+		"for x in range(10) { if x == (P{a: 1}).a { continue } else { break } }",
+		"area = fn(s: Shape) -> float { match s { Circle(r) => r * r, _ => { 0.0 } } } # area",
+		"g = fn[T](f: fn(T) -> T, x: T) -> T { f(f(x)) }\ng(fn(x: int) -> int { x * 2 }, 3)",
+		"r = try { throw(\"a\") } catch e { e + \"!\" }\n\n\n# tail",
+	}
+
+	for _, input := range inputs {
+		once, errs := Format(input)
+		if len(errs) != 0 {
+			t.Fatalf("Format(%q) returned errors: %v", input, errs)
+		}
+		twice, _ := Format(once)
+		if once != twice {
+			t.Errorf("formatting %q is not idempotent.\nonce=%s\ntwice=%s", input, once, twice)
+		}
+		if original, formatted := parse(t, input), parse(t, once); original != formatted {
+			t.Errorf("formatting %q changed the AST.\nbefore=%s\nafter=%s", input, original, formatted)
+		}
+	}
+}
+
+func TestFormatParserErrors(t *testing.T) {
+	_, errs := Format("x = (1 + 2")
+	if len(errs) != 1 || errs[0] != "[1,11]: expected next token to be ), got EOF instead" {
+		t.Errorf("wrong errors. got=%v", errs)
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
@@ -1,8 +1,14 @@
 module glimmer
 
-go 1.17
+go 1.18
 
 require (
 	github.com/bradleyjkemp/memviz v0.2.3
 	github.com/pborman/getopt/v2 v2.1.0
+	github.com/peterh/liner v1.2.2
+)
+
+require (
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	golang.org/x/sys v0.0.0-20211117180635-dee7805ff2e1 // indirect
 )
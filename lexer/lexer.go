@@ -12,6 +12,8 @@ type Lexer struct {
 	line         int  // current line number
 	linePosition int  // current position on a given line (set to zero after each newline)
 	ch           byte // current char under examination
+
+	comments []token.Token // the comments skipped so far, for the formatter
 }
 
 func New(input string) *Lexer {
@@ -41,6 +43,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal, Line: l.line, Col: l.linePosition}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.FATARROW, Literal: literal, Line: l.line, Col: l.linePosition}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch, l.line, l.linePosition)
 		}
@@ -54,6 +61,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAR, l.ch, l.line, l.linePosition)
 	case ',':
 		tok = newToken(token.COMMA, l.ch, l.line, l.linePosition)
+	case '.':
+		tok = newToken(token.DOT, l.ch, l.line, l.linePosition)
 	case '+':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -150,11 +159,14 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch, l.line, l.linePosition)
 	case '#':
+		line, col, start := l.line, l.linePosition, l.position
 		ch := l.ch
 		for ch != '\n' && ch != 0 {
 			l.readChar()
 			ch = l.ch
 		}
+		text := strings.TrimRight(l.input[start:l.position], " \t\r")
+		l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: text, Line: line, Col: col})
 		tok = l.NextToken()
 		return tok // l pos has already been incremented. early exit.
 	case '"':
@@ -189,6 +201,20 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// Comments returns the comments the lexer has skipped over, in source order.
+// The parser never sees them.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// PeekToken returns the token after the current one without reading it
+func (l *Lexer) PeekToken() token.Token {
+	saved := *l
+	tok := l.NextToken()
+	*l = saved
+	return tok
+}
+
 func (l *Lexer) SkipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		if l.ch == '\n' {
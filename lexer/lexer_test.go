@@ -7,7 +7,7 @@ import (
 )
 
 func TestNextToken(t *testing.T) {
-	input := "for in if ife += -= *= /= for break continue : ==!==!abc+-,; # this is a line comment \n \t\r ()/*><{}100 123.456 123. fn -> $ \x00 = && & || <= >= | \"foobar\" \"foo\t\t\tbar\" [1, 2]; int float bool string array dict none"
+	input := "for in not if ife += -= *= /= for break continue : ==!==!abc+-,; # this is a line comment \n \t\r ()/*><{}100 123.456 123. fn -> $ \x00 = && & || <= >= | \"foobar\" \"foo\t\t\tbar\" [1, 2]; int float bool string array dict none struct p.x import as try catch enum match =>"
 
 	tests := []struct {
 		expectedType    token.TokenType
@@ -15,6 +15,7 @@ func TestNextToken(t *testing.T) {
 	}{
 		{token.FOR, "for"},
 		{token.IN, "in"},
+		{token.ID, "not"},
 		{token.IF, "if"},
 		{token.IFE, "ife"},
 		{token.PLUSEQ, "+="},
@@ -71,6 +72,17 @@ func TestNextToken(t *testing.T) {
 		{token.ARRAY_TYPE, "array"},
 		{token.DICT_TYPE, "dict"},
 		{token.NONE_TYPE, "none"},
+		{token.STRUCT, "struct"},
+		{token.ID, "p"},
+		{token.DOT, "."},
+		{token.ID, "x"},
+		{token.IMPORT, "import"},
+		{token.AS, "as"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.ENUM, "enum"},
+		{token.MATCH, "match"},
+		{token.FATARROW, "=>"},
 		{token.EOF, ""},
 	}
 	lex := New(input)
@@ -87,3 +99,61 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestComments(t *testing.T) {
+	input := "# first\nx = 1 # second  \r\n\"# not a comment\" #"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedCol     int
+	}{
+		{"# first", 1, 1},
+		{"# second", 2, 7},
+		{"#", 3, 19},
+	}
+
+	lex := New(input)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		if tok.Type == token.COMMENT {
+			t.Fatalf("NextToken returned a comment: %+v", tok)
+		}
+	}
+
+	comments := lex.Comments()
+	if len(comments) != len(tests) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d: %+v", len(tests), len(comments), comments)
+	}
+	for i, tt := range tests {
+		c := comments[i]
+		if c.Type != token.COMMENT || c.Literal != tt.expectedLiteral || c.Line != tt.expectedLine || c.Col != tt.expectedCol {
+			t.Errorf("comments[%d] wrong. expected=%q at [%d,%d], got=%+v",
+				i, tt.expectedLiteral, tt.expectedLine, tt.expectedCol, c)
+		}
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	seeds := []string{
+		"x = 1 + 2.5 * -3",
+		`s = "a\tb" + "c"; s[0]`,
+		"fn(x: int) -> int { x } # comment",
+		"{\"a\": [1, 2]} | len()",
+		"\"unterminated",
+		"1.2.3 && || ! != <= >=",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		lex := New(input)
+		// every token but EOF consumes at least a character
+		for i := 0; i <= len(input); i++ {
+			if lex.NextToken().Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("no EOF after %d tokens of %q", len(input)+1, input)
+	})
+}
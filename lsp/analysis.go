@@ -0,0 +1,136 @@
+package lsp
+
+import (
+	"glimmer/diagnostics"
+	"glimmer/lexer"
+	"glimmer/modules"
+	"glimmer/parser"
+	"glimmer/token"
+	"glimmer/typechecker"
+	"glimmer/types"
+	"net/url"
+	"sort"
+)
+
+// record is an identifier the typechecker resolved, with its type and the
+// identifier that defined it (the zero Token for struct fields and module
+// members, which have no definition in the document)
+type record struct {
+	ident token.Token
+	typ   types.TypeNode
+	def   token.Token
+}
+
+// analysis is what the server knows about one version of a document
+type analysis struct {
+	diagnostics []Diagnostic
+	records     []record
+}
+
+// analyze parses and typechecks the text of the document at uri, reporting
+// every type error it has.
+func analyze(uri, text string) *analysis {
+	a := &analysis{diagnostics: []Diagnostic{}}
+
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, diag := range p.Diagnostics() {
+			a.diagnostics = append(a.diagnostics, toDiagnostic(diag))
+		}
+		return a
+	}
+
+	ctx := modules.NewLoader(modules.SearchPathFromEnv()).NewContext(pathOf(uri))
+	ctx.SetRecorder(func(ident token.Token, typ types.TypeNode, def token.Token) {
+		a.records = append(a.records, record{ident: ident, typ: typ, def: def})
+	})
+
+	for _, err := range typechecker.Check(program, ctx) {
+		a.diagnostics = append(a.diagnostics, toDiagnostic(err.Diagnostic(text)))
+	}
+
+	return a
+}
+
+func toDiagnostic(diag diagnostics.Diagnostic) Diagnostic {
+	return Diagnostic{Range: spanRange(diag.Span), Severity: severityError, Source: "glimmer", Message: diag.Message}
+}
+
+// at returns the innermost recorded identifier at pos
+func (a *analysis) at(pos Position) (record, bool) {
+	for i := len(a.records) - 1; i >= 0; i-- {
+		if tokenRange(a.records[i].ident).contains(pos) {
+			return a.records[i], true
+		}
+	}
+	return record{}, false
+}
+
+// definitions returns the type of every name bound in the document, by name.
+// Names bound in several scopes keep their last type.
+func (a *analysis) definitions() map[string]types.TypeNode {
+	defs := make(map[string]types.TypeNode)
+	for _, rec := range a.records {
+		if rec.ident == rec.def {
+			defs[rec.ident.Literal] = rec.typ
+		}
+	}
+	return defs
+}
+
+func (a *analysis) completions() []CompletionItem {
+	items := []CompletionItem{}
+
+	defs := a.definitions()
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		kind := completionKindVariable
+		if defs[name].Type() == types.FUNCTION {
+			kind = completionKindFunction
+		}
+		items = append(items, CompletionItem{Label: name, Kind: kind, Detail: defs[name].String()})
+	}
+
+	for _, name := range typechecker.Builtins() {
+		if _, ok := defs[name]; !ok {
+			items = append(items, CompletionItem{Label: name, Kind: completionKindFunction, Detail: "builtin"})
+		}
+	}
+
+	return items
+}
+
+// tokenRange returns the zero-based range of tok
+func tokenRange(tok token.Token) Range {
+	return spanRange(diagnostics.TokenSpan(tok))
+}
+
+// spanRange converts the 1-based, inclusive columns of span to a zero-based
+// range ending after its last character
+func spanRange(span diagnostics.Span) Range {
+	return Range{Start: Position{Line: max(span.Start.Line-1, 0), Character: max(span.Start.Col-1, 0)},
+		End: Position{Line: max(span.End.Line-1, 0), Character: max(span.End.Col, 0)}}
+}
+
+// pathOf returns the file path of a file:// uri, or "" for other schemes,
+// whose imports resolve relative to the working directory
+func pathOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
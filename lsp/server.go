@@ -0,0 +1,215 @@
+// Package lsp implements a Language Server Protocol server for glimmer over
+// stdio, publishing parse and type errors as diagnostics and answering hover,
+// go-to-definition and completion requests from the typechecker's results.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*analysis // open documents by uri
+	err  error                // the first failed write, which ends Run
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*analysis)}
+}
+
+// Serve runs a server on in and out until the client sends exit or closes in
+func Serve(in io.Reader, out io.Writer) error {
+	return NewServer(in, out).Run()
+}
+
+func (s *Server) Run() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.respond(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			if s.err != nil {
+				return s.err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		if req.ID != nil { // notifications are not answered
+			s.respond(req.ID, result, rerr)
+		}
+		if s.err != nil {
+			return s.err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		res := initializeResult{Capabilities: serverCapabilities{
+			TextDocumentSync:   syncFull,
+			HoverProvider:      true,
+			DefinitionProvider: true,
+			CompletionProvider: struct{}{},
+		}}
+		res.ServerInfo.Name = "glimmer"
+		return res, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// full sync: the last change holds the whole document
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.update(params.TextDocument.URI, text)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.publish(params.TextDocument.URI, []Diagnostic{})
+		return nil, nil
+
+	case "textDocument/hover":
+		rec, ok, rerr := s.lookup(req.Params)
+		if rerr != nil || !ok {
+			return nil, rerr
+		}
+		hover := Hover{Range: tokenRange(rec.ident), Contents: markupContent{Kind: "plaintext",
+			Value: fmt.Sprintf("%s: %s", rec.ident.Literal, rec.typ.String())}}
+		return hover, nil
+
+	case "textDocument/definition":
+		rec, ok, rerr := s.lookup(req.Params)
+		if rerr != nil || !ok || rec.def.Line == 0 {
+			return nil, rerr
+		}
+		var params textDocumentPositionParams
+		json.Unmarshal(req.Params, &params) // already checked by lookup
+		return Location{URI: params.TextDocument.URI, Range: tokenRange(rec.def)}, nil
+
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			doc = &analysis{}
+		}
+		return doc.completions(), nil
+
+	default:
+		if req.ID == nil || strings.HasPrefix(req.Method, "$/") || req.Method == "initialized" {
+			return nil, nil
+		}
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+// update reanalyzes the document at uri and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	doc := analyze(uri, text)
+	s.docs[uri] = doc
+	s.publish(uri, doc.diagnostics)
+}
+
+// lookup finds the recorded identifier at the position of a request
+func (s *Server) lookup(raw json.RawMessage) (record, bool, *responseError) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return record{}, false, invalidParams(err)
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return record{}, false, nil
+	}
+	rec, ok := doc.at(params.Position)
+	return rec, ok, nil
+}
+
+func (s *Server) publish(uri string, diagnostics []Diagnostic) {
+	s.write(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+		Params: publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics}})
+}
+
+func (s *Server) respond(id *json.RawMessage, result interface{}, rerr *responseError) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result, Error: rerr})
+}
+
+// read returns the body of the next message, framed by a Content-Length header
+func (s *Server) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends msg framed by a Content-Length header, recording any failure
+func (s *Server) write(msg interface{}) {
+	if s.err != nil {
+		return
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false) // types print arrows, as in fn(int) -> int
+	if s.err = enc.Encode(msg); s.err != nil {
+		return
+	}
+	_, s.err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", body.Len(), body.Bytes())
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
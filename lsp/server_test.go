@@ -0,0 +1,188 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///tmp/main.gli"
+
+// session frames each message as a client would, runs a server over them and
+// returns the messages it sent back, in order
+func session(t *testing.T, msgs ...string) []map[string]interface{} {
+	var in bytes.Buffer
+	for _, msg := range msgs {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+
+	var out bytes.Buffer
+	if err := Serve(&in, &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	replies := []map[string]interface{}{}
+	srv := &Server{in: bufio.NewReader(&out)}
+	for {
+		body, err := srv.read()
+		if err != nil {
+			break
+		}
+		var reply map[string]interface{}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatalf("invalid reply %q: %v", body, err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func didOpen(text string) string {
+	params, _ := json.Marshal(map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI, "languageId": "glimmer", "text": text},
+	})
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":%s}`, params)
+}
+
+func positionRequest(id int, method string, line, char int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}}}`,
+		id, method, testURI, line, char)
+}
+
+func toJSON(v interface{}) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSpace(b.String())
+}
+
+func TestInitialize(t *testing.T) {
+	replies := session(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown/method"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`, // never read
+	)
+
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 replies, got=%d: %v", len(replies), replies)
+	}
+
+	caps := toJSON(replies[0]["result"].(map[string]interface{})["capabilities"])
+	expected := `{"completionProvider":{},"definitionProvider":true,"hoverProvider":true,"textDocumentSync":1}`
+	if caps != expected {
+		t.Errorf("wrong capabilities. expected=%s, got=%s", expected, caps)
+	}
+
+	if code := replies[1]["error"].(map[string]interface{})["code"]; code != float64(codeMethodNotFound) {
+		t.Errorf("expected method not found error, got=%v", replies[1])
+	}
+
+	if replies[2]["id"] != float64(3) || replies[2]["result"] != nil {
+		t.Errorf("wrong shutdown reply: %v", replies[2])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1\ny = x + 2", `[]`},
+		{"x = 1\ny = x - \"a\"",
+			`[{"message":"infix operator for 'int - string' not found","range":{"end":{"character":7,"line":1},"start":{"character":6,"line":1}},"severity":1,"source":"glimmer"}]`},
+		{"x = (1 + 2",
+			`[{"message":"expected next token to be ), got EOF instead","range":{"end":{"character":11,"line":0},"start":{"character":10,"line":0}},"severity":1,"source":"glimmer"}]`},
+	}
+
+	for _, tt := range tests {
+		replies := session(t, didOpen(tt.input))
+		if len(replies) != 1 || replies[0]["method"] != "textDocument/publishDiagnostics" {
+			t.Fatalf("expected diagnostics for %q, got=%v", tt.input, replies)
+		}
+		params := replies[0]["params"].(map[string]interface{})
+		if got := toJSON(params["diagnostics"]); got != tt.expected {
+			t.Errorf("wrong diagnostics for %q.\nexpected=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDiagnosticsFollowChanges(t *testing.T) {
+	change := fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":%q,"version":2},"contentChanges":[{"text":"x = 1"}]}}`, testURI)
+	closing := fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":%q}}}`, testURI)
+
+	replies := session(t, didOpen("x = y"), change, closing)
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 notifications, got=%d: %v", len(replies), replies)
+	}
+
+	expected := []int{1, 0, 0}
+	for i, reply := range replies {
+		diagnostics := reply["params"].(map[string]interface{})["diagnostics"].([]interface{})
+		if len(diagnostics) != expected[i] {
+			t.Errorf("notification %d: expected %d diagnostics, got=%v", i, expected[i], diagnostics)
+		}
+	}
+}
+
+func TestHoverAndDefinition(t *testing.T) {
+	input := `add = fn(a: int, b: int) -> int {
+    a + b
+}
+total = add(1, 2)
+label = "sum"`
+
+	tests := []struct {
+		method     string
+		line, char int
+		expected   string
+	}{
+		{"textDocument/hover", 3, 0, `{"contents":{"kind":"plaintext","value":"total: int"},"range":{"end":{"character":5,"line":3},"start":{"character":0,"line":3}}}`},
+		{"textDocument/hover", 3, 9, `{"contents":{"kind":"plaintext","value":"add: fn(int, int) -> int"},"range":{"end":{"character":11,"line":3},"start":{"character":8,"line":3}}}`},
+		{"textDocument/hover", 1, 4, `{"contents":{"kind":"plaintext","value":"a: int"},"range":{"end":{"character":5,"line":1},"start":{"character":4,"line":1}}}`},
+		{"textDocument/hover", 4, 10, `null`},
+		{"textDocument/definition", 3, 9, `{"range":{"end":{"character":3,"line":0},"start":{"character":0,"line":0}},"uri":"file:///tmp/main.gli"}`},
+		{"textDocument/definition", 1, 8, `{"range":{"end":{"character":18,"line":0},"start":{"character":17,"line":0}},"uri":"file:///tmp/main.gli"}`},
+		{"textDocument/definition", 2, 0, `null`},
+	}
+
+	for i, tt := range tests {
+		replies := session(t, didOpen(input), positionRequest(i, tt.method, tt.line, tt.char))
+		if len(replies) != 2 {
+			t.Fatalf("expected diagnostics and a reply, got=%v", replies)
+		}
+		if got := toJSON(replies[1]["result"]); got != tt.expected {
+			t.Errorf("wrong %s at %d:%d.\nexpected=%s\ngot=%s", tt.method, tt.line, tt.char, tt.expected, got)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	replies := session(t, didOpen("count = 1\nsquare = fn(n: int) -> int { n * n }"),
+		positionRequest(1, "textDocument/completion", 1, 0))
+
+	items := replies[1]["result"].([]interface{})
+	labels := []string{}
+	for _, item := range items {
+		labels = append(labels, item.(map[string]interface{})["label"].(string))
+	}
+	got := strings.Join(labels, " ")
+
+	for _, expected := range []string{"count n square", "len", "print", "throw"} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("completions %q do not contain %q", got, expected)
+		}
+	}
+
+	first := toJSON(items[0])
+	expected := `{"detail":"int","kind":6,"label":"count"}`
+	if first != expected {
+		t.Errorf("wrong completion item. expected=%s, got=%s", expected, first)
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"glimmer/diagnostics"
 	"glimmer/executor"
+	"glimmer/lsp"
+	"glimmer/object"
 	"os"
 
 	"github.com/pborman/getopt/v2"
@@ -14,8 +18,20 @@ func main() {
 	lexFlag := getopt.BoolLong("rlpl", 'l', "launch the Glimmer ReadLexPrintLoop (RLPL)")
 	dotFlag := getopt.BoolLong("dot", 'd', "save the parsed Abstract Syntax Tree as a dotfile and image (infile, repl, and rppl only)")
 	outFlag := getopt.BoolLong("output", 'o', "print the evaluated object of the last statement (file option only)")
+	vmFlag := getopt.BoolLong("vm", 'v', "execute with the bytecode compiler and virtual machine instead of the tree-walking evaluator (infile and repl only)")
+	maxStepsFlag := getopt.Int64Long("max-steps", 0, 0, "stop the program after evaluating this many nodes, 0 for no limit (infile only)")
+	maxDepthFlag := getopt.IntLong("max-depth", 0, 0, "stop the program when function calls nest deeper than this, 0 for no limit (infile only)")
+	maxElementsFlag := getopt.Int64Long("max-elements", 0, 0, "stop the program after allocating this many array and dict elements and string bytes, 0 for no limit (infile only)")
+	timeoutFlag := getopt.DurationLong("timeout", 0, 0, "stop the program after running this long, i.e. 5s, 0 for no limit (infile only)")
+	errorFormatFlag := getopt.EnumLong("error-format", 0, []string{"text", "json"}, "text", "print errors as text with the source line they are on, or as a JSON array on stderr (infile and test only)")
 	getopt.Parse()
 	positionalArgs := getopt.Args()
+	// after "--" the first argument is always the in file, even if it is
+	// named like a command
+	command := ""
+	if len(positionalArgs) > 0 && getopt.CommandLine.State() != getopt.DashDash {
+		command = positionalArgs[0]
+	}
 
 	if moreThanOneServiceSelected(evalFlag, parseFlag, lexFlag) {
 		fmt.Println("Error: only one service must be selected")
@@ -24,19 +40,59 @@ func main() {
 
 	if *evalFlag || (len(positionalArgs) == 0 && !*parseFlag && !*lexFlag) {
 		printService("REPL")
-		executor.StartREPL(os.Stdin, os.Stdout, *dotFlag)
+		executor.StartREPL(os.Stdin, os.Stdout, *dotFlag, *vmFlag)
 	} else if *parseFlag {
 		printService("RPPL")
 		executor.StartRPPL(os.Stdin, os.Stdout, *dotFlag)
 	} else if *lexFlag {
 		printService("RLPL")
 		executor.StartRLPL(os.Stdin, os.Stdout)
+	} else if len(positionalArgs) == 1 && command == "lsp" {
+		// stdout carries the protocol, so no banner
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else if command == "fmt" {
+		fmtSet := getopt.New()
+		writeFlag := fmtSet.BoolLong("write", 'w', "write the result to each file instead of printing it")
+		fmtSet.SetParameters("files...")
+		fmtSet.Parse(positionalArgs)
+		fmtSet.SetProgram("glimmer fmt")
+		if len(fmtSet.Args()) == 0 {
+			fmt.Println("Error: fmt needs at least one file")
+			fmtSet.PrintUsage(os.Stdout)
+			os.Exit(1)
+		}
+		if errs := executor.FormatFiles(fmtSet.Args(), *writeFlag, os.Stdout); len(errs) != 0 {
+			printErrors(errs)
+			os.Exit(1)
+		}
+	} else if len(positionalArgs) == 2 && command == "debug" {
+		printService("Debugger")
+		printErrors(executor.DebugFile(positionalArgs[1], os.Stdin, os.Stdout))
+	} else if len(positionalArgs) <= 2 && command == "test" {
+		dir := "."
+		if len(positionalArgs) == 2 {
+			dir = positionalArgs[1]
+		}
+		ok, errs := executor.TestDir(dir, os.Stdout)
+		reportErrors(errs, *errorFormatFlag)
+		if !ok {
+			os.Exit(1)
+		}
 	} else if len(positionalArgs) == 1 {
-		evaluated, errs := executor.RunFile(positionalArgs[0], *dotFlag)
+		limits := object.Limits{MaxSteps: *maxStepsFlag, MaxCallDepth: *maxDepthFlag, MaxElements: *maxElementsFlag}
+		if *timeoutFlag > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+			defer cancel()
+			limits.Context = ctx
+		}
+		evaluated, errs := executor.RunFile(positionalArgs[0], *dotFlag, *vmFlag, limits)
 		if *outFlag && evaluated != nil {
 			fmt.Println(evaluated.Inspect())
 		}
-		printErrors(errs)
+		reportErrors(errs, *errorFormatFlag)
 	} else {
 		fmt.Println("Error: Only one positional argument <in file> must be given")
 		printUsageAndDie()
@@ -58,6 +114,21 @@ func printErrors(errors []error) {
 	}
 }
 
+// reportErrors prints errors in format, which for "json" is an array of their
+// diagnostics on stderr, empty if there are none
+func reportErrors(errors []error, format string) {
+	if format != "json" {
+		printErrors(errors)
+		return
+	}
+	out, err := diagnostics.JSON(errors)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, string(out))
+}
+
 func moreThanOneServiceSelected(services ...*bool) bool {
 	numSelected := 0
 	for _, service := range services {
@@ -0,0 +1,187 @@
+package modules
+
+import (
+	"fmt"
+	"glimmer/ast"
+	"glimmer/evaluator"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/typechecker"
+	"glimmer/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SearchPathEnv names the environment variable of extra directories (in the
+// os path list format) that imports are resolved against
+const SearchPathEnv = "GLIMMER_PATH"
+
+type Module struct {
+	Path    string
+	Program *ast.Program
+	Ctx     *types.Context
+	env     *object.Environment
+}
+
+// Loader finds, typechecks and evaluates the modules imported by a program.
+// Each file is loaded at most once, however many times it is imported.
+type Loader struct {
+	SearchPath []string
+
+	modules map[string]*Module
+	loading []string // files being typechecked, innermost last
+}
+
+func NewLoader(searchPath []string) *Loader {
+	return &Loader{SearchPath: searchPath, modules: make(map[string]*Module)}
+}
+
+func SearchPathFromEnv() []string {
+	return filepath.SplitList(os.Getenv(SearchPathEnv))
+}
+
+// NewContext returns the root Context for the program in file fpath, whose
+// imports are resolved relative to it. An empty fpath is a program without a
+// file, i.e. a REPL session, importing relative to the working directory.
+func (l *Loader) NewContext(fpath string) *types.Context {
+	ctx := types.NewContext()
+	ctx.SetImporter(l.ContextImporter(l.enterRoot(fpath)))
+	return ctx
+}
+
+// NewEnvironment returns the root Environment for the program in file fpath
+func (l *Loader) NewEnvironment(fpath string) *object.Environment {
+	env := object.NewEnvironment()
+	env.SetImporter(l.EnvironmentImporter(dirOf(fpath)))
+	return env
+}
+
+func (l *Loader) ContextImporter(dir string) types.Importer {
+	return func(path string) (*types.Context, error) {
+		mod, err := l.Load(path, dir)
+		if err != nil {
+			return nil, err
+		}
+		return mod.Ctx, nil
+	}
+}
+
+func (l *Loader) EnvironmentImporter(dir string) object.Importer {
+	return func(path string) (*object.Environment, error) {
+		mod, err := l.Load(path, dir)
+		if err != nil {
+			return nil, err
+		}
+		return l.evaluate(mod)
+	}
+}
+
+// Resolve finds the file imported as path from a file in dir, trying dir
+// first and then each directory of the search path
+func (l *Loader) Resolve(path, dir string) (string, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(dir, path)}
+		for _, searchDir := range l.SearchPath {
+			candidates = append(candidates, filepath.Join(searchDir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return filepath.Abs(candidate)
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", path)
+}
+
+// Load parses and typechecks the module imported as path from dir, or
+// returns it from the cache if it was already loaded
+func (l *Loader) Load(path, dir string) (*Module, error) {
+	fpath, err := l.Resolve(path, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, loading := range l.loading {
+		if loading == fpath {
+			cycle := append([]string{}, l.loading[idx:]...)
+			return nil, cycleError(append(cycle, fpath))
+		}
+	}
+
+	if mod, ok := l.modules[fpath]; ok {
+		return mod, nil
+	}
+
+	content, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	l.loading = append(l.loading, fpath)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("in module %s: %s", filepath.Base(fpath), strings.Join(p.Errors(), "; "))
+	}
+
+	ctx := types.NewContext()
+	ctx.SetImporter(l.ContextImporter(filepath.Dir(fpath)))
+	ctx.SetModule(strings.TrimSuffix(filepath.Base(fpath), filepath.Ext(fpath)))
+	if typ := typechecker.Typeof(program, ctx); typ != nil && typ.Type() == types.ERROR {
+		return nil, fmt.Errorf("in module %s: %s", filepath.Base(fpath), typ.String())
+	}
+
+	mod := &Module{Path: fpath, Program: program, Ctx: ctx}
+	l.modules[fpath] = mod
+	return mod, nil
+}
+
+// evaluate runs a loaded module once, returning its top-level Environment
+func (l *Loader) evaluate(mod *Module) (*object.Environment, error) {
+	if mod.env != nil {
+		return mod.env, nil
+	}
+
+	env := object.NewEnvironment()
+	env.SetImporter(l.EnvironmentImporter(filepath.Dir(mod.Path)))
+
+	if errObj, ok := evaluator.Eval(mod.Program, env).(*object.Error); ok {
+		return nil, fmt.Errorf("in module %s: %s", filepath.Base(mod.Path), errObj.Traceback())
+	}
+
+	mod.env = env
+	return env, nil
+}
+
+// enterRoot marks the file of the program being run as loading, so a module
+// importing it back is reported as a cycle. It returns the file's directory.
+func (l *Loader) enterRoot(fpath string) string {
+	if fpath != "" {
+		if abs, err := filepath.Abs(fpath); err == nil {
+			l.loading = append(l.loading, abs)
+		}
+	}
+	return dirOf(fpath)
+}
+
+func dirOf(fpath string) string {
+	if fpath == "" {
+		return "."
+	}
+	return filepath.Dir(fpath)
+}
+
+func cycleError(cycle []string) error {
+	names := []string{}
+	for _, fpath := range cycle {
+		names = append(names, filepath.Base(fpath))
+	}
+	return fmt.Errorf("import cycle: %s", strings.Join(names, " -> "))
+}
@@ -0,0 +1,136 @@
+package modules
+
+import (
+	"glimmer/evaluator"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/typechecker"
+	"glimmer/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		fpath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// run typechecks and evaluates the file main.gli of dir
+func run(t *testing.T, loader *Loader, dir string) (object.Object, types.TypeNode) {
+	fpath := filepath.Join(dir, "main.gli")
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	typ := typechecker.Typeof(program, loader.NewContext(fpath))
+	if typ.Type() == types.ERROR {
+		return nil, typ
+	}
+	return evaluator.Eval(program, loader.NewEnvironment(fpath)), typ
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.gli": `import "lib/geo.gli" as geo
+import "lib/count.gli" as c1
+import "lib/count.gli" as c2
+p = geo.shift(geo.origin, 3)
+p.x + c1.n * 10 + c2.n * 100`,
+		"lib/geo.gli": `import "math.gli" as math
+struct Point { x: int, y: int }
+origin = Point{x: 0, y: 0}
+shift = fn(p: Point, d: int) -> Point { Point{x: math.add(p.x, d), y: p.y} }`,
+		"lib/math.gli":  "add = fn(a: int, b: int) -> int { a + b }",
+		"lib/count.gli": "n = 1",
+	})
+
+	loader := NewLoader(nil)
+	result, typ := run(t, loader, dir)
+	if typ.Type() == types.ERROR {
+		t.Fatalf("unexpected type error: %s", typ.String())
+	}
+	if result.Inspect() != "113" {
+		t.Errorf("wrong result. want=%q, got=%q", "113", result.Inspect())
+	}
+
+	first, err := loader.Load("lib/count.gli", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loader.Load(filepath.Join(dir, "lib", "count.gli"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("module was loaded twice")
+	}
+}
+
+func TestImportSearchPath(t *testing.T) {
+	dir := t.TempDir()
+	libDir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.gli": `import "util.gli" as util; util.twice(4)`})
+	writeFiles(t, libDir, map[string]string{"util.gli": "twice = fn(x: int) -> int { x * 2 }"})
+
+	_, typ := run(t, NewLoader(nil), dir)
+	expected := "Static TypeError at [1,17]: module not found: util.gli"
+	if typ.String() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, typ.String())
+	}
+
+	result, typ := run(t, NewLoader([]string{libDir}), dir)
+	if typ.Type() == types.ERROR {
+		t.Fatalf("unexpected type error: %s", typ.String())
+	}
+	if result.Inspect() != "8" {
+		t.Errorf("wrong result. want=%q, got=%q", "8", result.Inspect())
+	}
+}
+
+func TestImportCycles(t *testing.T) {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{"main.gli": `import "main.gli" as self`},
+			"Static TypeError at [1,17]: import cycle: main.gli -> main.gli",
+		},
+		{
+			map[string]string{
+				"main.gli": `import "a.gli" as a`,
+				"a.gli":    `import "b.gli" as b`,
+				"b.gli":    `import "a.gli" as a`,
+			},
+			"Static TypeError at [1,14]: in module a.gli: Static TypeError at [1,14]: in module b.gli: " +
+				"Static TypeError at [1,14]: import cycle: a.gli -> b.gli -> a.gli",
+		},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, tt.files)
+
+		_, typ := run(t, NewLoader(nil), dir)
+		if typ.String() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, typ.String())
+		}
+	}
+}
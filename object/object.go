@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"glimmer/ast"
+	"glimmer/code"
+	"glimmer/token"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,9 +15,14 @@ type ObjectType string
 
 const (
 	FUNCTION_OBJ     = "FUNCTION"
+	COMPILED_FN_OBJ  = "COMPILED_FUNCTION"
+	CLOSURE_OBJ      = "CLOSURE"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	DICT_OBJ         = "DICT"
+	STRUCT_OBJ       = "STRUCT"
+	ENUM_OBJ         = "ENUM"
+	MODULE_OBJ       = "MODULE"
 	STRING_OBJ       = "STRING"
 	INTEGER_OBJ      = "INTEGER"
 	FLOAT_OBJ        = "FLOAT"
@@ -34,25 +42,44 @@ type Object interface {
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.tracer = outer.tracer
+	env.sandbox = outer.sandbox
 	return env
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, sandbox: NewSandbox(Limits{})}
+}
+
+// Importer returns the evaluated Environment of the module at path
+type Importer func(path string) (*Environment, error)
+
+// Tracer follows the evaluation of a program, for the debugger. Statement is
+// called before each statement of a program or block runs, and Call and
+// Return bracket each call of a user function.
+type Tracer interface {
+	Statement(stmt ast.Statement, env *Environment)
+	Call(name string, pos token.Token)
+	Return(name string)
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	importer Importer
+	tracer   Tracer   // inherited by enclosed Environments
+	sandbox  *Sandbox // without limits by default, inherited by enclosed Environments
 }
 
+// Get looks up name in the nearest scope that has it. A name declared but not
+// yet assigned there is not found, rather than looked up further out.
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
-	return obj, ok
+	return obj, ok && obj != nil
 }
 
 func (e *Environment) Set(name string, val Object) Object {
@@ -60,23 +87,80 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
-func (e *Environment) DeepCopy() *Environment {
-	newEnv := &Environment{}
-	if e.outer != nil {
-		newEnv.outer = e.outer.DeepCopy()
+// Declare makes name a variable of this scope before it is assigned, so that
+// assigning it stays here rather than reaching a scope further out
+func (e *Environment) Declare(name string) {
+	if _, ok := e.store[name]; !ok {
+		e.store[name] = nil
+	}
+}
+
+// Assign updates name in the nearest scope that already holds it, so closures
+// and the scopes they were created in share their variables. A name that is
+// not yet bound anywhere is created in this scope.
+func (e *Environment) Assign(name string, val Object) Object {
+	for scope := e; scope != nil; scope = scope.outer {
+		if _, ok := scope.store[name]; ok {
+			scope.store[name] = val
+			return val
+		}
+	}
+	return e.Set(name, val)
+}
+
+// Outer returns the enclosing Environment, nil for the outermost
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the names bound in this scope, not its enclosing ones, sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name, obj := range e.store {
+		if obj != nil {
+			names = append(names, name)
+		}
 	}
-	newStore := make(map[string]Object)
-	for key, val := range e.store {
-		newStore[key] = val
+	sort.Strings(names)
+	return names
+}
+
+func (e *Environment) SetTracer(tracer Tracer) {
+	e.tracer = tracer
+}
+
+func (e *Environment) Tracer() Tracer {
+	return e.tracer
+}
+
+func (e *Environment) SetSandbox(sandbox *Sandbox) {
+	e.sandbox = sandbox
+}
+
+func (e *Environment) Sandbox() *Sandbox {
+	return e.sandbox
+}
+
+func (e *Environment) SetImporter(importer Importer) {
+	e.importer = importer
+}
+
+// Import loads the module at path with the importer of the outermost Environment
+func (e *Environment) Import(path string) (*Environment, error) {
+	if e.importer == nil {
+		if e.outer != nil {
+			return e.outer.Import(path)
+		}
+		return nil, fmt.Errorf("imports are not supported here")
 	}
-	newEnv.store = newStore
-	return newEnv
+	return e.importer(path)
 }
 
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Locals     []string // the names Body binds that Env did not when the function was created
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -94,8 +178,53 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction is a function lowered to bytecode by the compiler
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Source        string // the Inspect of the equivalent Function
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FN_OBJ }
+func (cf *CompiledFunction) Inspect() string  { return cf.Source }
+
+// Closure is a CompiledFunction with the variables it captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Upvalue
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
+
+// Upvalue is a variable a Closure captured from an enclosing function. It
+// points at the variable's stack slot while that call is live and holds the
+// value itself once the call returns, so every capture shares one variable.
+type Upvalue struct {
+	Location *Object
+	closed   Object
+}
+
+// Close moves the variable off the stack, into the Upvalue
+func (u *Upvalue) Close() {
+	u.closed = *u.Location
+	u.Location = &u.closed
+}
+
+// Applier calls a function value of the program, for the builtins that take
+// functions: the evaluator applies a Function, the vm runs a Closure
+type Applier func(fn Object, args ...Object) Object
+
+// Builtin is a function of the interpreter. A builtin calling the functions
+// it is passed has HigherOrder instead of Fn, to call them with the Applier
+// of whatever is running the program. A builtin allocating for its result has
+// a Cost, the elements it would allocate for args, so a Sandbox can refuse
+// the call before it is made.
 type Builtin struct {
-	Fn func(args ...Object) Object
+	Fn          func(args ...Object) Object
+	HigherOrder func(apply Applier, args ...Object) Object
+	Cost        func(args ...Object) int64
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -128,12 +257,82 @@ type Dict struct {
 func (d *Dict) Type() ObjectType { return DICT_OBJ }
 func (d *Dict) Inspect() string {
 	pairs := []string{}
-	for key, val := range d.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", key, val.Inspect()))
+	for _, key := range d.Keys() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", key, d.Pairs[key].Inspect()))
 	}
 	return "{" + strings.Join(pairs, ", ") + "}"
 }
 
+// Keys returns the keys of the dict in sorted order
+func (d *Dict) Keys() []string {
+	keys := make([]string, 0, len(d.Pairs))
+	for key := range d.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Copy returns a shallow copy, so that key updates do not affect aliases
+func (d *Dict) Copy() *Dict {
+	pairs := make(map[string]Object, len(d.Pairs))
+	for key, val := range d.Pairs {
+		pairs[key] = val
+	}
+	return &Dict{Pairs: pairs}
+}
+
+type Struct struct {
+	Name       string
+	FieldNames []string // in literal order, for Inspect
+	Fields     map[string]Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	fields := []string{}
+	for _, name := range s.FieldNames {
+		fields = append(fields, fmt.Sprintf("%s: %s", name, s.Fields[name].Inspect()))
+	}
+	return s.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Copy returns a shallow copy, so that field updates do not affect aliases
+func (s *Struct) Copy() *Struct {
+	fields := make(map[string]Object, len(s.Fields))
+	for key, val := range s.Fields {
+		fields[key] = val
+	}
+	return &Struct{Name: s.Name, FieldNames: s.FieldNames, Fields: fields}
+}
+
+// EnumValue is one variant of an enum, carrying that variant's payload
+type EnumValue struct {
+	Enum    string
+	Variant string
+	Payload []Object
+}
+
+func (ev *EnumValue) Type() ObjectType { return ENUM_OBJ }
+func (ev *EnumValue) Inspect() string {
+	if len(ev.Payload) == 0 {
+		return ev.Enum + "." + ev.Variant
+	}
+	payload := []string{}
+	for _, p := range ev.Payload {
+		payload = append(payload, p.Inspect())
+	}
+	return ev.Enum + "." + ev.Variant + "(" + strings.Join(payload, ", ") + ")"
+}
+
+type Module struct {
+	Name string
+	Env  *Environment
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
 type Integer struct {
 	Value int64
 }
@@ -177,9 +376,54 @@ type Continue struct{}
 func (cv *Continue) Type() ObjectType { return CONT_OBJ }
 func (cv *Continue) Inspect() string  { return "continue" }
 
+// CallFrame is a call to a user function that an error unwound through
+type CallFrame struct {
+	Name string
+	Line int // position of the call
+	Col  int
+}
+
 type Error struct {
 	Message string
+	Line    int // position of the failing node, 0 if unknown
+	Col     int
+	Stack   []CallFrame // innermost call first
+	Limit   bool        // raised by a Sandbox, which try can not catch
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// Traceback renders the error with its position and the calls it unwound through
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	if e.Limit {
+		out.WriteString("Limit Error")
+	} else {
+		out.WriteString("Runtime Error")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&out, " at [%d,%d]", e.Line, e.Col)
+	}
+	out.WriteString(": " + e.Message)
+
+	// the middle of a deep recursion only repeats itself
+	skipFrom, skipTo := len(e.Stack), len(e.Stack)
+	if len(e.Stack) > maxTracebackFrames {
+		skipFrom, skipTo = maxTracebackFrames/2, len(e.Stack)-maxTracebackFrames/2
+	}
+	for idx, frame := range e.Stack {
+		if idx == skipFrom {
+			fmt.Fprintf(&out, "\n\t... %d more calls", skipTo-skipFrom)
+		}
+		if idx >= skipFrom && idx < skipTo {
+			continue
+		}
+		fmt.Fprintf(&out, "\n\tin %s, called at [%d,%d]", frame.Name, frame.Line, frame.Col)
+	}
+	return out.String()
+}
+
+// maxTracebackFrames is the most calls a traceback lists
+const maxTracebackFrames = 20
@@ -0,0 +1,85 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// MaxStackDepth is how deeply calls may nest whatever the Limits, as calls
+// nested more deeply would overflow the Go stack
+const MaxStackDepth = 10000
+
+// Limits bound the resources the evaluation of a program may use. A zero
+// field is no limit.
+type Limits struct {
+	MaxSteps     int64           // nodes evaluated
+	MaxCallDepth int             // user function calls in progress at once
+	MaxElements  int64           // elements of arrays and dicts, and bytes of strings, allocated
+	Context      context.Context // evaluation stops once it is done
+}
+
+// Sandbox counts the resources used by an evaluation against its Limits. It
+// is shared by the Environments of the evaluation, which are inherited from
+// the root Environment it is set on.
+type Sandbox struct {
+	Limits
+	steps    int64
+	depth    int
+	elements int64
+	done     <-chan struct{}
+}
+
+func NewSandbox(limits Limits) *Sandbox {
+	s := &Sandbox{Limits: limits}
+	if limits.Context != nil {
+		s.done = limits.Context.Done()
+	}
+	return s
+}
+
+// Step counts the evaluation of a node, erroring if it is one too many or
+// the context is done
+func (s *Sandbox) Step() *Error {
+	s.steps++
+	if s.MaxSteps > 0 && s.steps > s.MaxSteps {
+		return limitError("step limit of %d exceeded", s.MaxSteps)
+	}
+	if s.done != nil {
+		select {
+		case <-s.done:
+			return limitError("%s", s.Context.Err())
+		default:
+		}
+	}
+	return nil
+}
+
+// Enter counts a call, erroring if it is nested too deeply. Each call
+// entered without error must be left.
+func (s *Sandbox) Enter() *Error {
+	if s.MaxCallDepth > 0 && s.depth >= s.MaxCallDepth {
+		return limitError("call depth limit of %d exceeded", s.MaxCallDepth)
+	}
+	if s.depth >= MaxStackDepth {
+		return limitError("stack overflow: calls nested over %d deep", MaxStackDepth)
+	}
+	s.depth++
+	return nil
+}
+
+func (s *Sandbox) Leave() {
+	s.depth--
+}
+
+// Alloc counts n elements about to be allocated, erroring if they are too many
+func (s *Sandbox) Alloc(n int64) *Error {
+	s.elements += n
+	if s.MaxElements > 0 && s.elements > s.MaxElements {
+		return limitError("allocation limit of %d elements exceeded", s.MaxElements)
+	}
+	return nil
+}
+
+func limitError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Limit: true}
+}
@@ -2,18 +2,24 @@ package parser
 
 import (
 	"glimmer/ast"
+	"glimmer/diagnostics"
 	"glimmer/lexer"
 	"glimmer/token"
 	"glimmer/types"
 )
 
 type Parser struct {
-	lex    *lexer.Lexer
-	errors []string
+	lex         *lexer.Lexer
+	errors      []string
+	diagnostics []diagnostics.Diagnostic
 
 	curToken  token.Token
 	peekToken token.Token
 
+	// set while parsing the conditions of if/ife/while and the collection of
+	// a for, where `x {` opens the body instead of a struct literal
+	noStructLiteral bool
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -43,6 +49,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseDictLiteral)
 	p.registerPrefix(token.IFE, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	//p.registerPrefix(token.FOR, p.parseForExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 
@@ -59,9 +67,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LTE, p.parseInfixExpression)
 	p.registerInfix(token.GTE, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.NOTIN, p.parseNotInExpression)
 	p.registerInfix(token.PIPE, p.parseInfixExpression)
 	p.registerInfix(token.LPAR, p.parseCallExpression)      //GIGABRAIN LPAR IS A BOOLEAN OPERATOR
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression) //GIGABRAIN LBRACKET IS A BOOLEAN OPERATOR
+	p.registerInfix(token.DOT, p.parseFieldAccessExpression)
+	p.registerInfix(token.LBRACE, p.parseStructLiteral)
 
 	// read two tokens so that curToken and peekToken are set
 	p.nextToken()
@@ -83,3 +95,13 @@ func (p *Parser) ParseProgram() *ast.Program {
 	}
 	return program
 }
+
+// ParseType parses input as a type annotation alone, i.e. `fn(int) -> string`
+func (p *Parser) ParseType() types.TypeNode {
+	typ := p.parseTypeNode()
+	if typ != nil && !p.peekTokenIs(token.EOF) {
+		p.peekError(token.EOF, p.peekToken.Line, p.peekToken.Col)
+		return nil
+	}
+	return typ
+}
@@ -14,6 +14,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefix()
 
 	for !p.peekTokenIs(token.SEMICOL) && precedence < p.peekPrecedence() {
+		if p.peekNotIn() {
+			p.peekToken.Type = token.NOTIN
+		}
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -53,7 +56,29 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseNotInExpression parses `x not in xs`, an operator of two words
+func (p *Parser) parseNotInExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: "not in",
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	prevNoStruct := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prevNoStruct }()
+
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
 
@@ -67,10 +92,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
-	for !p.peekTokenIs(token.LBRACE) {
-		p.nextToken() // cur = IFE , peek = first of cond
-		expression.Condition = append(expression.Condition, p.parseStatement())
-	}
+	expression.Condition = p.parseConditionStatements()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -86,11 +108,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		if p.peekTokenIs(token.IFE) { // elif
 			p.nextToken() //curToken = If
 
-			condStmts := []ast.Statement{}
-			for !p.peekTokenIs(token.LBRACE) {
-				p.nextToken() //curToken = first token of condition statement
-				condStmts = append(condStmts, p.parseStatement())
-			}
+			condStmts := p.parseConditionStatements()
 			p.nextToken()
 			expression.ElifConditions = append(expression.ElifConditions, condStmts)
 			expression.ElifBranches = append(expression.ElifBranches, p.parseBlockStatement())
@@ -106,6 +124,99 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	expression.ErrorName = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	p.nextToken() // curtok = subject
+	prevNoStruct := p.noStructLiteral
+	p.noStructLiteral = true
+	expression.Subject = p.parseExpression(LOWEST)
+	p.noStructLiteral = prevNoStruct
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken() // curtok = }
+	expression.End = p.curToken
+
+	return expression
+}
+
+// parseMatchArm parses `Variant(a, b) => body`, where body is an expression or
+// a block
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	arm := &ast.MatchArm{Variant: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+	if p.peekTokenIs(token.LPAR) {
+		p.nextToken() // curtok = (
+		for !p.peekTokenIs(token.RPAR) {
+			if !p.expectPeek(token.ID) {
+				return nil
+			}
+			arm.Bindings = append(arm.Bindings, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+			if !p.peekTokenIs(token.RPAR) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken() // curtok = )
+	}
+
+	if !p.expectPeek(token.FATARROW) {
+		return nil
+	}
+	p.nextToken() // curtok = body
+
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	stmt := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+	arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+	return arm
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAR)
@@ -115,6 +226,10 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 
+	prevNoStruct := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prevNoStruct }()
+
 	if p.peekTokenIs(end) {
 		p.nextToken()
 		return list
@@ -139,8 +254,16 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
-	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	var start ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		start = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(token.COLON) {
+		exp.Index = p.parseSliceIndex(start)
+	} else {
+		exp.Index = start
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -148,3 +271,38 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	return exp
 }
+
+// parseSliceIndex parses the rest of a slice after its start, i.e. `:3:2` of
+// a[1:3:2], where the end and the step may be omitted
+func (p *Parser) parseSliceIndex(start ast.Expression) *ast.SliceIndex {
+	p.nextToken() // curtok = first ':'
+	slice := &ast.SliceIndex{Token: p.curToken, Start: start}
+	slice.End = p.parseSliceBound()
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		slice.Step = p.parseSliceBound()
+	}
+	return slice
+}
+
+// parseSliceBound parses the bound after the current `:`, or returns nil if
+// it is omitted
+func (p *Parser) parseSliceBound() ast.Expression {
+	if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.RBRACKET) {
+		return nil
+	}
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseFieldAccessExpression(left ast.Expression) ast.Expression {
+	exp := &ast.FieldAccessExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	exp.Field = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
@@ -11,6 +11,14 @@ import (
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
+	if p.peekTokenIs(token.LBRACKET) { // generic, i.e. fn[T, U](...)
+		p.nextToken()
+		lit.TypeParams = p.parseTypeParameters()
+		if lit.TypeParams == nil {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.LPAR) {
 		return nil
 	}
@@ -74,6 +82,28 @@ func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []types.TypeNode)
 	return ids, parTypes
 }
 
+func (p *Parser) parseTypeParameters() []*ast.Identifier {
+	ids := []*ast.Identifier{}
+
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	ids = append(ids, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken() // curtok = comma
+		if !p.expectPeek(token.ID) {
+			return nil
+		}
+		ids = append(ids, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return ids
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	if p.peekTokenIs(token.RBRACKET) {
@@ -84,12 +114,22 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 		return array
 	}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.End = p.curToken
 	return array
 }
 
 func (p *Parser) parseDictLiteral() ast.Expression {
 	dict := &ast.DictLiteral{Token: p.curToken}
 	dict.Pairs = make(map[ast.Expression]ast.Expression)
+	if p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		dict.End = p.curToken
+		if startsType(p.peekToken.Type) && p.peekToken.Line == p.curToken.Line { // i.e. {}int
+			p.nextToken()
+			dict.ExplicitType = p.parseTypeNode()
+		}
+		return dict
+	}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -103,6 +143,7 @@ func (p *Parser) parseDictLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		dict.Pairs[key] = value
+		dict.Keys = append(dict.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -112,10 +153,56 @@ func (p *Parser) parseDictLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	dict.End = p.curToken
 
 	return dict
 }
 
+// startsType reports whether a type annotation can begin with tok. The name
+// of a struct or enum is left out, as an identifier after {} begins the next
+// statement.
+func startsType(tok token.TokenType) bool {
+	switch tok {
+	case token.INTEGER_TYPE, token.FLOAT_TYPE, token.BOOLEAN_TYPE, token.STRING_TYPE, token.ARRAY_TYPE,
+		token.DICT_TYPE, token.FUNCTION, token.NONE_TYPE:
+		return true
+	}
+	return false
+}
+
+func (p *Parser) parseStructLiteral(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.structLiteralNameError(p.curToken.Line, p.curToken.Col)
+		return nil
+	}
+	lit := &ast.StructLiteral{Token: p.curToken, Name: name}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.ID) {
+			return nil
+		}
+		lit.FieldNames = append(lit.FieldNames, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -129,8 +216,8 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as an integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError("invalid-number", p.curToken, p.curToken.Line, p.curToken.Col,
+			fmt.Sprintf("could not parse %q as an integer", p.curToken.Literal))
 		return nil
 	}
 
@@ -143,8 +230,8 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as a float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError("invalid-number", p.curToken, p.curToken.Line, p.curToken.Col,
+			fmt.Sprintf("could not parse %q as a float", p.curToken.Literal))
 		return nil
 	}
 
@@ -252,6 +339,16 @@ func (p *Parser) parseTypeNode() types.TypeNode {
 		return typ
 	case token.NONE_TYPE:
 		return NONE_T
+	case token.ID: // user-defined type, resolved by the typechecker
+		name := p.curToken.Literal
+		if p.peekTokenIs(token.DOT) { // type of an imported module, i.e. lib.Point
+			p.nextToken()
+			if !p.expectPeek(token.ID) {
+				return nil
+			}
+			name += "." + p.curToken.Literal
+		}
+		return &types.NamedType{Name: name}
 	default:
 		p.typeNotRecognizedError(p.curToken.Type, p.curToken.Line, p.curToken.Col)
 		return nil
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"glimmer/ast"
+	"glimmer/diagnostics"
 	"glimmer/token"
 )
 
@@ -33,15 +34,40 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Diagnostics returns the errors of Errors, each spanning the token it is
+// about
+func (p *Parser) Diagnostics() []diagnostics.Diagnostic {
+	return p.diagnostics
+}
+
+// addError records msg at line and col, and as a diagnostic of code
+// spanning tok
+func (p *Parser) addError(code string, tok token.Token, line int, col int, msg string, hints ...string) {
+	p.errors = append(p.errors, fmt.Sprintf("[%d,%d]: %s", line, col, msg))
+	p.diagnostics = append(p.diagnostics, diagnostics.Diagnostic{Severity: diagnostics.Error, Code: code,
+		Span: diagnostics.TokenSpan(tok), Message: msg, Hints: hints})
+}
+
 func (p *Parser) typeNotRecognizedError(t token.TokenType, line int, col int) {
-	msg := fmt.Sprintf("[%d,%d]: type not recognized: %s", line, col, t)
-	p.errors = append(p.errors, msg)
+	p.addError("unknown-type", p.curToken, line, col, fmt.Sprintf("type not recognized: %s", t))
+}
+
+func (p *Parser) invalidAssignTargetError(line int, col int) {
+	p.addError("invalid-assign-target", p.peekToken, line, col, "invalid assignment target")
+}
+
+func (p *Parser) structLiteralNameError(line int, col int) {
+	p.addError("struct-literal-name", p.curToken, line, col, "struct literal must be preceded by a struct name",
+		"`{` after an expression opens a struct literal, i.e. Point{x: 1}")
+}
+
+func (p *Parser) nestedTestError(tok token.Token) {
+	p.addError("nested-test", tok, tok.Line, tok.Col, "test blocks must be at the top level")
 }
 
 func (p *Parser) peekError(t token.TokenType, line int, col int) {
-	msg := fmt.Sprintf("[%d,%d]: expected next token to be %s, got %s instead",
-		line, col, t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError("expected-token", p.peekToken, line, col,
+		fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type))
 }
 
 type (
@@ -58,17 +84,29 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType, line int, col int) {
-	msg := fmt.Sprintf("[%d,%d]: no prefix parse function for %s found", line, col, t)
-	p.errors = append(p.errors, msg)
+	p.addError("unexpected-token", p.curToken, line, col, fmt.Sprintf("no prefix parse function for %s found", t))
 }
 
 func (p *Parser) peekPrecedence() int {
+	if p.noStructLiteral && p.peekTokenIs(token.LBRACE) {
+		return LOWEST
+	}
+	if p.peekNotIn() {
+		return precedences[token.NOTIN]
+	}
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
 	}
 	return LOWEST
 }
 
+// peekNotIn reports whether the next token is the `not` of `not in`, which
+// is only an operator after an operand and a plain identifier otherwise
+func (p *Parser) peekNotIn() bool {
+	return p.peekTokenIs(token.ID) && p.peekToken.Literal == "not" &&
+		p.lex.PeekToken().Type == token.IN
+}
+
 func (p *Parser) curPrecedence() int {
 	if p, ok := precedences[p.curToken.Type]; ok {
 		return p
@@ -80,3 +118,22 @@ func isAssign(tok token.TokenType) bool {
 	return tok == token.ASSIGN || tok == token.PLUSEQ ||
 		tok == token.MINUSEQ || tok == token.MULTEQ || tok == token.DIVEQ
 }
+
+// isAssignTarget reports whether exp can be assigned to, i.e. a chain of field
+// accesses and indexes (but not slices) rooted at an identifier, and returns
+// that identifier
+func isAssignTarget(exp ast.Expression) (*ast.Identifier, bool) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp, true
+	case *ast.FieldAccessExpression:
+		return isAssignTarget(exp.Left)
+	case *ast.IndexExpression:
+		if _, isSlice := exp.Index.(*ast.SliceIndex); isSlice {
+			return nil, false
+		}
+		return isAssignTarget(exp.Left)
+	default:
+		return nil, false
+	}
+}
@@ -28,10 +28,23 @@ var precedences = map[token.TokenType]int{
 	token.GT:       LESSGREATER,
 	token.LTE:      LESSGREATER,
 	token.GTE:      LESSGREATER,
+	token.IN:       LESSGREATER,
+	token.NOTIN:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.MULT:     PRODUCT,
 	token.DIV:      PRODUCT,
 	token.LPAR:     CALL,
+	token.LBRACE:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// Precedence returns how tightly the infix operator t binds, LOWEST for a
+// token that is not one
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
 }
@@ -3,6 +3,7 @@ package parser
 import (
 	"glimmer/ast"
 	"glimmer/token"
+	"glimmer/types"
 )
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -13,7 +14,7 @@ func (p *Parser) parseStatement() ast.Statement {
 		if isAssign(p.peekToken.Type) {
 			return p.parseAssignStatement()
 		} else {
-			return p.parseExpressionStatement()
+			return p.parseExpressionOrTargetAssignStatement()
 		}
 	case token.IF:
 		return p.parseIfStatement()
@@ -21,6 +22,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseForStatement()
 	case token.WHILE:
 		return p.parseWhileStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.TEST:
+		return p.parseTestStatement()
 	case token.BREAK:
 		br := &ast.BreakStatement{Token: p.curToken}
 		if p.peekTokenIs(token.SEMICOL) {
@@ -55,6 +64,39 @@ func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	return stmt
 }
 
+// parseExpressionOrTargetAssignStatement parses statements beginning with an
+// identifier that is not directly assigned, such as `p.x = 1` or `f(x)`
+func (p *Parser) parseExpressionOrTargetAssignStatement() ast.Statement {
+	exprStmt := &ast.ExpressionStatement{Token: p.curToken}
+	exprStmt.Expression = p.parseExpression(LOWEST)
+
+	if !isAssign(p.peekToken.Type) {
+		if p.peekTokenIs(token.SEMICOL) {
+			p.nextToken()
+		}
+		return exprStmt
+	}
+
+	name, ok := isAssignTarget(exprStmt.Expression)
+	if !ok {
+		p.invalidAssignTargetError(p.peekToken.Line, p.peekToken.Col)
+		return nil
+	}
+
+	stmt := &ast.AssignStatement{Token: p.peekToken, Type: p.peekToken.Type, Name: name, Target: exprStmt.Expression}
+
+	p.nextToken() // curtok = assign
+	p.nextToken() // curtok = value
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOL) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -72,10 +114,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 func (p *Parser) parseIfStatement() *ast.IfStatement {
 	stmt := &ast.IfStatement{Token: p.curToken}
 
-	for !p.peekTokenIs(token.LBRACE) {
-		p.nextToken() // cur = IF , peek = first of cond
-		stmt.Condition = append(stmt.Condition, p.parseStatement())
-	}
+	stmt.Condition = p.parseConditionStatements()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -91,11 +130,7 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 		if p.peekTokenIs(token.IF) { // elif
 			p.nextToken() //curToken = If
 
-			condStmts := []ast.Statement{}
-			for !p.peekTokenIs(token.LBRACE) {
-				p.nextToken() //curToken = first token of condition statement
-				condStmts = append(condStmts, p.parseStatement())
-			}
+			condStmts := p.parseConditionStatements()
 			p.nextToken()
 			stmt.ElifConditions = append(stmt.ElifConditions, condStmts)
 			stmt.ElifBranches = append(stmt.ElifBranches, p.parseBlockStatement())
@@ -134,7 +169,10 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 		return nil
 	}
 	p.nextToken() // curtok = collection
+	prevNoStruct := p.noStructLiteral
+	p.noStructLiteral = true
 	stmt.Collection = p.parseExpression(LOWEST)
+	p.noStructLiteral = prevNoStruct
 
 	p.nextToken() // curtok = body
 	stmt.Body = p.parseBlockStatement()
@@ -145,10 +183,7 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	stmt := &ast.WhileStatement{Token: p.curToken}
 
-	for !p.peekTokenIs(token.LBRACE) {
-		p.nextToken() // cur = IF , peek = first of cond
-		stmt.Condition = append(stmt.Condition, p.parseStatement())
-	}
+	stmt.Condition = p.parseConditionStatements()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -175,15 +210,182 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	prevNoStruct := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prevNoStruct }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if test, ok := stmt.(*ast.TestStatement); ok && test != nil {
+			p.nestedTestError(test.Token)
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	block.End = p.curToken
 
 	return block
 }
+
+// parseConditionStatements parses the statements up to (not including) the
+// opening brace of an if, ife, or while body
+func (p *Parser) parseConditionStatements() []ast.Statement {
+	stmts := []ast.Statement{}
+
+	prevNoStruct := p.noStructLiteral
+	p.noStructLiteral = true
+	for !p.peekTokenIs(token.LBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken() // curtok = first token of condition statement
+		stmts = append(stmts, p.parseStatement())
+	}
+	p.noStructLiteral = prevNoStruct
+
+	return stmts
+}
+
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.ID) {
+			return nil
+		}
+		stmt.FieldNames = append(stmt.FieldNames, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken() // curtok = type
+
+		fieldType := p.parseTypeNode()
+		if fieldType == nil {
+			return nil
+		}
+		stmt.FieldTypes = append(stmt.FieldTypes, fieldType)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOL) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.ID) {
+			return nil
+		}
+		stmt.Variants = append(stmt.Variants, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		payload := []types.TypeNode{}
+		if p.peekTokenIs(token.LPAR) {
+			p.nextToken() // curtok = (
+			for !p.peekTokenIs(token.RPAR) {
+				p.nextToken() // curtok = type
+
+				payloadType := p.parseTypeNode()
+				if payloadType == nil {
+					return nil
+				}
+				payload = append(payload, payloadType)
+
+				if !p.peekTokenIs(token.RPAR) && !p.expectPeek(token.COMMA) {
+					return nil
+				}
+			}
+			p.nextToken() // curtok = )
+		}
+		stmt.Payloads = append(stmt.Payloads, payload)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOL) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOL) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTestStatement() *ast.TestStatement {
+	stmt := &ast.TestStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Name = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOL) {
+		p.nextToken()
+	}
+
+	return stmt
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"glimmer/ast"
+	"glimmer/diagnostics"
 	"glimmer/lexer"
 	"strconv"
 	"testing"
@@ -22,6 +23,8 @@ import (
 * 9. WHILE EXPRESSIONS
 * 10. CALL EXPRESSIONS
 * 11. INDEX EXPRESSIONS
+* 12. STRUCTS
+* 13. IMPORTS
 *
 * (CTRL + F) IF NEEDED
  */
@@ -169,7 +172,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"a[1:n - 1]", "(a[1:(n - 1)])"},
+		{"a[:2]", "(a[:2])"},
+		{"a[::-1]", "(a[::(-1)])"},
+		{"a[1::2][0]", "((a[1::2])[0])"},
+		{"a[:]", "(a[:])"},
+		{"x + 1 in xs", "((x + 1) in xs)"},
+		{"x not in xs == b", "((x not in xs) == b)"},
+		{"a in b not in c", "((a in b) not in c)"},
+		{"not + 1", "(not + 1)"},
+		{"not not in xs", "(not not in xs)"},
+		{`"k" in d && ok`, "((k in d) && ok)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a + b | f", "((a + b) | f)"},
+		{"a | f(b) | g", "((a | f(b)) | g)"},
+		{"a.b.c + d[1].e", "(((a.b).c) + ((d[1]).e))"},
+		{"P{x: 1}.x * 2", "((P{x: 1}.x) * 2)"},
 	}
 
 	for _, tt := range tests {
@@ -283,6 +301,39 @@ func TestFunctionLiteralExpression(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestGenericFunctionLiteralParsing(t *testing.T) {
+	input := "fn[T, U](xs: array[T], f: fn(T) -> U) -> array[U] { xs }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	CheckParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.TypeParams) != 2 {
+		t.Fatalf("function literal type params wrong. want 2, got=%d\n", len(function.TypeParams))
+	}
+	testLiteralExpression(t, function.TypeParams[0], "T")
+	testLiteralExpression(t, function.TypeParams[1], "U")
+
+	expectedTypes := []string{"array[T]", "fn(T) -> U"}
+	for idx, ex := range expectedTypes {
+		actual := function.ParamTypes[idx].String()
+		if ex != actual {
+			t.Fatalf("function param type wrong. want=%s, got=%s", ex, actual)
+		}
+	}
+
+	if function.String() != "fn[T, U](xs : array[T], f : fn(T) -> U) -> array[U] { xs }" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -391,6 +442,12 @@ func TestDictLiteralParsing(t *testing.T) {
 		expectedValue := expected[lit.String()]
 		testIntegerLiteral(t, val, expectedValue)
 	}
+
+	for idx, key := range []string{"one", "two", "three"} {
+		if dict.Keys[idx].String() != key {
+			t.Errorf("dict.Keys[%d] wrong. expected=%s, got=%s", idx, key, dict.Keys[idx].String())
+		}
+	}
 }
 
 func TestEmptyDictParsing(t *testing.T) {
@@ -412,6 +469,43 @@ func TestEmptyDictParsing(t *testing.T) {
 	}
 }
 
+func TestTypedEmptyDictParsing(t *testing.T) {
+	program := New(lexer.New("d = {}array[int]")).ParseProgram()
+
+	stmt := program.Statements[0].(*ast.AssignStatement)
+	dict, ok := stmt.Value.(*ast.DictLiteral)
+	if !ok {
+		t.Fatalf("value is not ast.DictLiteral. got=%T", stmt.Value)
+	}
+	if dict.ExplicitType == nil || dict.ExplicitType.String() != "array[int]" {
+		t.Errorf("dict.ExplicitType is not array[int]. got=%v", dict.ExplicitType)
+	}
+}
+
+func TestEmptyDictBeforeStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"d = {}\nx = 1", "d = {};x = 1;"},
+		{"f({})\nfn() -> int { 1 }", "f({})fn() -> int { 1 }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+
+		if len(program.Statements) != 2 {
+			t.Fatalf("program does not have 2 statements. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -683,6 +777,42 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, ope
 * IF EXPRESSION TESTS
  */
 
+func TestTryExpression(t *testing.T) {
+	input := "try { x / y } catch err { err }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	CheckParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Body.Statements[0].(*ast.ExpressionStatement).Expression, "x", "/", "y") {
+		return
+	}
+	if !testIdentifier(t, exp.ErrorName, "err") {
+		return
+	}
+	if !testIdentifier(t, exp.Handler.Statements[0].(*ast.ExpressionStatement).Expression, "err") {
+		return
+	}
+
+	if exp.String() != "try { (x / y) } catch err { err }" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := "ife x < y { x }"
 
@@ -1258,3 +1388,344 @@ func TestIndexExpressionParsing(t *testing.T) {
 		return
 	}
 }
+
+/*
+* STRUCT TESTS
+ */
+
+func TestStructStatement(t *testing.T) {
+	input := "struct Point { x: float, y: array[Point] }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	CheckParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.StructStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "Point" {
+		t.Errorf("struct name is not Point. got=%s", stmt.Name.Value)
+	}
+
+	expectedFields := []string{"x", "y"}
+	expectedTypes := []string{"float", "array[Point]"}
+	if len(stmt.FieldNames) != len(expectedFields) {
+		t.Fatalf("struct has wrong num of fields. got=%d", len(stmt.FieldNames))
+	}
+	for i := range expectedFields {
+		if stmt.FieldNames[i].Value != expectedFields[i] {
+			t.Errorf("field %d is not %s. got=%s", i, expectedFields[i], stmt.FieldNames[i].Value)
+		}
+		if stmt.FieldTypes[i].String() != expectedTypes[i] {
+			t.Errorf("field type %d is not %s. got=%s", i, expectedTypes[i], stmt.FieldTypes[i].String())
+		}
+	}
+}
+
+func TestStructLiteralParsing(t *testing.T) {
+	input := "Point{x: 1, y: 2 + 3}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	CheckParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	lit, ok := stmt.Expression.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.StructLiteral. got=%T", stmt.Expression)
+	}
+
+	if lit.Name.Value != "Point" {
+		t.Errorf("struct literal name is not Point. got=%s", lit.Name.Value)
+	}
+	if len(lit.FieldNames) != 2 {
+		t.Fatalf("struct literal has wrong num of fields. got=%d", len(lit.FieldNames))
+	}
+	testLiteralExpression(t, lit.Values[0], 1)
+	testInfixExpression(t, lit.Values[1], 2, "+", 3)
+}
+
+func TestStructLiteralNotInConditions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if x { y }", "if (x) { y }"},
+		{"while p.ok { y }", "while ((p.ok) ){ y }"},
+		{"for v in vs { P{x: v} }", "for v in vs{ P{x: v} }"},
+		{"ife (P{x: 1}).x { 1 }", "ife ((P{x: 1}.x)) { 1 }"},
+		{"if ife a { 1 } else { 2 } == p { x }", "if ((ife (a) { 1 } else { 2 } == p)) { x }"},
+		{"while ife a { 1 } else { 2 } < n { x }", "while ((ife (a) { 1 } else { 2 } < n) ){ x }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestFieldAssignStatement(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedTarget string
+		expectedOp     string
+	}{
+		{"p.x = 1", "p", "(p.x)", "="},
+		{"l.a.y += 2", "l", "((l.a).y)", "+="},
+		{`d["k"] = 1`, "d", "(d[k])", "="},
+		{`m["a"].x -= 3`, "m", "((m[a]).x)", "-="},
+		{"a[0] += 1", "a", "(a[0])", "+="},
+		{`m["k"][i] = v`, "m", "((m[k])[i])", "="},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.AssignStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name is not %s. got=%s", tt.expectedName, stmt.Name.Value)
+		}
+		if stmt.Target.String() != tt.expectedTarget {
+			t.Errorf("stmt.Target is not %s. got=%s", tt.expectedTarget, stmt.Target.String())
+		}
+		if string(stmt.Type) != tt.expectedOp {
+			t.Errorf("stmt.Type is not %s. got=%s", tt.expectedOp, stmt.Type)
+		}
+	}
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(x) = 1", "[1,6]: invalid assignment target"},
+		{"a[1:2] = [3]", "[1,8]: invalid assignment target"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("expected %q. got=%v", tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		expected diagnostics.Span
+	}{
+		{"f(x) = 1", "invalid-assign-target", diagnostics.Span{Start: diagnostics.Position{Line: 1, Col: 6}, End: diagnostics.Position{Line: 1, Col: 6}}},
+		{"x = (1 + 2", "expected-token", diagnostics.Span{Start: diagnostics.Position{Line: 1, Col: 11}, End: diagnostics.Position{Line: 1, Col: 11}}},
+		{"x = 1 +\n  )", "unexpected-token", diagnostics.Span{Start: diagnostics.Position{Line: 2, Col: 3}, End: diagnostics.Position{Line: 2, Col: 3}}},
+		{"f = fn(x: 12) -> int { x }", "unknown-type", diagnostics.Span{Start: diagnostics.Position{Line: 1, Col: 11}, End: diagnostics.Position{Line: 1, Col: 12}}},
+		{"x = 99999999999999999999", "invalid-number", diagnostics.Span{Start: diagnostics.Position{Line: 1, Col: 5}, End: diagnostics.Position{Line: 1, Col: 24}}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) == 0 || len(diags) != len(p.Errors()) {
+			t.Errorf("expected a diagnostic for each error of %q. got=%v, errors=%v", tt.input, diags, p.Errors())
+			continue
+		}
+		if diags[0].Code != tt.code || diags[0].Span != tt.expected {
+			t.Errorf("wrong diagnostic for %q. expected=%s at %v, got=%s at %v", tt.input, tt.code, tt.expected, diags[0].Code, diags[0].Span)
+		}
+	}
+}
+
+/*
+* IMPORT TESTS
+ */
+
+func TestImportStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedPath  string
+		expectedAlias string
+	}{
+		{`import "lib.gli" as lib`, "lib.gli", "lib"},
+		{`import "std/strings.gli" as str;`, "std/strings.gli", "str"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Path.Value != tt.expectedPath {
+			t.Errorf("import path is not %s. got=%s", tt.expectedPath, stmt.Path.Value)
+		}
+		if stmt.Alias.Value != tt.expectedAlias {
+			t.Errorf("import alias is not %s. got=%s", tt.expectedAlias, stmt.Alias.Value)
+		}
+	}
+}
+
+func TestTestStatement(t *testing.T) {
+	input := `test "adds numbers" { x = 1 + 1; assert_eq(x, 2) }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	CheckParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.TestStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.TestStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "adds numbers" {
+		t.Errorf("test name is not %q. got=%q", "adds numbers", stmt.Name.Value)
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Errorf("test body does not contain 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestNestedTestStatement(t *testing.T) {
+	p := New(lexer.New(`f = fn() -> none { test "inner" { } }`))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "[1,24]: test blocks must be at the top level" {
+		t.Errorf("wrong parser errors. got=%q", errors)
+	}
+}
+
+/*
+* ENUM TESTS
+ */
+
+func TestEnumStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Shape { Circle(float), Rect(float, float), Empty }", "enum Shape { Circle(float), Rect(float, float), Empty }"},
+		{"enum Tree { Leaf, Node(Tree, int, Tree), };", "enum Tree { Leaf, Node(Tree, int, Tree) }"},
+		{"enum Opt { Some(array[int]) }", "enum Opt { Some(array[int]) }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.EnumStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.EnumStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match s { Circle(r) => r * r, Rect(w, h) => w * h, Empty => 0.0 }",
+			"match s { Circle(r) => { (r * r) }, Rect(w, h) => { (w * h) }, Empty => { 0.0 } }"},
+		{"match t {\n Leaf => { 0 }\n, Node(l, _, r) => { x = 1; x },\n}",
+			"match t { Leaf => { 0 }, Node(l, _, r) => { x = 1;x } }"},
+		{"match f(x) { _ => true }", "match f(x) { _ => { true } }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.MatchExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("exp.String() wrong. want=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func FuzzParseProgram(f *testing.F) {
+	seeds := []string{
+		"x = 1 + 2.5 * -3",
+		"add = fn(a: int, b: int) -> int { return a + b }; add(1, 2)",
+		"for i in range(10) { if i == 2 { continue } else { break } }",
+		"struct P { x: int }; p = P{x: 1}; p.x += 1",
+		"enum Color { Red, Green }; match Color.Red { Color.Red => 1, _ => 2 }",
+		`import "lib.gli" as lib; try lib.f() catch e { e }`,
+		`test "adds" { assert_eq(1 + 1, 2) }`,
+		"fn<T>(xs: array[T]) -> T { xs[0] }",
+		"ife x { 1 } else { 2",
+		"x = ",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		// neither parsing any input nor printing what it parsed may panic
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package glimmer
+
+import (
+	"fmt"
+	"glimmer/evaluator"
+	"glimmer/object"
+	"glimmer/types"
+	"math"
+	"reflect"
+)
+
+// flyweights
+var (
+	INT_T    = &types.IntegerType{}
+	FLOAT_T  = &types.FloatType{}
+	BOOL_T   = &types.BooleanType{}
+	STRING_T = &types.StringType{}
+)
+
+// ToObject converts a Go value to a Glimmer object: integers to int, floats
+// to float, bools, strings, slices and arrays to array, and maps with string
+// keys to dict. An object.Object is returned as it is.
+func ToObject(value interface{}) (object.Object, error) {
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	return toObject(reflect.ValueOf(value))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows int", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.Bool:
+		return evaluator.BoolToBoolObj(v.Bool()), nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for idx := range elements {
+			el, err := toObject(v.Index(idx))
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("dict keys must be strings, got=%s", v.Type().Key())
+		}
+		pairs := make(map[string]object.Object, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			val, err := toObject(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs[iter.Key().String()] = val
+		}
+		return &object.Dict{Pairs: pairs}, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return ToObject(v.Interface())
+	case reflect.Invalid:
+		return evaluator.NULL, nil
+	default:
+		return nil, fmt.Errorf("can not convert %s to a glimmer value", v.Type())
+	}
+}
+
+// ToGo converts a Glimmer object to a Go value: int to int64, float to
+// float64, bool, string, array to []interface{}, dict and struct to
+// map[string]interface{}, and none to nil. Other objects, such as functions,
+// are returned as they are.
+func ToGo(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for idx, el := range obj.Elements {
+			elements[idx] = ToGo(el)
+		}
+		return elements
+	case *object.Dict:
+		return toGoMap(obj.Pairs)
+	case *object.Struct:
+		return toGoMap(obj.Fields)
+	case *object.Null, nil:
+		return nil
+	default:
+		return obj
+	}
+}
+
+func toGoMap(pairs map[string]object.Object) map[string]interface{} {
+	m := make(map[string]interface{}, len(pairs))
+	for key, val := range pairs {
+		m[key] = ToGo(val)
+	}
+	return m
+}
+
+// toValue converts obj to a value of the Go type t
+func toValue(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		if value := ToGo(obj); value != nil {
+			return reflect.ValueOf(value), nil
+		}
+		return reflect.Zero(t), nil
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		if isNumeric(t.Kind()) {
+			if overflows(obj.Value, t) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", obj.Value, t)
+			}
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.Float:
+		if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.Boolean:
+		if t.Kind() == reflect.Bool {
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.String:
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(obj.Value).Convert(t), nil
+		}
+	case *object.Array:
+		if t.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(t, len(obj.Elements), len(obj.Elements))
+			for idx, el := range obj.Elements {
+				val, err := toValue(el, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				slice.Index(idx).Set(val)
+			}
+			return slice, nil
+		}
+	case *object.Dict:
+		if t.Kind() == reflect.Map && t.Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(t, len(obj.Pairs))
+			for key, el := range obj.Pairs {
+				val, err := toValue(el, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), val)
+			}
+			return m, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("can not convert %s to %s", obj.Type(), t)
+}
+
+// overflows reports whether n is out of the range of the Go numeric type t,
+// rather than have it wrap around when converted
+func overflows(n int64, t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Zero(t).OverflowInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return n < 0 || reflect.Zero(t).OverflowUint(uint64(n))
+	}
+	return false // a float holds any int, if not exactly
+}
+
+func isNumeric(kind reflect.Kind) bool {
+	return (kind >= reflect.Int && kind <= reflect.Uint64) || kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// typeOf is the Glimmer type that values of the Go type t convert to
+func typeOf(t reflect.Type) (types.TypeNode, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return INT_T, nil
+	case reflect.Float32, reflect.Float64:
+		return FLOAT_T, nil
+	case reflect.Bool:
+		return BOOL_T, nil
+	case reflect.String:
+		return STRING_T, nil
+	case reflect.Slice, reflect.Array:
+		held, err := typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &types.ArrayType{HeldType: held}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("dict keys must be strings, got=%s", t.Key())
+		}
+		held, err := typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &types.DictType{HeldType: held}, nil
+	default:
+		return nil, fmt.Errorf("no glimmer type for %s", t)
+	}
+}
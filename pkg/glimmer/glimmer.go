@@ -0,0 +1,222 @@
+// Package glimmer embeds the Glimmer interpreter in Go programs. An
+// Interpreter typechecks and runs programs against globals and functions
+// provided by the host, converting values between Go and Glimmer.
+package glimmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"glimmer/ast"
+	"glimmer/evaluator"
+	"glimmer/lexer"
+	"glimmer/modules"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/typechecker"
+	"glimmer/types"
+	"reflect"
+	"strings"
+)
+
+// Interpreter holds the globals shared by the programs it runs, like a REPL
+// session. It is not safe for concurrent use.
+type Interpreter struct {
+	ctx     *types.Context
+	env     *object.Environment
+	limits  object.Limits
+	sandbox *object.Sandbox // shared by every Environment of the Interpreter
+}
+
+// Program is source that has been parsed and typechecked by an Interpreter
+type Program struct {
+	program *ast.Program
+	ctx     *types.Context // the globals as typechecked, for the Interpreter once prog runs
+}
+
+// New returns an Interpreter with only the builtins defined, importing
+// modules relative to the working directory
+func New() *Interpreter {
+	loader := modules.NewLoader(modules.SearchPathFromEnv())
+	in := &Interpreter{
+		ctx:     loader.NewContext(""),
+		env:     loader.NewEnvironment(""),
+		sandbox: object.NewSandbox(object.Limits{}),
+	}
+	in.env.SetSandbox(in.sandbox)
+	return in
+}
+
+// SetLimits bounds the resources each later Run may use. The Context of
+// limits is ignored for that of Run.
+func (in *Interpreter) SetLimits(limits object.Limits) {
+	in.limits = limits
+}
+
+// Compile parses and typechecks src against the globals of the Interpreter,
+// including those assigned by programs run before it. The globals src assigns
+// are only typed for later programs once it is run.
+func (in *Interpreter) Compile(src string) (*Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	ctx := in.ctx.Copy()
+	if typeErrs := typechecker.Check(program, ctx); len(typeErrs) != 0 {
+		msgs := make([]string, len(typeErrs))
+		for idx, err := range typeErrs {
+			msgs[idx] = err.String()
+		}
+		return nil, errors.New(strings.Join(msgs, "\n"))
+	}
+	return &Program{program: program, ctx: ctx}, nil
+}
+
+// Run evaluates prog, returning the value of its last statement converted by
+// ToGo. A runtime error is returned with its traceback, as is one for
+// exceeding the Interpreter's limits. If ctx is done before prog finishes, it
+// stops at its next step and ctx.Err() is returned.
+func (in *Interpreter) Run(ctx context.Context, prog *Program) (interface{}, error) {
+	limits := in.limits
+	limits.Context = ctx
+	*in.sandbox = *object.NewSandbox(limits) // counting from zero for each run
+
+	evaluated := evaluator.Eval(prog.program, in.env)
+	in.ctx.Merge(prog.ctx) // the globals prog assigned, even if it stopped early
+	if errObj, ok := evaluated.(*object.Error); ok {
+		if errObj.Limit && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.New(errObj.Traceback())
+	}
+	return ToGo(evaluated), nil
+}
+
+// SetGlobal defines name as value, converted by ToObject, for the programs
+// compiled after it. Its Glimmer type follows from value's Go type, and may
+// not change from that of an existing global.
+func (in *Interpreter) SetGlobal(name string, value interface{}) error {
+	if value == nil {
+		return fmt.Errorf("global %s can not be nil", name)
+	}
+	typ, err := typeOf(reflect.TypeOf(value))
+	if err != nil {
+		return fmt.Errorf("global %s: %s", name, err)
+	}
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("global %s: %s", name, err)
+	}
+
+	if prev, ok := in.ctx.Get(name); ok && !types.Equal(prev, typ) {
+		return fmt.Errorf("global %s of type %s can not be set to %s", name, prev.String(), typ.String())
+	}
+	in.ctx.Set(name, typ)
+	in.env.Set(name, obj)
+	return nil
+}
+
+// RegisterFunc defines name as the Go function goFunc, with the Glimmer type
+// given by signature, i.e. `fn(int, string) -> bool`. Calls to it are
+// typechecked against signature, whose parameter and return types must match
+// those of goFunc. goFunc may also return an error last, which stops the
+// program as a runtime error; it returns nothing for a none return type.
+func (in *Interpreter) RegisterFunc(name string, goFunc interface{}, signature string) error {
+	p := parser.New(lexer.New(signature))
+	parsed := p.ParseType()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("signature of %s: %s", name, strings.Join(p.Errors(), "; "))
+	}
+	fnType, ok := parsed.(*types.FunctionType)
+	if !ok {
+		return fmt.Errorf("signature of %s is not a function type: %s", name, signature)
+	}
+
+	fn := reflect.ValueOf(goFunc)
+	if fn.Kind() != reflect.Func {
+		return fmt.Errorf("%s: expected a function, got=%T", name, goFunc)
+	}
+	if err := checkSignature(fn.Type(), fnType); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	in.ctx.Set(name, fnType)
+	in.env.Set(name, &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return callGo(fn, args)
+	}})
+	return nil
+}
+
+// checkSignature errors unless the types of the function type ft match fnType
+func checkSignature(ft reflect.Type, fnType *types.FunctionType) error {
+	if ft.IsVariadic() || ft.NumIn() != len(fnType.ParamTypes) {
+		return fmt.Errorf("function %s does not match %s", ft, fnType.String())
+	}
+	for idx, param := range fnType.ParamTypes {
+		if !matches(ft.In(idx), param) {
+			return fmt.Errorf("param %d of %s does not match %s", idx+1, ft, param.String())
+		}
+	}
+
+	outs := ft.NumOut()
+	if outs > 0 && ft.Out(outs-1) == errorType {
+		outs--
+	}
+	switch {
+	case outs > 1:
+		return fmt.Errorf("function %s must return at most a value and an error", ft)
+	case outs == 0 && fnType.ReturnType.Type() != types.NONE:
+		return fmt.Errorf("function %s returns nothing, expected %s", ft, fnType.ReturnType.String())
+	case outs == 1 && !matches(ft.Out(0), fnType.ReturnType):
+		return fmt.Errorf("return of %s does not match %s", ft, fnType.ReturnType.String())
+	}
+	return nil
+}
+
+// matches reports whether values of the Go type t convert to and from typ.
+// The empty interface matches any type.
+func matches(t reflect.Type, typ types.TypeNode) bool {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return true
+	}
+	goType, err := typeOf(t)
+	return err == nil && types.Equal(goType, typ)
+}
+
+// callGo calls fn with args converted to its parameter types
+func callGo(fn reflect.Value, args []object.Object) object.Object {
+	fnType := fn.Type()
+	if len(args) != fnType.NumIn() {
+		return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=%d", len(args), fnType.NumIn())}
+	}
+
+	in := make([]reflect.Value, len(args))
+	for idx, arg := range args {
+		val, err := toValue(arg, fnType.In(idx))
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		in[idx] = val
+	}
+
+	out := fn.Call(in)
+	if len(out) > 0 && fnType.Out(len(out)-1) == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return evaluator.NULL
+	}
+
+	obj, err := ToObject(out[0].Interface())
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return obj
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
@@ -0,0 +1,237 @@
+package glimmer
+
+import (
+	"context"
+	"errors"
+	"glimmer/object"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func run(t *testing.T, in *Interpreter, src string) interface{} {
+	prog, err := in.Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q) returned error: %v", src, err)
+	}
+	result, err := in.Run(context.Background(), prog)
+	if err != nil {
+		t.Fatalf("Run(%q) returned error: %v", src, err)
+	}
+	return result
+}
+
+func TestRunConvertsResults(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2.0", 3.0},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"[1, 2]", []interface{}{int64(1), int64(2)}},
+		{`{"a": [true]}`, map[string]interface{}{"a": []interface{}{true}}},
+		{"struct P { x: int }\nP{x: 1}", map[string]interface{}{"x": int64(1)}},
+	}
+
+	for _, tt := range tests {
+		got := run(t, New(), tt.input)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong result for %q. expected=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestGlobalsPersistAcrossPrograms(t *testing.T) {
+	in := New()
+	run(t, in, "total = 1")
+	run(t, in, "total += 2")
+	if got := run(t, in, "total"); got != int64(3) {
+		t.Errorf("expected total=3, got=%#v", got)
+	}
+}
+
+func TestGlobalsOnlyTypedOnceRun(t *testing.T) {
+	in := New()
+	if _, err := in.Compile(`total = 1; total + "a"`); err == nil {
+		t.Fatalf("expected a type error")
+	}
+	if _, err := in.Compile("total = 1"); err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+
+	// neither program ran, so total is still free to be a string
+	if got := run(t, in, `total = "a"; total`); got != "a" {
+		t.Errorf(`expected total="a", got=%#v`, got)
+	}
+}
+
+func TestSetGlobal(t *testing.T) {
+	in := New()
+	if err := in.SetGlobal("limits", map[string][]int{"a": {1, 2}}); err != nil {
+		t.Fatalf("SetGlobal returned error: %v", err)
+	}
+	if got := run(t, in, `len(limits["a"])`); got != int64(2) {
+		t.Errorf("expected 2, got=%#v", got)
+	}
+
+	if _, err := in.Compile(`limits["a"] + 1`); err == nil {
+		t.Errorf("expected a type error adding to an array[int]")
+	}
+
+	errs := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"text", "global limits of type dict[array[int]] can not be set to string"},
+		{nil, "global limits can not be nil"},
+		{map[int]int{}, "global limits: dict keys must be strings, got=int"},
+		{struct{}{}, "global limits: no glimmer type for struct {}"},
+	}
+	for _, tt := range errs {
+		if err := in.SetGlobal("limits", tt.value); err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error setting %#v. expected=%q, got=%v", tt.value, tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	in := New()
+	calls := []string{}
+	err := in.RegisterFunc("greet", func(name string, times int64) string {
+		calls = append(calls, name)
+		return strings.Repeat("hi "+name+" ", int(times))
+	}, "fn(string, int) -> string")
+	if err != nil {
+		t.Fatalf("RegisterFunc returned error: %v", err)
+	}
+	err = in.RegisterFunc("sum", func(xs []float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}, "fn(array[float]) -> float")
+	if err != nil {
+		t.Fatalf("RegisterFunc returned error: %v", err)
+	}
+
+	if got := run(t, in, `"bob" | greet(2)`); got != "hi bob hi bob " {
+		t.Errorf("wrong greeting, got=%#v", got)
+	}
+	if got := run(t, in, "sum([1.5, 2.5])"); got != 4.0 {
+		t.Errorf("wrong sum, got=%#v", got)
+	}
+	if len(calls) != 1 || calls[0] != "bob" {
+		t.Errorf("greet was not called once with bob, calls=%v", calls)
+	}
+
+	typeErrs := []struct {
+		input    string
+		expected string
+	}{
+		{`greet(1, 2)`, "Static TypeError at [1,6]: param type mismatch for param 1 in call"},
+		{`greet("bob")`, "Static TypeError at [1,6]: invalid number of arguments in call"},
+		{`x = greet("bob", 1) + 1`, "Static TypeError at [1,21]: infix operator for 'string + int' not found"},
+	}
+	for _, tt := range typeErrs {
+		if _, err := in.Compile(tt.input); err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterFuncErrors(t *testing.T) {
+	in := New()
+	err := in.RegisterFunc("check", func(n int) error {
+		if n < 0 {
+			return errors.New("negative")
+		}
+		return nil
+	}, "fn(int) -> none")
+	if err != nil {
+		t.Fatalf("RegisterFunc returned error: %v", err)
+	}
+
+	run(t, in, "check(1)")
+	prog, _ := in.Compile("check(-1)")
+	if _, err := in.Run(context.Background(), prog); err == nil || err.Error() != "Runtime Error at [1,6]: negative" {
+		t.Errorf("wrong runtime error, got=%v", err)
+	}
+
+	err = in.RegisterFunc("small", func(n uint8) uint8 { return n }, "fn(int) -> int")
+	if err != nil {
+		t.Fatalf("RegisterFunc returned error: %v", err)
+	}
+	if got := run(t, in, "small(255)"); got != int64(255) {
+		t.Errorf("expected 255, got=%#v", got)
+	}
+	for _, input := range []string{"small(256)", "small(-1)"} {
+		prog, _ := in.Compile(input)
+		expected := "Runtime Error at [1,6]: " + input[6:len(input)-1] + " overflows uint8"
+		if _, err := in.Run(context.Background(), prog); err == nil || err.Error() != expected {
+			t.Errorf("wrong runtime error for %q. expected=%q, got=%v", input, expected, err)
+		}
+	}
+
+	tests := []struct {
+		fn        interface{}
+		signature string
+		expected  string
+	}{
+		{1, "fn(int) -> int", "f: expected a function, got=int"},
+		{func(int) int { return 0 }, "int", "signature of f is not a function type: int"},
+		{func(int) int { return 0 }, "fn(int) -> ", "signature of f: [1,12]: type not recognized: EOF"},
+		{func(string) int { return 0 }, "fn(int) -> int", "f: param 1 of func(string) int does not match int"},
+		{func(int) int { return 0 }, "fn(int, int) -> int", "f: function func(int) int does not match fn(int, int) -> int"},
+		{func(int) {}, "fn(int) -> int", "f: function func(int) returns nothing, expected int"},
+		{func(int) (int, int) { return 0, 0 }, "fn(int) -> int", "f: function func(int) (int, int) must return at most a value and an error"},
+		{func(int) float64 { return 0 }, "fn(int) -> int", "f: return of func(int) float64 does not match int"},
+	}
+	for _, tt := range tests {
+		if err := in.RegisterFunc("f", tt.fn, tt.signature); err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error registering %T as %q. expected=%q, got=%v", tt.fn, tt.signature, tt.expected, err)
+		}
+	}
+}
+
+func TestRunStopsWhenContextDone(t *testing.T) {
+	in := New()
+	prog, err := in.Compile("x = 0\nwhile true { x += 1 }")
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := in.Run(ctx, prog); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got=%v", err)
+	}
+
+	// the interpreter is still usable, with the state the program left
+	if got := run(t, in, "x > 0"); got != true {
+		t.Errorf("expected x to have been incremented, got=%#v", got)
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	in := New()
+	in.SetLimits(object.Limits{MaxSteps: 500})
+
+	prog, err := in.Compile("x = 0\nwhile x < 1000 { x += 1 }")
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+	if _, err := in.Run(context.Background(), prog); err == nil || err.Error() != "Limit Error at [2,24]: step limit of 500 exceeded" {
+		t.Errorf("wrong error, got=%v", err)
+	}
+
+	// each run has the whole budget
+	for i := 0; i < 3; i++ {
+		if got := run(t, in, "x = 0\nwhile x < 10 { x += 1 }\nx"); got != int64(10) {
+			t.Errorf("expected 10, got=%#v", got)
+		}
+	}
+}
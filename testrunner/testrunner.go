@@ -0,0 +1,49 @@
+// Package testrunner runs the test blocks of a program, each in an
+// environment of its own.
+package testrunner
+
+import (
+	"fmt"
+	"glimmer/ast"
+	"glimmer/evaluator"
+	"glimmer/object"
+	"io"
+	"strings"
+)
+
+// Run runs each test of program in a fresh environment from newEnv, in which
+// the program's other statements run first, so that a test sees the
+// definitions around it but nothing another test did. It prints a line per
+// test to out, with the error of each that fails, and returns the counts.
+func Run(program *ast.Program, newEnv func() *object.Environment, out io.Writer) (passed, failed int) {
+	tests := []*ast.TestStatement{}
+	for _, stmt := range program.Statements {
+		if test, ok := stmt.(*ast.TestStatement); ok {
+			tests = append(tests, test)
+		}
+	}
+
+	for _, test := range tests {
+		errObj := runTest(test, program, newEnv())
+		if errObj == nil {
+			passed++
+			fmt.Fprintf(out, "PASS %s\n", test.Name.Value)
+			continue
+		}
+		failed++
+		fmt.Fprintf(out, "FAIL %s\n", test.Name.Value)
+		fmt.Fprintf(out, "    %s\n", strings.ReplaceAll(errObj.Traceback(), "\n", "\n    "))
+	}
+	return passed, failed
+}
+
+// runTest runs program, whose tests the evaluator skips, and then test
+func runTest(test *ast.TestStatement, program *ast.Program, env *object.Environment) *object.Error {
+	if errObj, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		return errObj
+	}
+	if errObj, ok := evaluator.Eval(test.Body, object.NewEnclosedEnvironment(env)).(*object.Error); ok {
+		return errObj
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package testrunner
+
+import (
+	"bytes"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"testing"
+)
+
+const program = `counter = [0]
+add = fn(a: int, b: int) -> int { a + b }
+
+test "adds" {
+    assert_eq(add(1, 2), 3)
+}
+
+test "changes globals" {
+    counter = push(counter, 1)
+    assert_eq(len(counter), 2)
+}
+
+test "sees fresh globals" {
+    assert(len(counter) == 1)
+}
+
+test "fails" {
+    total = add(2, 2)
+    assert_eq(total, 5)
+}
+
+test "errors" {
+    x = [1][3]
+}`
+
+func TestRun(t *testing.T) {
+	p := parser.New(lexer.New(program))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var out bytes.Buffer
+	passed, failed := Run(prog, object.NewEnvironment, &out)
+
+	if passed != 3 || failed != 2 {
+		t.Errorf("wrong counts. expected 3 passed and 2 failed, got=%d and %d", passed, failed)
+	}
+
+	expected := `PASS adds
+PASS changes globals
+PASS sees fresh globals
+FAIL fails
+    Runtime Error at [19,14]: assertion failed: 4 != 5 in assert_eq(total, 5)
+FAIL errors
+    Runtime Error at [23,12]: Index 3 out of range for array of length 1
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestRunSetupError(t *testing.T) {
+	p := parser.New(lexer.New("throw(\"broken\")\ntest \"never passes\" { assert(true) }"))
+	prog := p.ParseProgram()
+
+	var out bytes.Buffer
+	passed, failed := Run(prog, object.NewEnvironment, &out)
+
+	expected := "FAIL never passes\n    Runtime Error at [1,6]: broken\n"
+	if passed != 0 || failed != 1 || out.String() != expected {
+		t.Errorf("wrong result. got %d passed, %d failed, output=%q", passed, failed, out.String())
+	}
+}
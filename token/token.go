@@ -19,6 +19,8 @@ const (
 	FLOAT  = "FLOAT"  // 123.456
 	STRING = "STRING" // "Hello, World!"
 
+	COMMENT = "COMMENT" // # to the end of the line, kept aside by the lexer
+
 	// Operators
 	ASSIGN  = "="
 	PLUS    = "+"
@@ -45,10 +47,12 @@ const (
 	PIPE = "|"
 
 	// Delimiters
-	COMMA   = ","
-	COLON   = ":"
-	SEMICOL = ";"
-	ARROW   = "->"
+	COMMA    = ","
+	COLON    = ":"
+	SEMICOL  = ";"
+	ARROW    = "->"
+	FATARROW = "=>"
+	DOT      = "."
 
 	LPAR     = "("
 	RPAR     = ")"
@@ -66,10 +70,19 @@ const (
 	ELSE     = "ELSE"
 	FOR      = "FOR"
 	IN       = "IN"
+	NOTIN    = "NOTIN" // the not of `not in`, an identifier anywhere else
 	WHILE    = "WHILE"
 	BREAK    = "BREAK"
 	CONT     = "CONTINUE"
 	RETURN   = "RETURN"
+	STRUCT   = "STRUCT"
+	IMPORT   = "IMPORT"
+	AS       = "AS"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	ENUM     = "ENUM"
+	MATCH    = "MATCH"
+	TEST     = "TEST"
 
 	// Type Keywords
 	INTEGER_TYPE = "INTEGER_TYPE"
@@ -96,6 +109,14 @@ var keywords = map[string]TokenType{
 	"break":    BREAK,
 	"continue": CONT,
 	"return":   RETURN,
+	"struct":   STRUCT,
+	"import":   IMPORT,
+	"as":       AS,
+	"try":      TRY,
+	"catch":    CATCH,
+	"enum":     ENUM,
+	"match":    MATCH,
+	"test":     TEST,
 	"int":      INTEGER_TYPE,
 	"float":    FLOAT_TYPE,
 	"bool":     BOOLEAN_TYPE,
@@ -4,18 +4,39 @@ import (
 	"fmt"
 	"glimmer/ast"
 	"glimmer/types"
+	"sort"
+	"strings"
 )
 
 func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode {
+	// each argument is typed once, and one that errors is the error of the
+	// call, not a mismatch
+	args := make([]types.TypeNode, len(node.Arguments))
+	for idx, arg := range node.Arguments {
+		if args[idx] = Typeof(arg, ctx); args[idx].Type() == types.ERROR {
+			return args[idx]
+		}
+	}
+
 	switch node.Function.(*ast.Identifier).Value {
 	case "print":
 		return &types.NoneType{}
+	case "throw":
+		if len(node.Arguments) != 1 {
+			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to throw, got=%d", len(node.Arguments)),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		if argType := args[0]; argType.Type() != types.STRING {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument to throw must be string, got=%s", argType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return NEVER_T
 	case "len":
 		if len(node.Arguments) != 1 {
 			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to len, got=%d", len(node.Arguments)),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		argType := Typeof(node.Arguments[0], ctx)
+		argType := args[0]
 		if argType.Type() != types.ARRAY && argType.Type() != types.STRING {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument to len must be array or string, got=%s", argType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
@@ -26,7 +47,7 @@ func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode
 			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to head, got=%d", len(node.Arguments)),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		argType := Typeof(node.Arguments[0], ctx)
+		argType := args[0]
 		if argType.Type() != types.ARRAY {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument to head must be array, got=%s", argType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
@@ -37,7 +58,7 @@ func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode
 			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to tail, got=%d", len(node.Arguments)),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		argType := Typeof(node.Arguments[0], ctx)
+		argType := args[0]
 		if argType.Type() != types.ARRAY {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument to tail must be array, got=%s", argType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
@@ -48,17 +69,17 @@ func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode
 			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to slice, got=%d", len(node.Arguments)),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		arrType := Typeof(node.Arguments[0], ctx)
+		arrType := args[0]
 		if arrType.Type() != types.ARRAY {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to slice must be array, got=%s", arrType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		beginType := Typeof(node.Arguments[1], ctx)
+		beginType := args[1]
 		if beginType.Type() != types.INTEGER {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to slice must be int, got=%s", beginType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		endType := Typeof(node.Arguments[2], ctx)
+		endType := args[2]
 		if endType.Type() != types.INTEGER {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 3 to slice must be int, got=%s", endType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
@@ -69,14 +90,14 @@ func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode
 			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to push, got=%d", len(node.Arguments)),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		arrType := Typeof(node.Arguments[0], ctx)
+		arrType := args[0]
 		if arrType.Type() != types.ARRAY {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to push must be array, got=%s", arrType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		pushedType := Typeof(node.Arguments[1], ctx)
+		pushedType := args[1]
 		held := arrType.(*types.ArrayType).HeldType
-		if pushedType.String() != held.String() {
+		if !types.Equal(pushedType, held) {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to push must be match Argument 1's held type: %s, got=%s",
 				held.String(), pushedType.String()), Line: node.Token.Line, Col: node.Token.Col}
 		}
@@ -86,7 +107,7 @@ func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode
 			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to pop, got=%d", len(node.Arguments)),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
-		arrType := Typeof(node.Arguments[0], ctx)
+		arrType := args[0]
 		if arrType.Type() != types.ARRAY {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to pop must be array, got=%s", arrType.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
@@ -98,35 +119,395 @@ func typeofBuiltin(node *ast.CallExpression, ctx *types.Context) types.TypeNode
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
 
-		if t1 := Typeof(node.Arguments[0], ctx); t1.Type() != types.INTEGER {
+		if t1 := args[0]; t1.Type() != types.INTEGER {
 			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to range must be int, got=%s", t1.String()),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
 		if len(node.Arguments) > 1 {
-			if t2 := Typeof(node.Arguments[1], ctx); t2.Type() != types.INTEGER {
+			if t2 := args[1]; t2.Type() != types.INTEGER {
 				return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to range must be int, got=%s", t2.String()),
 					Line: node.Token.Line, Col: node.Token.Col}
 			}
 		}
 		if len(node.Arguments) > 2 {
-			if t3 := Typeof(node.Arguments[2], ctx); t3.Type() != types.INTEGER {
+			if t3 := args[2]; t3.Type() != types.INTEGER {
 				return &types.ErrorType{Msg: fmt.Sprintf("Argument 3 to range must be int, got=%s", t3.String()),
 					Line: node.Token.Line, Col: node.Token.Col}
 			}
 		}
 		return &types.ArrayType{HeldType: INT_T}
+	case "assert":
+		if len(node.Arguments) != 1 {
+			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to assert, got=%d", len(node.Arguments)),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		argType := args[0]
+		if argType.Type() == types.ERROR {
+			return argType
+		}
+		if argType.Type() != types.BOOLEAN {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument to assert must be bool, got=%s", argType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return &types.NoneType{}
+	case "assert_eq":
+		if len(node.Arguments) != 2 {
+			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to assert_eq, got=%d", len(node.Arguments)),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		gotType := args[0]
+		if gotType.Type() == types.ERROR {
+			return gotType
+		}
+		wantType := args[1]
+		if wantType.Type() == types.ERROR {
+			return wantType
+		}
+		if !types.Equal(gotType, wantType) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Arguments to assert_eq must share a type, got=%s and %s",
+				gotType.String(), wantType.String()), Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return &types.NoneType{}
+	case "format":
+		if len(node.Arguments) < 1 {
+			return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to format, got=%d", len(node.Arguments)),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		if layoutType := args[0]; layoutType.Type() != types.STRING {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to format must be string, got=%s", layoutType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		// a literal format string is checked against the arguments before it runs
+		if layout, ok := node.Arguments[0].(*ast.StringLiteral); ok {
+			if holes := strings.Count(layout.Value, "{}"); holes != len(node.Arguments)-1 {
+				return &types.ErrorType{Msg: fmt.Sprintf("format string has %d placeholders, got %d arguments",
+					holes, len(node.Arguments)-1), Line: node.Token.Line, Col: node.Token.Col}
+			}
+		}
+		return STRING_T
+	}
+
+	name := node.Function.(*ast.Identifier).Value
+	if sig, ok := stringBuiltinTypes[name]; ok {
+		return typeofSignature(name, sig, node, args)
+	}
+	if _, ok := collectionBuiltins[name]; ok {
+		return typeofCollectionBuiltin(name, node, args)
+	}
+	if _, ok := dictBuiltins[name]; ok {
+		return typeofDictBuiltin(name, node, args)
+	}
+	return &types.ErrorType{Msg: fmt.Sprintf("builtin not recognized: %s", node.Function.String()),
+		Line: node.Token.Line, Col: node.Token.Col}
+}
+
+// stringBuiltinTypes are the signatures of the string builtins but format,
+// which takes any number of arguments
+var stringBuiltinTypes = map[string]*types.FunctionType{
+	"split":       {ParamTypes: []types.TypeNode{STRING_T, STRING_T}, ReturnType: &types.ArrayType{HeldType: STRING_T}},
+	"join":        {ParamTypes: []types.TypeNode{&types.ArrayType{HeldType: STRING_T}, STRING_T}, ReturnType: STRING_T},
+	"trim":        {ParamTypes: []types.TypeNode{STRING_T}, ReturnType: STRING_T},
+	"upper":       {ParamTypes: []types.TypeNode{STRING_T}, ReturnType: STRING_T},
+	"lower":       {ParamTypes: []types.TypeNode{STRING_T}, ReturnType: STRING_T},
+	"contains":    {ParamTypes: []types.TypeNode{STRING_T, STRING_T}, ReturnType: BOOL_T},
+	"starts_with": {ParamTypes: []types.TypeNode{STRING_T, STRING_T}, ReturnType: BOOL_T},
+	"ends_with":   {ParamTypes: []types.TypeNode{STRING_T, STRING_T}, ReturnType: BOOL_T},
+	"index_of":    {ParamTypes: []types.TypeNode{STRING_T, STRING_T}, ReturnType: INT_T},
+	"replace":     {ParamTypes: []types.TypeNode{STRING_T, STRING_T, STRING_T}, ReturnType: STRING_T},
+	"substr":      {ParamTypes: []types.TypeNode{STRING_T, INT_T, INT_T}, ReturnType: STRING_T},
+	"chars":       {ParamTypes: []types.TypeNode{STRING_T}, ReturnType: &types.ArrayType{HeldType: STRING_T}},
+}
+
+// typeofSignature checks the arguments of a call of the builtin name against
+// its signature sig
+func typeofSignature(name string, sig *types.FunctionType, node *ast.CallExpression, args []types.TypeNode) types.TypeNode {
+	if len(node.Arguments) != len(sig.ParamTypes) {
+		return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to %s, got=%d", name, len(node.Arguments)),
+			Line: node.Token.Line, Col: node.Token.Col}
 	}
-	panic("Builtin not recognized, this should never happen")
+	for idx, param := range sig.ParamTypes {
+		if argType := args[idx]; !types.Equal(argType, param) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument %d to %s must be %s, got=%s", idx+1, name, param.String(), argType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+	}
+	return sig.ReturnType
 }
 
 // map acting as set
 var builtinExists = map[string]bool{
-	"print": true,
-	"len":   true,
-	"head":  true,
-	"tail":  true,
-	"slice": true,
-	"push":  true,
-	"pop":   true,
-	"range": true,
+	"print":     true,
+	"len":       true,
+	"head":      true,
+	"tail":      true,
+	"slice":     true,
+	"push":      true,
+	"pop":       true,
+	"range":     true,
+	"throw":     true,
+	"assert":    true,
+	"assert_eq": true,
+
+	"split":       true,
+	"join":        true,
+	"trim":        true,
+	"upper":       true,
+	"lower":       true,
+	"contains":    true,
+	"starts_with": true,
+	"ends_with":   true,
+	"index_of":    true,
+	"replace":     true,
+	"substr":      true,
+	"chars":       true,
+	"format":      true,
+
+	"map":       true,
+	"filter":    true,
+	"reduce":    true,
+	"any":       true,
+	"all":       true,
+	"find":      true,
+	"sort":      true,
+	"sort_by":   true,
+	"zip":       true,
+	"enumerate": true,
+	"flatten":   true,
+	"reverse":   true,
+
+	"keys":   true,
+	"values": true,
+	"items":  true,
+	"has":    true,
+	"get":    true,
+	"delete": true,
+	"merge":  true,
+}
+
+// collectionBuiltins are the builtins typed by typeofCollectionBuiltin, by
+// their number of arguments
+var collectionBuiltins = map[string]int{
+	"map": 2, "filter": 2, "reduce": 3, "any": 2, "all": 2, "find": 2, "sort": 1,
+	"sort_by": 2, "zip": 3, "enumerate": 2, "flatten": 1, "reverse": 1,
+}
+
+// typeofCollectionBuiltin types the builtins taking an array, most of them
+// with a function to call on its elements, whose types follow from those of
+// the array and the function
+func typeofCollectionBuiltin(name string, node *ast.CallExpression, args []types.TypeNode) types.TypeNode {
+	numArgs := collectionBuiltins[name]
+	if len(node.Arguments) != numArgs && !(name == "zip" && len(node.Arguments) == 2) {
+		return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to %s, got=%d", name, len(node.Arguments)),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	arrType, err := arrayArgType(name, node, 0, args)
+	if err != nil {
+		return err
+	}
+	held := arrType.HeldType
+
+	switch name {
+	case "map":
+		fn, err := callbackType(name, node, 1, args, held)
+		if err != nil {
+			return err
+		}
+		return &types.ArrayType{HeldType: fn.ReturnType}
+	case "filter", "any", "all", "find":
+		fn, err := callbackType(name, node, 1, args, held)
+		if err != nil {
+			return err
+		}
+		if fn.ReturnType.Type() != types.BOOLEAN {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to %s must return bool, got=%s", name, fn.ReturnType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		switch name {
+		case "filter":
+			return arrType
+		case "find":
+			return INT_T
+		}
+		return BOOL_T
+	case "reduce":
+		initType := args[2]
+		fn, err := callbackType(name, node, 1, args, initType, held)
+		if err != nil {
+			return err
+		}
+		if !types.Equal(fn.ReturnType, initType) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to reduce must return %s, got=%s", initType.String(), fn.ReturnType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return initType
+	case "sort":
+		if !isSortable(held) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to sort must hold int, float or string, got=%s", arrType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return arrType
+	case "sort_by":
+		fn, err := callbackType(name, node, 1, args, held)
+		if err != nil {
+			return err
+		}
+		if !isSortable(fn.ReturnType) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to sort_by must return int, float or string, got=%s", fn.ReturnType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return arrType
+	case "zip":
+		otherType, err := arrayArgType(name, node, 1, args)
+		if err != nil {
+			return err
+		}
+		if len(node.Arguments) == 2 {
+			// the pairs are arrays, so the elements must share a type
+			if !types.Equal(held, otherType.HeldType) {
+				return &types.ErrorType{Msg: fmt.Sprintf("Arguments to zip must hold the same type without a function to combine them, got=%s and %s",
+					arrType.String(), otherType.String()), Line: node.Token.Line, Col: node.Token.Col}
+			}
+			return &types.ArrayType{HeldType: arrType}
+		}
+		fn, err := callbackType(name, node, 2, args, held, otherType.HeldType)
+		if err != nil {
+			return err
+		}
+		return &types.ArrayType{HeldType: fn.ReturnType}
+	case "enumerate":
+		fn, err := callbackType(name, node, 1, args, INT_T, held)
+		if err != nil {
+			return err
+		}
+		return &types.ArrayType{HeldType: fn.ReturnType}
+	case "flatten":
+		inner, ok := held.(*types.ArrayType)
+		if !ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 1 to flatten must hold arrays, got=%s", arrType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return inner
+	}
+	return arrType // reverse
+}
+
+// arrayArgType is the type of the argument at idx of a call of the builtin
+// name, which must be an array
+func arrayArgType(name string, node *ast.CallExpression, idx int, args []types.TypeNode) (*types.ArrayType, *types.ErrorType) {
+	argType := args[idx]
+	arrType, ok := argType.(*types.ArrayType)
+	if !ok {
+		return nil, &types.ErrorType{Msg: fmt.Sprintf("Argument %d to %s must be array, got=%s", idx+1, name, argType.String()),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	return arrType, nil
+}
+
+// callbackType is the type of the argument at idx of a call of the builtin
+// name, which must be a function taking params
+func callbackType(name string, node *ast.CallExpression, idx int, args []types.TypeNode, params ...types.TypeNode) (*types.FunctionType, *types.ErrorType) {
+	argType := args[idx]
+	fn, ok := argType.(*types.FunctionType)
+	matches := ok && len(fn.TypeParams) == 0 && len(fn.ParamTypes) == len(params)
+	for i := 0; matches && i < len(params); i++ {
+		matches = types.Equal(fn.ParamTypes[i], params[i])
+	}
+	if !matches {
+		paramStrs := make([]string, len(params))
+		for i, param := range params {
+			paramStrs[i] = param.String()
+		}
+		return nil, &types.ErrorType{Msg: fmt.Sprintf("Argument %d to %s must be a function taking (%s), got=%s",
+			idx+1, name, strings.Join(paramStrs, ", "), argType.String()), Line: node.Token.Line, Col: node.Token.Col}
+	}
+	return fn, nil
+}
+
+// dictBuiltins are the builtins typed by typeofDictBuiltin, by their number
+// of arguments
+var dictBuiltins = map[string]int{
+	"keys": 1, "values": 1, "items": 2, "has": 2, "get": 3, "delete": 2, "merge": 2,
+}
+
+// typeofDictBuiltin types the builtins taking a dict first. Those taking a key
+// next need a string, and the others a value of the dict's type.
+func typeofDictBuiltin(name string, node *ast.CallExpression, args []types.TypeNode) types.TypeNode {
+	if len(node.Arguments) != dictBuiltins[name] {
+		return &types.ErrorType{Msg: fmt.Sprintf("Incorrect num of arguments to %s, got=%d", name, len(node.Arguments)),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	dictType, err := dictArgType(name, node, 0, args)
+	if err != nil {
+		return err
+	}
+	held := dictType.HeldType
+
+	switch name {
+	case "keys":
+		return &types.ArrayType{HeldType: STRING_T}
+	case "values":
+		return &types.ArrayType{HeldType: held}
+	case "items":
+		fn, err := callbackType(name, node, 1, args, STRING_T, held)
+		if err != nil {
+			return err
+		}
+		return &types.ArrayType{HeldType: fn.ReturnType}
+	case "merge":
+		otherType, err := dictArgType(name, node, 1, args)
+		if err != nil {
+			return err
+		}
+		if !types.Equal(otherType, dictType) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to merge must be %s, got=%s", dictType.String(), otherType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return dictType
+	}
+
+	if keyType := args[1]; keyType.Type() != types.STRING {
+		return &types.ErrorType{Msg: fmt.Sprintf("Argument 2 to %s must be string, got=%s", name, keyType.String()),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	switch name {
+	case "has":
+		return BOOL_T
+	case "get":
+		if defType := args[2]; !types.Equal(defType, held) {
+			return &types.ErrorType{Msg: fmt.Sprintf("Argument 3 to get must be %s, got=%s", held.String(), defType.String()),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		return held
+	}
+	return dictType // delete
+}
+
+// dictArgType is the type of the argument at idx of a call of the builtin
+// name, which must be a dict
+func dictArgType(name string, node *ast.CallExpression, idx int, args []types.TypeNode) (*types.DictType, *types.ErrorType) {
+	argType := args[idx]
+	dictType, ok := argType.(*types.DictType)
+	if !ok {
+		return nil, &types.ErrorType{Msg: fmt.Sprintf("Argument %d to %s must be dict, got=%s", idx+1, name, argType.String()),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	return dictType, nil
+}
+
+func isSortable(typ types.TypeNode) bool {
+	switch typ.Type() {
+	case types.INTEGER, types.FLOAT, types.STRING:
+		return true
+	}
+	return false
+}
+
+// Builtins returns the names of the builtin functions, sorted
+func Builtins() []string {
+	names := []string{}
+	for name := range builtinExists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
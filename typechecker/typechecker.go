@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"glimmer/ast"
 	"glimmer/types"
+	"sort"
+	"strings"
 )
 
 // flyweights
@@ -13,6 +15,7 @@ var (
 	BOOL_T   = &types.BooleanType{}
 	STRING_T = &types.StringType{}
 	NONE_T   = &types.NoneType{}
+	NEVER_T  = &types.NeverType{}
 )
 
 func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
@@ -24,18 +27,22 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 		return Typeof(node.ReturnValue, ctx)
 
 	case *ast.AssignStatement:
+		if node.Target != nil {
+			return typeofTargetAssignStatement(node, ctx)
+		}
+
 		var valType types.TypeNode
 		if fun, ok := node.Value.(*ast.FunctionLiteral); ok {
-			valType = typeofFunctionLiteral(fun, ctx, &node.Name.Value) // handle recursion case
+			valType = typeofFunctionLiteral(fun, ctx, node.Name) // handle recursion case
 		} else {
-			valType = Typeof(node.Value, ctx)
+			prev, _ := ctx.Get(node.Name.Value) // a reassigned {} takes the value type it had
+			valType = typeofWant(node.Value, prev, ctx)
 		}
 
-		ctx.Set(node.Name.Value, valType)
 		if valType.Type() == types.ERROR {
 			return valType
 		}
-		return NONE_T
+		return assignType(node.Name, valType, ctx)
 
 	case *ast.IfStatement:
 		return typeofIfStatement(node, ctx)
@@ -46,6 +53,18 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 	case *ast.WhileStatement:
 		return typeofWhileStatement(node, ctx)
 
+	case *ast.StructStatement:
+		return typeofStructStatement(node, ctx)
+
+	case *ast.EnumStatement:
+		return typeofEnumStatement(node, ctx)
+
+	case *ast.ImportStatement:
+		return typeofImportStatement(node, ctx)
+
+	case *ast.TestStatement:
+		return typeofTestStatement(node, ctx)
+
 	case *ast.ExpressionStatement:
 		return Typeof(node.Expression, ctx)
 
@@ -55,6 +74,12 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 	case *ast.IfExpression:
 		return typeofIfExpression(node, ctx)
 
+	case *ast.TryExpression:
+		return typeofTryExpression(node, ctx)
+
+	case *ast.MatchExpression:
+		return typeofMatchExpression(node, ctx)
+
 	case *ast.BreakStatement:
 		return NONE_T
 
@@ -73,6 +98,9 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 	case *ast.IndexExpression:
 		return typeofIndexExpression(node, ctx)
 
+	case *ast.FieldAccessExpression:
+		return typeofFieldAccessExpression(node, ctx)
+
 	case *ast.FunctionLiteral:
 		return typeofFunctionLiteral(node, ctx, nil)
 
@@ -82,6 +110,9 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 			return &types.ErrorType{Msg: fmt.Sprintf("identifier not found: %s", node.Value),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
+		def, _ := ctx.Def(node.Value)
+		ctx.Record(node.Token, typ, def)
+		ctx.Capture(node.Value)
 		return typ
 
 	case *ast.ArrayLiteral:
@@ -90,6 +121,9 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 	case *ast.DictLiteral:
 		return typeofDictLiteral(node, ctx)
 
+	case *ast.StructLiteral:
+		return typeofStructLiteral(node, ctx)
+
 	case *ast.StringLiteral:
 		return STRING_T
 
@@ -103,21 +137,176 @@ func Typeof(node ast.Node, ctx *types.Context) types.TypeNode {
 		return BOOL_T
 	}
 
-	return nil
+	return unknownNode(node)
+}
+
+// unknownNode is the error for a node the typechecker has no rule for, which
+// is a bug in the typechecker rather than the program
+func unknownNode(node ast.Node) types.TypeNode {
+	if node == nil {
+		return &types.ErrorType{Msg: "can not typecheck a missing node"}
+	}
+	pos := node.Pos()
+	return &types.ErrorType{Msg: fmt.Sprintf("can not typecheck %T: %s", node, node.String()),
+		Line: pos.Line, Col: pos.Col}
+}
+
+// Check typechecks program in ctx like Typeof, but rather than stopping at the
+// first error, it checks on past each to return every independent one, sorted
+// by position. A name whose definition failed takes the error as its type,
+// so that its uses propagate that error rather than erroring anew.
+func Check(program *ast.Program, ctx *types.Context) []*types.ErrorType {
+	errs := []*types.ErrorType{}
+	reported := map[*types.ErrorType]bool{}
+	ctx.SetReporter(func(err *types.ErrorType) {
+		if !reported[err] {
+			reported[err] = true
+			errs = append(errs, err)
+		}
+	})
+	defer ctx.SetReporter(nil)
+
+	typeofProgram(program, ctx)
+
+	// the names bound to recover are not defined for later programs
+	for name, typ := range ctx.Members() {
+		if typ.Type() == types.ERROR {
+			ctx.Unset(name)
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Col < errs[j].Col
+	})
+	return errs
 }
 
 func typeofProgram(program *ast.Program, ctx *types.Context) types.TypeNode {
-	var result types.TypeNode
+	var result types.TypeNode = NONE_T // of an empty program
+	var first *types.ErrorType
 
 	// TODO: match returns of entire program
+	// tests run once every other statement has, so they are checked last
+	tests := []ast.Statement{}
 	for _, stmt := range program.Statements {
+		if _, ok := stmt.(*ast.TestStatement); ok {
+			tests = append(tests, stmt)
+			result = NONE_T
+			continue
+		}
 		result = Typeof(stmt, ctx)
-		// early exit condition(s)
-		switch result := result.(type) {
-		case *types.ErrorType:
-			return result
+		if err, ok := result.(*types.ErrorType); ok {
+			if !recoverFrom(stmt, err, ctx) {
+				return err
+			}
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	for _, stmt := range tests {
+		if err, ok := Typeof(stmt, ctx).(*types.ErrorType); ok {
+			if !recoverFrom(stmt, err, ctx) {
+				return err
+			}
+			if first == nil {
+				first = err
+			}
 		}
 	}
 
+	if first != nil {
+		return first
+	}
 	return result
 }
+
+// recoverFrom reports the error of stmt, binding the names stmt failed to
+// define to it. It returns false, leaving the caller to stop at the error,
+// if there is no reporter to check on past it for.
+func recoverFrom(stmt ast.Statement, err *types.ErrorType, ctx *types.Context) bool {
+	if !ctx.Report(err) {
+		return false
+	}
+
+	var name *ast.Identifier
+	switch stmt := stmt.(type) {
+	case *ast.AssignStatement:
+		if stmt.Target == nil {
+			name = stmt.Name
+		}
+	case *ast.ImportStatement:
+		name = stmt.Alias
+	case *ast.EnumStatement:
+		name = stmt.Name
+	}
+	if name != nil {
+		if _, ok := ctx.Get(name.Value); !ok {
+			ctx.Set(name.Value, err)
+		}
+	}
+	return true
+}
+
+// resolveType replaces the NamedTypes in a type annotation with the
+// user-defined types they refer to, erroring if one is not defined
+func resolveType(typ types.TypeNode, ctx *types.Context, line, col int) types.TypeNode {
+	switch typ := typ.(type) {
+	case *types.NamedType:
+		def, ok := lookupTypeDef(typ.Name, ctx)
+		if !ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("type not found: %s", typ.Name), Line: line, Col: col}
+		}
+		return def
+	case *types.ArrayType:
+		held := resolveType(typ.HeldType, ctx, line, col)
+		if held.Type() == types.ERROR {
+			return held
+		}
+		return &types.ArrayType{HeldType: held}
+	case *types.DictType:
+		held := resolveType(typ.HeldType, ctx, line, col)
+		if held.Type() == types.ERROR {
+			return held
+		}
+		return &types.DictType{HeldType: held}
+	case *types.FunctionType:
+		fun := &types.FunctionType{FnCtx: typ.FnCtx}
+		for _, pt := range typ.ParamTypes {
+			resolved := resolveType(pt, ctx, line, col)
+			if resolved.Type() == types.ERROR {
+				return resolved
+			}
+			fun.ParamTypes = append(fun.ParamTypes, resolved)
+		}
+		fun.ReturnType = resolveType(typ.ReturnType, ctx, line, col)
+		if fun.ReturnType.Type() == types.ERROR {
+			return fun.ReturnType
+		}
+		return fun
+	default:
+		return typ
+	}
+}
+
+// lookupTypeDef finds a user-defined type by name, including the types of
+// imported modules, i.e. lib.Point
+func lookupTypeDef(name string, ctx *types.Context) (types.TypeNode, bool) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) == 1 {
+		return ctx.GetTypeDef(name)
+	}
+
+	typ, ok := ctx.Get(parts[0])
+	if !ok {
+		return nil, false
+	}
+	mod, ok := typ.(*types.ModuleType)
+	if !ok {
+		return nil, false
+	}
+	return mod.Ctx.GetTypeDef(parts[1])
+}
@@ -3,7 +3,9 @@ package typechecker
 import (
 	"fmt"
 	"glimmer/ast"
+	"glimmer/token"
 	"glimmer/types"
+	"strings"
 )
 
 func typeofIfExpression(node *ast.IfExpression, ctx *types.Context) types.TypeNode {
@@ -46,25 +48,163 @@ func typeofIfExpression(node *ast.IfExpression, ctx *types.Context) types.TypeNo
 		branchTypes = append(branchTypes, NONE_T) // nonexistant else is type none
 	}
 
+	result := branchTypes[0]
 	for _, typ := range branchTypes {
-		if typ.String() != branchTypes[0].String() {
+		var ok bool
+		if result, ok = types.Unify(result, typ); !ok {
 			return &types.ErrorType{Msg: "ife branches must match types", Line: node.Token.Line, Col: node.Token.Col}
 		}
 	}
 
-	return trueType
+	return result
+}
+
+func typeofTryExpression(node *ast.TryExpression, ctx *types.Context) types.TypeNode {
+	// get types of the body and the handler, which has the error message bound
+	// error if they do not match
+	// return the matched
+	bodyType := typeofTryBlock(node.Body, ctx)
+	if bodyType.Type() == types.ERROR {
+		return bodyType
+	}
+
+	if et := assignType(node.ErrorName, STRING_T, ctx); et.Type() == types.ERROR {
+		return et
+	}
+	handlerType := typeofTryBlock(node.Handler, ctx)
+	if handlerType.Type() == types.ERROR {
+		return handlerType
+	}
+
+	result, ok := types.Unify(bodyType, handlerType)
+	if !ok {
+		return &types.ErrorType{Msg: "try and catch branches must match types", Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	return result
+}
+
+func typeofMatchExpression(node *ast.MatchExpression, ctx *types.Context) types.TypeNode {
+	// every arm names a variant of the subject's enum once and binds its whole payload
+	// error if the arms do not match types or a variant is left unhandled
+	// return the matched
+	subjType := Typeof(node.Subject, ctx)
+	if subjType.Type() == types.ERROR {
+		return subjType
+	}
+	et, ok := subjType.(*types.EnumType)
+	if !ok {
+		return &types.ErrorType{Msg: fmt.Sprintf("match subject must be an enum, got=%s", subjType.String()),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	armTypes := []types.TypeNode{}
+	handled := map[string]bool{}
+	hasWildcard := false
+	for _, arm := range node.Arms {
+		variant := arm.Variant
+		if hasWildcard {
+			return &types.ErrorType{Msg: fmt.Sprintf("match arm %s is unreachable after _", variant.Value),
+				Line: variant.Token.Line, Col: variant.Token.Col}
+		}
+
+		if variant.Value == "_" {
+			if len(arm.Bindings) != 0 {
+				return &types.ErrorType{Msg: "_ arm can not bind a payload", Line: variant.Token.Line, Col: variant.Token.Col}
+			}
+			hasWildcard = true
+		} else {
+			payload, ok := et.Payload(variant.Value)
+			if !ok {
+				return &types.ErrorType{Msg: fmt.Sprintf("enum %s has no variant %s", et.Name, variant.Value),
+					Line: variant.Token.Line, Col: variant.Token.Col}
+			}
+			if handled[variant.Value] {
+				return &types.ErrorType{Msg: fmt.Sprintf("duplicate match arm for %s", variant.Value),
+					Line: variant.Token.Line, Col: variant.Token.Col}
+			}
+			handled[variant.Value] = true
+
+			if len(arm.Bindings) != len(payload) {
+				return &types.ErrorType{Msg: fmt.Sprintf("variant %s has %d fields, got %d bindings",
+					variant.Value, len(payload), len(arm.Bindings)), Line: variant.Token.Line, Col: variant.Token.Col}
+			}
+			for idx, binding := range arm.Bindings {
+				if binding.Value == "_" {
+					continue
+				}
+				if bt := assignType(binding, payload[idx], ctx); bt.Type() == types.ERROR {
+					return bt
+				}
+			}
+		}
+
+		armType := typeofTryBlock(arm.Body, ctx)
+		if armType.Type() == types.ERROR {
+			return armType
+		}
+		armTypes = append(armTypes, armType)
+	}
+
+	if !hasWildcard {
+		missing := []string{}
+		for _, variant := range et.Variants {
+			if !handled[variant] {
+				missing = append(missing, variant)
+			}
+		}
+		if len(missing) > 0 {
+			return &types.ErrorType{Msg: fmt.Sprintf("non-exhaustive match, missing %s", strings.Join(missing, ", ")),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+	}
+
+	if len(armTypes) == 0 {
+		return NONE_T
+	}
+	result := armTypes[0]
+	for _, typ := range armTypes {
+		var ok bool
+		if result, ok = types.Unify(result, typ); !ok {
+			return &types.ErrorType{Msg: "match arms must match types", Line: node.Token.Line, Col: node.Token.Col}
+		}
+	}
+
+	return result
+}
+
+// typeofTryBlock is the type of a try, catch, or match arm block's last
+// statement, where only explicit returns are held to the function's return type
+func typeofTryBlock(node *ast.BlockStatement, ctx *types.Context) types.TypeNode {
+	var result types.TypeNode = NONE_T // of an empty block
+	for _, stmt := range node.Statements {
+		if result = typeofBodyStatement(stmt, node, ctx); result.Type() == types.ERROR {
+			return result
+		}
+	}
+	return result
 }
 
 func typeofIndexExpression(node *ast.IndexExpression, ctx *types.Context) types.TypeNode {
 	// error if not array or index is not int
 	// return inner type of array
 	contType := Typeof(node.Left, ctx)
+	if contType.Type() == types.ERROR {
+		return contType
+	}
+
+	if slice, ok := node.Index.(*ast.SliceIndex); ok {
+		return typeofSlice(node, slice, contType, ctx)
+	}
 
 	if contType.Type() != types.ARRAY && contType.Type() != types.DICT {
 		return &types.ErrorType{Msg: "indexed type must be array or dict", Line: node.Token.Line, Col: node.Token.Col}
 	}
 
 	indexType := Typeof(node.Index, ctx)
+	if indexType.Type() == types.ERROR {
+		return indexType
+	}
 
 	switch typ := contType.(type) {
 	case *types.ArrayType:
@@ -83,12 +223,38 @@ func typeofIndexExpression(node *ast.IndexExpression, ctx *types.Context) types.
 	return nil // should never happen, to please the compiler
 }
 
+// typeofSlice types a slice of an array or string as the type sliced, with
+// int bounds
+func typeofSlice(node *ast.IndexExpression, slice *ast.SliceIndex, contType types.TypeNode, ctx *types.Context) types.TypeNode {
+	if contType.Type() != types.ARRAY && contType.Type() != types.STRING {
+		return &types.ErrorType{Msg: fmt.Sprintf("sliced type must be array or string, got=%s", contType.String()),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	for _, bound := range []ast.Expression{slice.Start, slice.End, slice.Step} {
+		if bound == nil {
+			continue
+		}
+		boundType := Typeof(bound, ctx)
+		if boundType.Type() == types.ERROR {
+			return boundType
+		}
+		if boundType.Type() != types.INTEGER {
+			return &types.ErrorType{Msg: fmt.Sprintf("slice bounds must be int, got=%s", boundType.String()),
+				Line: slice.Token.Line, Col: slice.Token.Col}
+		}
+	}
+	return contType
+}
+
 func typeofCallExpression(node *ast.CallExpression, ctx *types.Context) types.TypeNode {
 	// return builtinType if function is builtin, else
 	// error if not function or params dont match
 	// return the ret type
+	// a name defined in the program shadows the builtin of that name, as it
+	// does when evaluated
 	if fnIdent, ok := node.Function.(*ast.Identifier); ok {
-		if _, ok := builtinExists[fnIdent.Value]; ok {
+		if _, defined := ctx.Get(fnIdent.Value); !defined && builtinExists[fnIdent.Value] {
 			return typeofBuiltin(node, ctx)
 		}
 	}
@@ -108,12 +274,16 @@ func typeofCallExpression(node *ast.CallExpression, ctx *types.Context) types.Ty
 		return &types.ErrorType{Msg: "invalid number of arguments in call", Line: node.Token.Line, Col: node.Token.Col}
 	}
 
+	if len(funType.TypeParams) > 0 {
+		return typeofGenericCall(node, funType, ctx)
+	}
+
 	for idx, pt := range funType.ParamTypes {
-		argType := Typeof(node.Arguments[idx], ctx)
+		argType := typeofWant(node.Arguments[idx], pt, ctx)
 		if argType.Type() == types.ERROR {
 			return argType
 		}
-		if argType.String() != pt.String() {
+		if !types.Equal(argType, pt) {
 			return &types.ErrorType{Msg: fmt.Sprintf("param type mismatch for param %d in call", idx+1),
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
@@ -127,12 +297,18 @@ func typeofPrefixExpression(node *ast.PrefixExpression, ctx *types.Context) type
 	switch node.Operator {
 	case "!":
 		inputType := Typeof(node.Right, ctx)
+		if inputType.Type() == types.ERROR {
+			return inputType
+		}
 		if !typeIsNumeric(inputType) {
 			return &types.ErrorType{Msg: "input to prefix op '!' must be numeric", Line: node.Token.Line, Col: node.Token.Col}
 		}
 		return BOOL_T
 	case "-":
 		inputType := Typeof(node.Right, ctx)
+		if inputType.Type() == types.ERROR {
+			return inputType
+		}
 		if !typeIsNumeric(inputType) {
 			return &types.ErrorType{Msg: "input to prefix op '-' must be numeric", Line: node.Token.Line, Col: node.Token.Col}
 		}
@@ -154,8 +330,18 @@ func typeofPrefixExpression(node *ast.PrefixExpression, ctx *types.Context) type
 
 func typeofInfixExpression(node *ast.InfixExpression, ctx *types.Context) types.TypeNode {
 	// look at operator and types of operands and return the correct type
+	if node.Operator == "|" { // x | f(a) is typed as the call f(x, a)
+		return typeofCallExpression(node.PipeCall(), ctx)
+	}
+
 	leftType := Typeof(node.Left, ctx)
+	if leftType.Type() == types.ERROR {
+		return leftType
+	}
 	rightType := Typeof(node.Right, ctx)
+	if rightType.Type() == types.ERROR {
+		return rightType
+	}
 
 	switch node.Operator {
 	case "+": // defined over numeric types and (string, string)
@@ -208,6 +394,8 @@ func typeofInfixExpression(node *ast.InfixExpression, ctx *types.Context) types.
 		return typeofNumericOp(node, leftType, rightType, BOOL_T)
 	case "||": // defined over numeric types
 		return typeofNumericOp(node, leftType, rightType, BOOL_T)
+	case "in", "not in": // defined over (T, array[T]), (string, dict[T]) and (string, string)
+		return typeofMembership(node, leftType, rightType)
 	default:
 		return &types.ErrorType{Msg: fmt.Sprintf("infix operator for '%s %s %s' not found", leftType.String(),
 			node.Operator, rightType.String()), Line: node.Token.Line, Col: node.Token.Col}
@@ -215,6 +403,26 @@ func typeofInfixExpression(node *ast.InfixExpression, ctx *types.Context) types.
 
 }
 
+// typeofMembership types `x in xs`, where x must be an element of an array,
+// a key of a dict or a substring of a string
+func typeofMembership(node *ast.InfixExpression, left, right types.TypeNode) types.TypeNode {
+	var want types.TypeNode = STRING_T
+	switch right := right.(type) {
+	case *types.ArrayType:
+		want = right.HeldType
+	case *types.DictType, *types.StringType:
+	default:
+		return &types.ErrorType{Msg: fmt.Sprintf("right of %s must be array, dict or string, got=%s", node.Operator,
+			right.String()), Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	if !types.Equal(left, want) {
+		return &types.ErrorType{Msg: fmt.Sprintf("left of %s must be %s for %s, got=%s", node.Operator, want.String(),
+			right.String(), left.String()), Line: node.Token.Line, Col: node.Token.Col}
+	}
+	return BOOL_T
+}
+
 func typeofNumericOp(node *ast.InfixExpression, left, right types.TypeNode, retType types.TypeNode) types.TypeNode {
 	if typeIsNumeric(left) && typeIsNumeric(right) {
 		return retType
@@ -235,3 +443,37 @@ func highestPromotion(typ1, typ2 types.TypeNode) types.TypeNode {
 		return INT_T
 	}
 }
+
+func typeofFieldAccessExpression(node *ast.FieldAccessExpression, ctx *types.Context) types.TypeNode {
+	// error if not a struct or module, or it has no such field or member
+	// return the type of the field or member
+	leftType := Typeof(node.Left, ctx)
+	if leftType.Type() == types.ERROR {
+		return leftType
+	}
+
+	if mod, ok := leftType.(*types.ModuleType); ok {
+		memberType, ok := mod.Ctx.Members()[node.Field.Value]
+		if !ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("module %s has no member %s", mod.Name, node.Field.Value),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+		ctx.Record(node.Field.Token, memberType, token.Token{})
+		return memberType
+	}
+
+	st, ok := leftType.(*types.StructType)
+	if !ok {
+		return &types.ErrorType{Msg: fmt.Sprintf("field access on non-struct type %s", leftType.String()),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	fieldType, ok := st.FieldType(node.Field.Value)
+	if !ok {
+		return &types.ErrorType{Msg: fmt.Sprintf("struct %s has no field %s", st.Name, node.Field.Value),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	ctx.Record(node.Field.Token, fieldType, token.Token{})
+
+	return fieldType
+}
@@ -0,0 +1,90 @@
+package typechecker
+
+import (
+	"fmt"
+	"glimmer/ast"
+	"glimmer/types"
+)
+
+func typeofGenericCall(node *ast.CallExpression, funType *types.FunctionType, ctx *types.Context) types.TypeNode {
+	// infer each type param by unifying param types with argument types
+	// error on a conflicting binding, or a type param the args never bind
+	// return the ret type with type params substituted
+	bindings := map[*types.TypeVar]types.TypeNode{}
+
+	for idx, pt := range funType.ParamTypes {
+		argType := Typeof(node.Arguments[idx], ctx)
+		if argType.Type() == types.ERROR {
+			return argType
+		}
+		if !unify(pt, argType, bindings) {
+			return &types.ErrorType{Msg: fmt.Sprintf("param type mismatch for param %d in call, expected=%s, got=%s",
+				idx+1, substitute(pt, bindings).String(), argType.String()), Line: node.Token.Line, Col: node.Token.Col}
+		}
+	}
+
+	for _, tp := range funType.TypeParams {
+		if _, ok := bindings[tp]; !ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("could not infer type parameter %s in call", tp.Name),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+	}
+
+	return substitute(funType.ReturnType, bindings)
+}
+
+// unify matches a param type that may contain type vars against a concrete
+// argument type, recording what each type var is bound to
+func unify(param, arg types.TypeNode, bindings map[*types.TypeVar]types.TypeNode) bool {
+	switch param := param.(type) {
+	case *types.TypeVar:
+		if bound, ok := bindings[param]; ok {
+			return types.Equal(bound, arg)
+		}
+		bindings[param] = arg
+		return true
+	case *types.ArrayType:
+		argArr, ok := arg.(*types.ArrayType)
+		return ok && unify(param.HeldType, argArr.HeldType, bindings)
+	case *types.DictType:
+		argDict, ok := arg.(*types.DictType)
+		return ok && unify(param.HeldType, argDict.HeldType, bindings)
+	case *types.FunctionType:
+		argFun, ok := arg.(*types.FunctionType)
+		if !ok || len(argFun.TypeParams) > 0 || len(param.ParamTypes) != len(argFun.ParamTypes) {
+			return false
+		}
+		for idx, pt := range param.ParamTypes {
+			if !unify(pt, argFun.ParamTypes[idx], bindings) {
+				return false
+			}
+		}
+		return unify(param.ReturnType, argFun.ReturnType, bindings)
+	default:
+		return types.Equal(param, arg)
+	}
+}
+
+// substitute replaces bound type vars in typ, leaving unbound ones in place
+func substitute(typ types.TypeNode, bindings map[*types.TypeVar]types.TypeNode) types.TypeNode {
+	switch typ := typ.(type) {
+	case *types.TypeVar:
+		if bound, ok := bindings[typ]; ok {
+			return bound
+		}
+		return typ
+	case *types.ArrayType:
+		return &types.ArrayType{HeldType: substitute(typ.HeldType, bindings)}
+	case *types.DictType:
+		return &types.DictType{HeldType: substitute(typ.HeldType, bindings)}
+	case *types.FunctionType:
+		fun := &types.FunctionType{TypeParams: typ.TypeParams, FnCtx: typ.FnCtx}
+		for _, pt := range typ.ParamTypes {
+			fun.ParamTypes = append(fun.ParamTypes, substitute(pt, bindings))
+		}
+		fun.ReturnType = substitute(typ.ReturnType, bindings)
+		return fun
+	default:
+		return typ
+	}
+}
@@ -1,36 +1,59 @@
 package typechecker
 
 import (
+	"fmt"
 	"glimmer/ast"
 	"glimmer/types"
 )
 
-func typeofFunctionLiteral(node *ast.FunctionLiteral, ctx *types.Context, bindName *string) types.TypeNode {
+func typeofFunctionLiteral(node *ast.FunctionLiteral, ctx *types.Context, bindName *ast.Identifier) types.TypeNode {
 	// create function type
 	// error if param is none
 	// error if body does not result in return type
+	// type params are defined in the function's context so annotations resolve to them
 	fun := &types.FunctionType{}
+	fun.FnCtx = types.NewEnclosedContext(ctx, &fun.ReturnType)
+
+	for _, tp := range node.TypeParams {
+		if _, ok := fun.FnCtx.GetTypeDef(tp.Value); ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("type parameter %s shadows an existing type", tp.Value),
+				Line: tp.Token.Line, Col: tp.Token.Col}
+		}
+		tv := &types.TypeVar{Name: tp.Value}
+		fun.TypeParams = append(fun.TypeParams, tv)
+		fun.FnCtx.SetTypeDef(tp.Value, tv)
+	}
 
 	for _, pt := range node.ParamTypes {
 		if pt == NONE_T {
 			return &types.ErrorType{Msg: "param can not be none type", Line: node.Token.Line, Col: node.Token.Col}
 		}
+		pt = resolveType(pt, fun.FnCtx, node.Token.Line, node.Token.Col)
+		if pt.Type() == types.ERROR {
+			return pt
+		}
 		fun.ParamTypes = append(fun.ParamTypes, pt)
 	}
 
-	fun.ReturnType = node.ReturnType
+	fun.ReturnType = resolveType(node.ReturnType, fun.FnCtx, node.Token.Line, node.Token.Col)
+	if fun.ReturnType.Type() == types.ERROR {
+		return fun.ReturnType
+	}
 
-	fun.FnCtx = types.NewEnclosedContext(ctx.DeepCopy(), &fun.ReturnType)
 	for idx, param := range node.Parameters {
-		fun.FnCtx.Set(param.Value, node.ParamTypes[idx])
+		fun.FnCtx.Bind(param.Token, fun.ParamTypes[idx])
 	}
 	if bindName != nil {
-		fun.FnCtx.Set(*bindName, fun) // add identifier binding to function context for recursion
+		fun.FnCtx.Bind(bindName.Token, fun) // add identifier binding to function context for recursion
 	}
 
 	bodyType := Typeof(node.Body, fun.FnCtx)
-	if bodyType.Type() == types.ERROR { // retType enforced in BlockStatement
-		return bodyType
+	if err, ok := bodyType.(*types.ErrorType); ok { // retType enforced in BlockStatement
+		// once reported, an error in the body leaves the function its signature's type
+		if ctx.Report(err) {
+			return fun
+		}
+		return err
 	}
 
 	return fun
@@ -42,13 +65,20 @@ func typeofArrayLiteral(node *ast.ArrayLiteral, ctx *types.Context) types.TypeNo
 	arr := &types.ArrayType{}
 
 	if len(node.Elements) == 0 {
-		arr.HeldType = node.ExplicitType // i.e. []int
+		arr.HeldType = resolveType(node.ExplicitType, ctx, node.Token.Line, node.Token.Col) // i.e. []int
+		if arr.HeldType.Type() == types.ERROR {
+			return arr.HeldType
+		}
 		return arr
 	}
 
 	arr.HeldType = Typeof(node.Elements[0], ctx)
 	for _, item := range node.Elements {
-		if Typeof(item, ctx).String() != arr.HeldType.String() {
+		itemType := Typeof(item, ctx)
+		if itemType.Type() == types.ERROR {
+			return itemType
+		}
+		if !types.Equal(itemType, arr.HeldType) {
 			return &types.ErrorType{Msg: "array must have matching types", Line: node.Token.Line, Col: node.Token.Col}
 		}
 	}
@@ -62,20 +92,101 @@ func typeofDictLiteral(node *ast.DictLiteral, ctx *types.Context) types.TypeNode
 	dict := &types.DictType{}
 
 	if len(node.Pairs) == 0 {
+		if node.ExplicitType == nil {
+			return &types.ErrorType{Msg: "can not infer the value type of {}, give it as in {}int", Line: node.Token.Line, Col: node.Token.Col}
+		}
+		dict.HeldType = resolveType(node.ExplicitType, ctx, node.Token.Line, node.Token.Col) // i.e. {}int
+		if dict.HeldType.Type() == types.ERROR {
+			return dict.HeldType
+		}
 		return dict
 	}
 
 	firstIter := true
 	for _, value := range node.Pairs {
+		valType := Typeof(value, ctx)
+		if valType.Type() == types.ERROR {
+			return valType
+		}
 		if firstIter {
-			dict.HeldType = Typeof(value, ctx)
+			dict.HeldType = valType
 			firstIter = false
 			continue
 		}
-		if Typeof(value, ctx).String() != dict.HeldType.String() {
+		if !types.Equal(valType, dict.HeldType) {
 			return &types.ErrorType{Msg: "dict must have matching value types", Line: node.Token.Line, Col: node.Token.Col}
 		}
 	}
 
 	return dict
 }
+
+// typeofWant types node where a value of type want is expected, from which an
+// empty {} takes its value type, i.e. an argument of a dict[int] param
+func typeofWant(node ast.Node, want types.TypeNode, ctx *types.Context) types.TypeNode {
+	if _, ok := want.(*types.DictType); ok && isBareDict(node) {
+		return want
+	}
+	return Typeof(node, ctx)
+}
+
+// isBareDict reports whether node is, or returns, an empty {} that does not
+// give its value type
+func isBareDict(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return isBareDict(node.Expression)
+	case *ast.ReturnStatement:
+		return isBareDict(node.ReturnValue)
+	case *ast.DictLiteral:
+		return len(node.Pairs) == 0 && node.ExplicitType == nil
+	}
+	return false
+}
+
+func typeofStructLiteral(node *ast.StructLiteral, ctx *types.Context) types.TypeNode {
+	// look up the struct type
+	// error if a field is unknown, repeated, missing, or mistyped
+	def, ok := ctx.GetTypeDef(node.Name.Value)
+	if !ok {
+		return &types.ErrorType{Msg: fmt.Sprintf("type not found: %s", node.Name.Value),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+	st, ok := def.(*types.StructType)
+	if !ok {
+		return &types.ErrorType{Msg: fmt.Sprintf("%s is not a struct type", node.Name.Value),
+			Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	seen := map[string]bool{}
+	for idx, field := range node.FieldNames {
+		fieldType, ok := st.FieldType(field.Value)
+		if !ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("struct %s has no field %s", st.Name, field.Value),
+				Line: field.Token.Line, Col: field.Token.Col}
+		}
+		if seen[field.Value] {
+			return &types.ErrorType{Msg: fmt.Sprintf("duplicate field %s in %s literal", field.Value, st.Name),
+				Line: field.Token.Line, Col: field.Token.Col}
+		}
+		seen[field.Value] = true
+
+		valType := typeofWant(node.Values[idx], fieldType, ctx)
+		if valType.Type() == types.ERROR {
+			return valType
+		}
+		if !types.Equal(valType, fieldType) {
+			return &types.ErrorType{Msg: fmt.Sprintf("field %s of %s must be %s, got=%s", field.Value, st.Name,
+				fieldType.String(), valType.String()), Line: field.Token.Line, Col: field.Token.Col}
+		}
+	}
+
+	for _, name := range st.FieldNames {
+		if !seen[name] {
+			return &types.ErrorType{Msg: fmt.Sprintf("missing field %s in %s literal", name, st.Name),
+				Line: node.Token.Line, Col: node.Token.Col}
+		}
+	}
+
+	return st
+}
@@ -1,6 +1,7 @@
 package typechecker
 
 import (
+	"fmt"
 	"glimmer/ast"
 	"glimmer/types"
 )
@@ -9,36 +10,47 @@ func typeofIfStatement(node *ast.IfStatement, ctx *types.Context) types.TypeNode
 	// get types of all branches and conditions
 	// error if they contain error
 	// return none
-	for _, stmt := range node.Condition {
-		condType := Typeof(stmt, ctx)
-		if condType.Type() == types.ERROR {
-			return condType
+	// the error of a branch is reported, if there is a reporter, to check the
+	// branches after it
+	var first *types.ErrorType
+	failed := func(branchType types.TypeNode) bool {
+		err, ok := branchType.(*types.ErrorType)
+		if !ok {
+			return false
+		}
+		if first == nil {
+			first = err
 		}
+		return !ctx.Report(err)
+	}
+
+	if condType := typeofConditions(node.Condition, ctx); failed(condType) {
+		return condType
 	}
-	trueType := Typeof(node.TrueBranch, ctx)
-	if trueType.Type() == types.ERROR {
+	trueType := typeofStatementBody(node.TrueBranch, ctx)
+	if failed(trueType) {
 		return trueType
 	}
 
 	for i, branch := range node.ElifBranches {
-		for _, stmt := range node.ElifConditions[i] {
-			condType := Typeof(stmt, ctx)
-			if condType.Type() == types.ERROR {
-				return condType
-			}
+		if condType := typeofConditions(node.ElifConditions[i], ctx); failed(condType) {
+			return condType
 		}
-		elifType := Typeof(branch, ctx)
-		if elifType.Type() == types.ERROR {
+		elifType := typeofStatementBody(branch, ctx)
+		if failed(elifType) {
 			return elifType
 		}
 	}
 	if node.FalseBranch != nil {
-		falseType := Typeof(node.FalseBranch, ctx)
-		if falseType.Type() == types.ERROR {
+		falseType := typeofStatementBody(node.FalseBranch, ctx)
+		if failed(falseType) {
 			return falseType
 		}
 	}
 
+	if first != nil {
+		return first
+	}
 	return NONE_T
 }
 
@@ -47,6 +59,9 @@ func typeofForStatement(node *ast.ForStatement, ctx *types.Context) types.TypeNo
 	// collection must be arr or dict
 	// eval body statements and error if they error
 	collType := Typeof(node.Collection, ctx)
+	if collType.Type() == types.ERROR {
+		return collType
+	}
 	if collType.Type() != types.ARRAY && collType.Type() != types.DICT {
 		return &types.ErrorType{Msg: "For statements must iterate over a collection",
 			Line: node.Token.Line, Col: node.Token.Col}
@@ -57,21 +72,23 @@ func typeofForStatement(node *ast.ForStatement, ctx *types.Context) types.TypeNo
 			Line: node.Token.Line, Col: node.Token.Col}
 	}
 
+	var varTypes []types.TypeNode
 	if collType.Type() == types.ARRAY {
 		if len(node.LoopVars) == 1 {
-			ctx.Set(node.LoopVars[0].Value, collType.(*types.ArrayType).HeldType)
+			varTypes = []types.TypeNode{collType.(*types.ArrayType).HeldType}
 		} else { // 2
-			ctx.Set(node.LoopVars[0].Value, INT_T)
-			ctx.Set(node.LoopVars[1].Value, collType.(*types.ArrayType).HeldType)
+			varTypes = []types.TypeNode{INT_T, collType.(*types.ArrayType).HeldType}
 		}
 	} else if collType.Type() == types.DICT {
-		ctx.Set(node.LoopVars[0].Value, STRING_T)
-		if len(node.LoopVars) > 1 { // len==2
-			ctx.Set(node.LoopVars[1].Value, collType.(*types.DictType).HeldType)
+		varTypes = []types.TypeNode{STRING_T, collType.(*types.DictType).HeldType}
+	}
+	for idx, loopVar := range node.LoopVars {
+		if vt := assignType(loopVar, varTypes[idx], ctx); vt.Type() == types.ERROR {
+			return vt
 		}
 	}
 
-	if bt := Typeof(node.Body, ctx); bt.Type() == types.ERROR {
+	if bt := typeofStatementBody(node.Body, ctx); bt.Type() == types.ERROR {
 		return bt
 	}
 
@@ -79,18 +96,16 @@ func typeofForStatement(node *ast.ForStatement, ctx *types.Context) types.TypeNo
 }
 
 func typeofWhileStatement(node *ast.WhileStatement, ctx *types.Context) types.TypeNode {
-	for _, stmt := range node.Condition {
-		condType := Typeof(stmt, ctx)
-		if condType.Type() == types.ERROR {
-			return condType
-		}
+	// the error of the condition is reported, if there is a reporter, to check the body
+	condType := typeofConditions(node.Condition, ctx)
+	if err, ok := condType.(*types.ErrorType); ok && !ctx.Report(err) {
+		return err
 	}
-	trueType := Typeof(node.Body, ctx)
-	if trueType.Type() == types.ERROR {
-		return trueType
+	bodyType := typeofStatementBody(node.Body, ctx)
+	if condType.Type() == types.ERROR {
+		return condType
 	}
-
-	return NONE_T
+	return bodyType
 }
 
 func typeofBlockStatement(node *ast.BlockStatement, ctx *types.Context) types.TypeNode {
@@ -100,30 +115,262 @@ func typeofBlockStatement(node *ast.BlockStatement, ctx *types.Context) types.Ty
 		return NONE_T
 	}
 
+	var want types.TypeNode // of what the function returns
+	if ctx.FnType != nil {
+		want = *ctx.FnType
+	}
+
 	retTypes := []types.TypeNode{}
+	var first *types.ErrorType
 	for i, stmt := range node.Statements {
-		stmtType := Typeof(stmt, ctx)
+		_, isReturn := stmt.(*ast.ReturnStatement)
+		var stmtType types.TypeNode
+		if isReturn || i == len(node.Statements)-1 {
+			stmtType = typeofWant(stmt, want, ctx)
+		} else {
+			stmtType = Typeof(stmt, ctx)
+		}
 
-		if stmtType.Type() == types.ERROR {
-			return stmtType
+		if err, ok := stmtType.(*types.ErrorType); ok {
+			if !recoverFrom(stmt, err, ctx) {
+				return err
+			}
+			if first == nil {
+				first = err
+			}
+			continue
 		}
 
-		if _, ok := stmt.(*ast.ReturnStatement); ok || (i == len(node.Statements)-1) {
-			if ctx.FnType != nil && (stmtType.Type() != (*ctx.FnType).Type()) {
+		if isReturn || i == len(node.Statements)-1 {
+			if want != nil && !unifies(stmtType, want) {
 				return &types.ErrorType{Msg: "return type mismatching function type",
 					Line: node.Token.Line, Col: node.Token.Col}
 			}
 			retTypes = append(retTypes, stmtType)
 		}
 	}
-	retTypes = append(retTypes, Typeof(node.Statements[len(node.Statements)-1], ctx))
+	if first != nil {
+		return first
+	}
+	retTypes = append(retTypes, typeofWant(node.Statements[len(node.Statements)-1], want, ctx))
 
+	result := retTypes[0]
 	for _, ret := range retTypes {
-		if ret.String() != retTypes[0].String() {
+		var ok bool
+		if result, ok = types.Unify(result, ret); !ok {
 			return &types.ErrorType{Msg: "block does not have unified return types",
 				Line: node.Token.Line, Col: node.Token.Col}
 		}
 	}
 
-	return retTypes[0]
+	return result
+}
+
+// typeofStatementBody types the body of an if, for, or while statement, whose
+// last statement is discarded rather than returned, so only explicit returns
+// are held to the function's return type
+func typeofStatementBody(node *ast.BlockStatement, ctx *types.Context) types.TypeNode {
+	var first *types.ErrorType
+	for _, stmt := range node.Statements {
+		if err, ok := typeofBodyStatement(stmt, node, ctx).(*types.ErrorType); ok {
+			if !recoverFrom(stmt, err, ctx) {
+				return err
+			}
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	if first != nil {
+		return first
+	}
+	return NONE_T
+}
+
+// typeofConditions types the statements of an if, elif or while condition,
+// checking on past an error as a statement list does when there is a reporter
+func typeofConditions(stmts []ast.Statement, ctx *types.Context) types.TypeNode {
+	var first *types.ErrorType
+	for _, stmt := range stmts {
+		if err, ok := Typeof(stmt, ctx).(*types.ErrorType); ok {
+			if !recoverFrom(stmt, err, ctx) {
+				return err
+			}
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	if first != nil {
+		return first
+	}
+	return NONE_T
+}
+
+// unifies reports whether typ can be held to want, which a never type always can
+func unifies(typ, want types.TypeNode) bool {
+	_, ok := types.Unify(typ, want)
+	return ok
+}
+
+// typeofBodyStatement types a statement of block, whose value is not the
+// function's, holding it to the function's return type only if it returns
+func typeofBodyStatement(stmt ast.Statement, block *ast.BlockStatement, ctx *types.Context) types.TypeNode {
+	if _, ok := stmt.(*ast.ReturnStatement); !ok || ctx.FnType == nil {
+		return Typeof(stmt, ctx)
+	}
+
+	stmtType := typeofWant(stmt, *ctx.FnType, ctx)
+	if stmtType.Type() == types.ERROR {
+		return stmtType
+	}
+	if !unifies(stmtType, *ctx.FnType) {
+		return &types.ErrorType{Msg: "return type mismatching function type",
+			Line: block.Token.Line, Col: block.Token.Col}
+	}
+	return stmtType
+}
+
+// assignType binds name to typ in the scope an assignment to it updates, the
+// nearest one already binding it. Closures share that variable with the scope
+// they were created in, so it may only be rebound to another type in its own
+// scope, and only while no function has captured it.
+func assignType(name *ast.Identifier, typ types.TypeNode, ctx *types.Context) types.TypeNode {
+	owner, ok := ctx.Owner(name.Value)
+	if !ok {
+		ctx.Bind(name.Token, typ)
+		return NONE_T
+	}
+	ctx.Capture(name.Value)
+
+	shared := owner != ctx || owner.Captured(name.Value)
+	if prev, _ := owner.Get(name.Value); shared && prev.Type() != types.ERROR && !types.Equal(prev, typ) {
+		return &types.ErrorType{Msg: fmt.Sprintf("cannot assign %s to %s of type %s",
+			typ.String(), name.Value, prev.String()), Line: name.Token.Line, Col: name.Token.Col}
+	}
+	owner.Bind(name.Token, typ)
+	return NONE_T
+}
+
+func typeofTargetAssignStatement(node *ast.AssignStatement, ctx *types.Context) types.TypeNode {
+	// type the target slot, error if the value does not fit it
+	// op-assigns must produce the slot's type, i.e. p.x += 1 for x: int
+	if rootType, ok := ctx.Get(node.Name.Value); ok && rootType.Type() == types.MODULE {
+		return &types.ErrorType{Msg: fmt.Sprintf("cannot assign to %s, module members are read-only",
+			node.Target.String()), Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	// a missing key is added by =, so the target is typed as the dict's values
+	targetType := Typeof(node.Target, ctx)
+	if targetType.Type() == types.ERROR {
+		return targetType
+	}
+
+	var valType types.TypeNode
+	if node.Type == "=" {
+		valType = typeofWant(node.Value, targetType, ctx)
+	} else {
+		opExp := &ast.InfixExpression{Token: node.Token, Left: node.Target,
+			Operator: string(node.Type[0]), Right: node.Value}
+		valType = typeofInfixExpression(opExp, ctx)
+	}
+	if valType.Type() == types.ERROR {
+		return valType
+	}
+
+	if !types.Equal(valType, targetType) {
+		return &types.ErrorType{Msg: fmt.Sprintf("cannot assign %s to %s of type %s",
+			valType.String(), node.Target.String(), targetType.String()), Line: node.Token.Line, Col: node.Token.Col}
+	}
+
+	return NONE_T
+}
+
+func typeofStructStatement(node *ast.StructStatement, ctx *types.Context) types.TypeNode {
+	// register the struct before resolving fields so it may refer to itself
+	// error if a field is repeated, none, or of an unknown type
+	st := &types.StructType{Name: node.Name.Value, Module: ctx.Module()}
+	ctx.SetTypeDef(st.Name, st)
+
+	seen := map[string]bool{}
+	for idx, field := range node.FieldNames {
+		if seen[field.Value] {
+			return &types.ErrorType{Msg: fmt.Sprintf("duplicate field %s in struct %s", field.Value, st.Name),
+				Line: field.Token.Line, Col: field.Token.Col}
+		}
+		seen[field.Value] = true
+
+		fieldType := resolveType(node.FieldTypes[idx], ctx, field.Token.Line, field.Token.Col)
+		if fieldType.Type() == types.ERROR {
+			return fieldType
+		}
+		if fieldType == NONE_T {
+			return &types.ErrorType{Msg: "field can not be none type", Line: field.Token.Line, Col: field.Token.Col}
+		}
+
+		st.FieldNames = append(st.FieldNames, field.Value)
+		st.FieldTypes = append(st.FieldTypes, fieldType)
+	}
+
+	return NONE_T
+}
+
+func typeofEnumStatement(node *ast.EnumStatement, ctx *types.Context) types.TypeNode {
+	// register the enum before resolving payloads so it may refer to itself
+	// error if a variant is repeated or has a none or unknown payload type
+	// bind the enum's name to a namespace of its variants' constructors
+	et := &types.EnumType{Name: node.Name.Value, Module: ctx.Module()}
+	ctx.SetTypeDef(et.Name, et)
+
+	constructors := types.NewContext()
+	for idx, variant := range node.Variants {
+		if _, ok := et.Payload(variant.Value); ok {
+			return &types.ErrorType{Msg: fmt.Sprintf("duplicate variant %s in enum %s", variant.Value, et.Name),
+				Line: variant.Token.Line, Col: variant.Token.Col}
+		}
+
+		payload := []types.TypeNode{}
+		for _, pt := range node.Payloads[idx] {
+			resolved := resolveType(pt, ctx, variant.Token.Line, variant.Token.Col)
+			if resolved.Type() == types.ERROR {
+				return resolved
+			}
+			if resolved == NONE_T {
+				return &types.ErrorType{Msg: "payload can not be none type", Line: variant.Token.Line, Col: variant.Token.Col}
+			}
+			payload = append(payload, resolved)
+		}
+
+		et.Variants = append(et.Variants, variant.Value)
+		et.Payloads = append(et.Payloads, payload)
+		if len(payload) == 0 {
+			constructors.Set(variant.Value, et)
+		} else {
+			constructors.Set(variant.Value, &types.FunctionType{ParamTypes: payload, ReturnType: et})
+		}
+	}
+
+	return assignType(node.Name, &types.ModuleType{Name: et.Name, Ctx: constructors}, ctx)
+}
+
+func typeofImportStatement(node *ast.ImportStatement, ctx *types.Context) types.TypeNode {
+	// bind the alias to the typechecked context of the module
+	// error if the module can not be found, loaded, or imports itself
+	modCtx, err := ctx.Import(node.Path.Value)
+	if err != nil {
+		return &types.ErrorType{Msg: err.Error(), Line: node.Path.Token.Line, Col: node.Path.Token.Col}
+	}
+
+	return assignType(node.Alias, &types.ModuleType{Name: node.Alias.Value, Ctx: modCtx}, ctx)
+}
+
+func typeofTestStatement(node *ast.TestStatement, ctx *types.Context) types.TypeNode {
+	// the body is checked in its own scope, as each test runs in its own environment
+	bodyType := typeofBlockStatement(node.Body, types.NewEnclosedContext(ctx, nil))
+	if bodyType.Type() == types.ERROR {
+		return bodyType
+	}
+	return NONE_T
 }
@@ -1,9 +1,11 @@
 package typechecker
 
 import (
+	"fmt"
 	"glimmer/lexer"
 	"glimmer/parser"
 	"glimmer/types"
+	"strings"
 	"testing"
 )
 
@@ -57,12 +59,93 @@ func TestTypeofErrors(t *testing.T) {
 		{"push([1,2,3], true)", "Static TypeError at [1,5]: Argument 2 to push must be match Argument 1's held type: int, got=bool"},
 		{"pop(1, 2)", "Static TypeError at [1,4]: Incorrect num of arguments to pop, got=2"},
 		{"pop(1)", "Static TypeError at [1,4]: Argument 1 to pop must be array, got=int"},
+		{"assert(1)", "Static TypeError at [1,7]: Argument to assert must be bool, got=int"},
+		{`assert_eq(1, "a")`, "Static TypeError at [1,10]: Arguments to assert_eq must share a type, got=int and string"},
+		{`test "scoped" { y = 1 }; y`, "Static TypeError at [1,27]: identifier not found: y"},
+		{`test "early" { x = "a" }; x = 1`, "Static TypeError at [1,17]: cannot assign string to x of type int"},
 		{"a = fn() -> int { return 3.3; 1 } ()", "Static TypeError at [1,17]: return type mismatching function type"},
 		{"a = fn() -> int { return 1; 3.3 } ()", "Static TypeError at [1,17]: return type mismatching function type"},
 		{"for i, v, k in [1] {}", "Static TypeError at [1,4]: For statements must have at most 2 loop variables"},
 		{"while 1 > []int {}", "Static TypeError at [1,9]: infix operator for 'int > array[int]' not found"},
 		{"if 1 > []int {}", "Static TypeError at [1,6]: infix operator for 'int > array[int]' not found"},
 		{"ife 1 > []int {}", "Static TypeError at [1,7]: infix operator for 'int > array[int]' not found"},
+		{"inc = fn(x: int) -> int { x + 1 }; 1.5 | inc", "Static TypeError at [1,40]: param type mismatch for param 1 in call"},
+		{"add = fn(x: int, y: int) -> int { x + y }; 1 | add", "Static TypeError at [1,46]: invalid number of arguments in call"},
+		{"1 | 2", "Static TypeError at [1,3]: called object must be function"},
+		{"struct P { x: int, x: int }", "Static TypeError at [1,21]: duplicate field x in struct P"},
+		{"struct P { x: Q }", "Static TypeError at [1,13]: type not found: Q"},
+		{"struct P { x: int }; P{x: 1, y: 2}", "Static TypeError at [1,31]: struct P has no field y"},
+		{"struct P { x: int, y: int }; P{x: 1}", "Static TypeError at [1,31]: missing field y in P literal"},
+		{"struct P { x: int }; P{x: 1.5}", "Static TypeError at [1,25]: field x of P must be int, got=float"},
+		{"Q{x: 1}", "Static TypeError at [1,2]: type not found: Q"},
+		{"x = 1; x.y", "Static TypeError at [1,9]: field access on non-struct type int"},
+		{"struct P { x: int }; p = P{x: 1}; p.y", "Static TypeError at [1,36]: struct P has no field y"},
+		{"struct P { x: int }; p = P{x: 1}; p.x = true", "Static TypeError at [1,39]: cannot assign bool to (p.x) of type int"},
+		{"struct P { x: int }; p = P{x: 1}; p.x += 1.5", "Static TypeError at [1,40]: cannot assign float to (p.x) of type int"},
+		{"fn(p: Q) -> int { 1 }", "Static TypeError at [1,3]: type not found: Q"},
+		{"f = fn[T](x: T, y: T) -> T { x }; f(1, 2.5)", "Static TypeError at [1,36]: param type mismatch for param 2 in call, expected=int, got=float"},
+		{"f = fn[T](xs: array[T], x: T) -> T { x }; f([1], \"a\")", "Static TypeError at [1,44]: param type mismatch for param 2 in call, expected=int, got=string"},
+		{"f = fn[T](xs: array[T]) -> T { head(xs) }; f(1)", "Static TypeError at [1,45]: param type mismatch for param 1 in call, expected=array[T], got=int"},
+		{"mk = fn[T]() -> array[T] { []T }; mk()", "Static TypeError at [1,37]: could not infer type parameter T in call"},
+		{"f = fn[T](x: T) -> T { x + 1 }", "Static TypeError at [1,26]: infix operator for 'T + int' not found"},
+		{"struct P { x: int }; fn[P](x: P) -> P { x }", "Static TypeError at [1,26]: type parameter P shadows an existing type"},
+		{"[1, 2] | push(true)", "Static TypeError at [1,8]: Argument 2 to push must be match Argument 1's held type: int, got=bool"},
+		{`import "lib.gli" as lib`, "Static TypeError at [1,16]: imports are not supported here"},
+		{"try { 1 } catch e { 2.5 }", "Static TypeError at [1,4]: try and catch branches must match types"},
+		{"try { 1 } catch e { e }", "Static TypeError at [1,4]: try and catch branches must match types"},
+		{"try { x } catch e { 1 }", "Static TypeError at [1,8]: identifier not found: x"},
+		{"fn() -> int { try { return 1.5 } catch e { 1 } }", "Static TypeError at [1,19]: return type mismatching function type"},
+		{"throw(1)", "Static TypeError at [1,6]: Argument to throw must be string, got=int"},
+		{`throw("a", "b")`, "Static TypeError at [1,6]: Incorrect num of arguments to throw, got=2"},
+		{`x = 1; f = fn() -> none { x = "one" }`, "Static TypeError at [1,28]: cannot assign string to x of type int"},
+		{`i = "a"; f = fn() -> none { for i in [1, 2] { } }`, "Static TypeError at [1,34]: cannot assign int to i of type string"},
+		{`e = 1; f = fn() -> int { try { 1 } catch e { 2 } }`, "Static TypeError at [1,43]: cannot assign string to e of type int"},
+		{`x = 1; f = fn() -> int { x + 1 }; x = "s"; f()`, "Static TypeError at [1,36]: cannot assign string to x of type int"},
+		{`x = 1; f = fn() -> none { x = 2 }; x = "s"`, "Static TypeError at [1,37]: cannot assign string to x of type int"},
+		{"enum E { A, A }", "Static TypeError at [1,14]: duplicate variant A in enum E"},
+		{"enum E { A(none) }", "Static TypeError at [1,11]: payload can not be none type"},
+		{"enum E { A(Nope) }", "Static TypeError at [1,11]: type not found: Nope"},
+		{"enum E { A, B(int) }; match E.A { A => 1 }", "Static TypeError at [1,28]: non-exhaustive match, missing B"},
+		{"enum E { A, B(int) }; match E.A { A => 1, B(x) => true }", "Static TypeError at [1,28]: match arms must match types"},
+		{"enum E { A, B(int) }; match E.A { A => 1, C => 2 }", "Static TypeError at [1,44]: enum E has no variant C"},
+		{"enum E { A, B(int) }; match E.A { A => 1, A => 2, B(x) => x }", "Static TypeError at [1,44]: duplicate match arm for A"},
+		{"enum E { A, B(int) }; match E.A { A => 1, B(x, y) => x }", "Static TypeError at [1,44]: variant B has 1 fields, got 2 bindings"},
+		{"enum E { A, B(int) }; match E.A { _ => 1, A => 2 }", "Static TypeError at [1,44]: match arm A is unreachable after _"},
+		{"enum E { A, B(int) }; match E.A { _(x) => 1 }", "Static TypeError at [1,36]: _ arm can not bind a payload"},
+		{"enum E { A }; E.Z", "Static TypeError at [1,16]: module E has no member Z"},
+		{"enum E { B(int) }; E.B(true)", "Static TypeError at [1,23]: param type mismatch for param 1 in call"},
+		{`split("a,b")`, "Static TypeError at [1,6]: Incorrect num of arguments to split, got=1"},
+		{`join([1, 2], ",")`, "Static TypeError at [1,5]: Argument 1 to join must be array[string], got=array[int]"},
+		{`substr("abc", 0, 1.5)`, "Static TypeError at [1,7]: Argument 3 to substr must be int, got=float"},
+		{`format(1)`, "Static TypeError at [1,7]: Argument 1 to format must be string, got=int"},
+		{`format("{} and {}", 1)`, "Static TypeError at [1,7]: format string has 2 placeholders, got 1 arguments"},
+		{`d = {"a": 1}; d["b"] = "x"`, "Static TypeError at [1,22]: cannot assign string to (d[b]) of type int"},
+		{`d = {"a": 1}; d[1] = 2`, "Static TypeError at [1,16]: index of dict must be string"},
+		{`a = [1]; a[0] = "x"`, "Static TypeError at [1,15]: cannot assign string to (a[0]) of type int"},
+		{`s = "ab"; s[0] = "b"`, "Static TypeError at [1,12]: indexed type must be array or dict"},
+		{`[1][1.5:]`, "Static TypeError at [1,8]: slice bounds must be int, got=float"},
+		{`1.5 in [1, 2]`, "Static TypeError at [1,7]: left of in must be int for array[int], got=float"},
+		{`true not in [1]`, "Static TypeError at [1,9]: left of not in must be int for array[int], got=bool"},
+		{`1 in {"a": 1}`, "Static TypeError at [1,5]: left of in must be string for dict[int], got=int"},
+		{`1 in "abc"`, "Static TypeError at [1,5]: left of in must be string for string, got=int"},
+		{`1 in 2`, "Static TypeError at [1,5]: right of in must be array, dict or string, got=int"},
+		{`{"a": 1}[:1]`, "Static TypeError at [1,9]: sliced type must be array or string, got=dict[int]"},
+		{`d = {}`, "Static TypeError at [1,5]: can not infer the value type of {}, give it as in {}int"},
+		{`len({})`, "Static TypeError at [1,5]: can not infer the value type of {}, give it as in {}int"},
+		{`keys([1])`, "Static TypeError at [1,5]: Argument 1 to keys must be dict, got=array[int]"},
+		{`has({"a": 1}, 1)`, "Static TypeError at [1,4]: Argument 2 to has must be string, got=int"},
+		{`get({"a": 1}, "a", "b")`, "Static TypeError at [1,4]: Argument 3 to get must be int, got=string"},
+		{`merge({"a": 1}, {"b": 1.5})`, "Static TypeError at [1,6]: Argument 2 to merge must be dict[int], got=dict[float]"},
+		{`items({"a": 1}, fn(v: int) -> int { v })`, "Static TypeError at [1,6]: Argument 2 to items must be a function taking (string, int), got=fn(int) -> int"},
+		{`map([1], fn(x: string) -> int { 1 })`, "Static TypeError at [1,4]: Argument 2 to map must be a function taking (int), got=fn(string) -> int"},
+		{`map(1, fn(x: int) -> int { x })`, "Static TypeError at [1,4]: Argument 1 to map must be array, got=int"},
+		{`filter([1], fn(x: int) -> int { x })`, "Static TypeError at [1,7]: Argument 2 to filter must return bool, got=int"},
+		{`reduce([1], fn(acc: int, x: int) -> float { 1.5 }, 0)`, "Static TypeError at [1,7]: Argument 2 to reduce must return int, got=float"},
+		{`sort([[1]])`, "Static TypeError at [1,5]: Argument 1 to sort must hold int, float or string, got=array[array[int]]"},
+		{`sort_by([1], fn(x: int) -> bool { true })`, "Static TypeError at [1,8]: Argument 2 to sort_by must return int, float or string, got=bool"},
+		{`zip([1], ["a"])`, "Static TypeError at [1,4]: Arguments to zip must hold the same type without a function to combine them, got=array[int] and array[string]"},
+		{`zip([1])`, "Static TypeError at [1,4]: Incorrect num of arguments to zip, got=1"},
+		{`flatten([1])`, "Static TypeError at [1,8]: Argument 1 to flatten must hold arrays, got=array[int]"},
 	}
 
 	for _, tt := range tests {
@@ -98,6 +181,22 @@ func TestTypeofBasicStatements(t *testing.T) {
 		{"for i in [1,2,3,4,5] { break }", "NONE", "none"},
 		{"x = 5", "NONE", "none"},
 		{"return 5;", "INTEGER", "int"},
+		{"", "NONE", "none"},
+		{"# only a comment", "NONE", "none"},
+		{"d = {}int; d", "DICT", "dict[int]"},
+		{"a = [1, 2]; a[0] = 3; a[1] *= 2; a", "ARRAY", "array[int]"},
+		{`m = {"k": [1.5]}; m["k"][0] += 1.0; m`, "DICT", "dict[array[float]]"},
+		{"[1, 2, 3][1:]", "ARRAY", "array[int]"},
+		{"n = 1; [[1], [2]][n:-1:n]", "ARRAY", "array[array[int]]"},
+		{`"glimmer"[::-1]`, "STRING", "string"},
+		{"2 in [1, 2]", "BOOLEAN", "bool"},
+		{`[1] not in [[1], [2]]`, "BOOLEAN", "bool"},
+		{`"a" in {"a": 1.5}`, "BOOLEAN", "bool"},
+		{`"mm" not in "glimmer"`, "BOOLEAN", "bool"},
+		{`d = {"a": 1}; d["b"] = 2`, "NONE", "none"},
+		{`d = {"a": "x"}; d["a"] += "y"; d`, "DICT", "dict[string]"},
+		{`struct P { x: int }; d = {"p": P{x: 1}}; d["p"].x = 2; d["p"]`, "STRUCT", "P"},
+		{`test "later" { assert_eq(inc(1), 2) }; inc = fn(x: int) -> int { x + 1 }; inc(0)`, "INTEGER", "int"},
 	}
 
 	for _, tt := range tests {
@@ -178,6 +277,35 @@ func TestTypeofWhileStatements(t *testing.T) {
 	}
 }
 
+func TestTypeofStatementBodies(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f = fn(x: int) -> int { if x > 0 { print(x) } else { x += 1 } x }; f(1)", "int"},
+		{"f = fn(x: int) -> int { for y in [1.5] { y } x }; f(1)", "int"},
+		{`f = fn(x: int) -> int { while x > 0 { x -= 1; "a" } x }; f(1)`, "int"},
+		{"f = fn(x: int) -> int { while true { if x > 0 { return x } x += 1 } 0 }; f(1)", "int"},
+		{"f = fn(x: int) -> int { if x > 0 { return 1.5 } x }", "Static TypeError at [1,34]: return type mismatching function type"},
+		{`f = fn(x: int) -> int { for y in [1] { return "a" } x }`, "Static TypeError at [1,38]: return type mismatching function type"},
+		{"f = fn(x: int) -> int { while x > 0 { return true * 1.5 } x }", "Static TypeError at [1,37]: return type mismatching function type"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.String() != tt.expected {
+			t.Errorf("type string does not match for %q. want=%s, got=%s", tt.input, tt.expected, pType.String())
+		}
+	}
+}
+
 func TestTypeofFunctionLiteral(t *testing.T) {
 	input := "fn(x: int, y: bool) -> array[int] { [1,2] }"
 	expected := "fn(int, bool) -> array[int]"
@@ -199,6 +327,35 @@ func TestTypeofFunctionLiteral(t *testing.T) {
 	}
 }
 
+func TestTypeofClosures(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{"count = 0; inc = fn() -> int { count += 1; count }; inc()", "int"},
+		{"mk = fn() -> fn() -> int { n = 0; fn() -> int { n = n + 1; n } }; mk()()", "int"},
+		{`f = fn() -> int { y = 1; y }; y = "outer"; y`, "string"},
+		{`x = 1; x = "rebound"; x`, "string"},
+		{`x = 1; f = fn() -> int { x + 1 }; x = 5; f()`, "int"},
+		{`f = fn() -> int { tmp = 3; tmp }; tmp = "s"; f(); tmp`, "string"},
+		{"fact = fn(n: int) -> int { ife n == 0 { 1 } else { n * fact(n - 1) } }; fact(5)", "int"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match for %q. want=%s, got=%s", tt.input, tt.expectedString, pType.String())
+		}
+	}
+}
+
 func TestTypeofArrayLiteral(t *testing.T) {
 	input := "[1, 2, 3, 4, 5]"
 	expected := "array[int]"
@@ -241,6 +398,35 @@ func TestTypeofDictLiteral(t *testing.T) {
 	}
 }
 
+func TestTypeofInferredEmptyDict(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{"{}int", "dict[int]"},
+		{`d = {"a": 1}; d = {}; d`, "dict[int]"},
+		{"n = fn(d: dict[int]) -> int { 0 }; n({})", "int"},
+		{"mk = fn() -> dict[string] { {} }; mk()", "dict[string]"},
+		{"mk = fn(b: bool) -> dict[int] { if b { return {} } {\"a\": 1} }; mk(true)", "dict[int]"},
+		{"struct S { m: dict[int] }; S{m: {}}.m", "dict[int]"},
+		{`dd = {"a": {}int}; dd["b"] = {}; dd["b"]`, "dict[int]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match for %q. want=%s, got=%s", tt.input, tt.expectedString, pType.String())
+		}
+	}
+}
+
 func TestTypeofIfExpression(t *testing.T) {
 	input := `ife true { 1 } else ife true { 1 } else ife true { 1 } else { 1 }`
 	expected := "int"
@@ -262,6 +448,41 @@ func TestTypeofIfExpression(t *testing.T) {
 	}
 }
 
+func TestTypeofTryExpression(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{"try { 1 / 0 } catch e { 0 }", "int"},
+		{`try { throw("bad") } catch e { print(e) }`, "none"},
+		{"try { } catch e { }", "none"},
+		{`try { "ok" } catch e { e }`, "string"},
+		{"f = fn(x: int) -> int { try { return 10 / x } catch e { 0 } }; f(0)", "int"},
+		{"f = fn(x: int) -> int { try { y = 10 / x } catch e { y = 0 }; y }; f(0)", "int"},
+		{`throw("bad")`, "never"},
+		{`try { throw("bad") } catch e { e }`, "string"},
+		{`try { 1 } catch e { throw(e) }`, "int"},
+		{`f = fn(x: int) -> int { ife x > 0 { x } else { throw("neg") } }; f(1)`, "int"},
+		{`f = fn(x: int) -> int { throw("no") }; f`, "fn(int) -> int"},
+		{`f = fn(x: int) -> int { if x < 0 { return throw("neg") } x }; f(1)`, "int"},
+		{`enum E { A, B(int) }; match E.B(1) { A => throw("a"), B(n) => n }`, "int"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match for %q. want=%s, got=%s", tt.input, tt.expectedString, pType.String())
+		}
+	}
+}
+
 func TestTypeofIfStatement(t *testing.T) {
 	input := `if true { 1 } else if true { x = "string" } else if true { fn(x: int) -> int { x + 1 } } else { []int }`
 	expected := "none"
@@ -387,6 +608,10 @@ func TestTypeofInfixExpression(t *testing.T) {
 		{"(1 < 1) >= 3 && 3.2", "BOOLEAN", "bool"},
 		{"(1 < 1.2) != true == false", "BOOLEAN", "bool"},
 		{"(1 < true) || 5 <= 4 > 3", "BOOLEAN", "bool"},
+		{"inc = fn(x: int) -> int { x + 1 }; 1 | inc", "INTEGER", "int"},
+		{"add = fn(x: int, y: int) -> int { x + y }; 1 | add(2) | add(3)", "INTEGER", "int"},
+		{"[1, 2, 3] | push(4)", "ARRAY", "array[int]"},
+		{"[1, 2, 3] | len", "INTEGER", "int"},
 	}
 
 	for _, tt := range tests {
@@ -422,6 +647,37 @@ func TestTypeofBuiltin(t *testing.T) {
 		{"push([1,2,3,4], 5)", "ARRAY", "array[int]"},
 		{"pop([ [1,2], [3,4] ])", "ARRAY", "array[int]"},
 		{"range(5)", "ARRAY", "array[int]"},
+		{`split("a,b", ",")`, "ARRAY", "array[string]"},
+		{`join(["a", "b"], ",")`, "STRING", "string"},
+		{`" a " | trim | upper | lower`, "STRING", "string"},
+		{"[1, 2]" + strings.Repeat(" | reverse", 40), "ARRAY", "array[int]"}, // arguments are typed once, not once per level
+		{`contains("abc", "b") && starts_with("abc", "a") && ends_with("abc", "c")`, "BOOLEAN", "bool"},
+		{`index_of("abc", "c")`, "INTEGER", "int"},
+		{`replace("abc", "b", "B")`, "STRING", "string"},
+		{`substr("abc", 0, 2)`, "STRING", "string"},
+		{`chars("abc")`, "ARRAY", "array[string]"},
+		{`format("{} of {}", 1, [2.5])`, "STRING", "string"},
+		{`fmt = "{}"; format(fmt, 1, 2)`, "STRING", "string"},
+		{`contains = fn(xs: array[int], x: int) -> bool { true }; contains([1], 1)`, "BOOLEAN", "bool"},
+		{`map([1, 2], fn(x: int) -> string { "a" * x })`, "ARRAY", "array[string]"},
+		{`filter([1, 2], fn(x: int) -> bool { x > 1 })`, "ARRAY", "array[int]"},
+		{`reduce(["a"], fn(acc: int, s: string) -> int { acc + len(chars(s)) }, 0)`, "INTEGER", "int"},
+		{`any([1], fn(x: int) -> bool { x > 1 }) || all([1], fn(x: int) -> bool { x > 0 })`, "BOOLEAN", "bool"},
+		{`find([1], fn(x: int) -> bool { x > 1 })`, "INTEGER", "int"},
+		{`sort(["b", "a"])`, "ARRAY", "array[string]"},
+		{`sort_by([[1, 2]], fn(p: array[int]) -> int { len(p) })`, "ARRAY", "array[array[int]]"},
+		{`zip([1], [2])`, "ARRAY", "array[array[int]]"},
+		{`zip([1], ["a"], fn(x: int, s: string) -> string { s * x })`, "ARRAY", "array[string]"},
+		{`enumerate(["a"], fn(i: int, s: string) -> float { 1.5 })`, "ARRAY", "array[float]"},
+		{`flatten([[1], [2, 3]])`, "ARRAY", "array[int]"},
+		{`[1, 2] | reverse`, "ARRAY", "array[int]"},
+		{`keys({"a": 1})`, "ARRAY", "array[string]"},
+		{`values({"a": 1.5})`, "ARRAY", "array[float]"},
+		{`items({"a": 1}, fn(k: string, v: int) -> string { k * v })`, "ARRAY", "array[string]"},
+		{`has({"a": 1}, "a")`, "BOOLEAN", "bool"},
+		{`get({"a": 1}, "b", 0)`, "INTEGER", "int"},
+		{`delete({"a": 1}, "a")`, "DICT", "dict[int]"},
+		{`merge({"a": 1}, {}int)`, "DICT", "dict[int]"},
 	}
 
 	for _, tt := range tests {
@@ -442,3 +698,264 @@ func TestTypeofBuiltin(t *testing.T) {
 		}
 	}
 }
+
+func TestTypeofStructs(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedType   types.GlimmerType
+		expectedString string
+	}{
+		{"struct P { x: int, y: float }", "NONE", "none"},
+		{"struct P { x: int, y: float }; P{y: 1.0, x: 2}", "STRUCT", "P"},
+		{"struct P { x: int, y: float }; P{x: 2, y: 1.0}.y", "FLOAT", "float"},
+		{"struct P { x: int }; struct L { a: P, b: P }; l = L{a: P{x: 1}, b: P{x: 2}}; l.b.x", "INTEGER", "int"},
+		{"struct P { x: int }; p = P{x: 1}; p.x += 2", "NONE", "none"},
+		{"struct P { x: int }; getX = fn(p: P) -> int { p.x }; getX(P{x: 1})", "INTEGER", "int"},
+		{"struct P { x: int }; mk = fn(x: int) -> P { P{x: x} }; mk(1)", "STRUCT", "P"},
+		{"struct Node { val: int, kids: array[Node] }; Node{val: 1, kids: []Node}.kids", "ARRAY", "array[Node]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.Type() != tt.expectedType {
+			t.Errorf("pType is not %s, got=%s (%s)", tt.expectedString, pType.Type(), pType.String())
+		}
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match. want=%s, got=%s", tt.expectedString, pType.String())
+		}
+	}
+}
+
+func TestTypeofEnums(t *testing.T) {
+	shapes := "enum Shape { Circle(float), Rect(float, float), Empty }; "
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{shapes + "Shape.Circle(1.5)", "Shape"},
+		{shapes + "Shape.Empty", "Shape"},
+		{shapes + "Shape.Rect", "fn(float, float) -> Shape"},
+		{shapes + "Shape", "module Shape"},
+		{shapes + "match Shape.Empty { Circle(r) => r, Rect(w, h) => w * h, Empty => 0.0 }", "float"},
+		{shapes + `match Shape.Empty { Circle(_) => "round", _ => "other" }`, "string"},
+		{shapes + "match Shape.Empty { Rect(w, _) => { x = w; x }, _ => 1.0 }", "float"},
+		{shapes + "f = fn(s: Shape) -> float { match s { Rect(w, h) => { return w * h }, _ => 0.0 } }; f(Shape.Empty)", "float"},
+		{"enum Tree { Leaf, Node(Tree, int, Tree) }; Tree.Node(Tree.Leaf, 1, Tree.Leaf)", "Tree"},
+		{"enum Opt { Some(int), None }; struct Box { o: Opt }; Box{o: Opt.Some(1)}.o", "Opt"},
+		{"enum Void { }; match 1 { }", "Static TypeError at [1,21]: match subject must be an enum, got=int"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match for %q. want=%s, got=%s", tt.input, tt.expectedString, pType.String())
+		}
+	}
+}
+
+func TestTypeofGenericFunctions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedType   types.GlimmerType
+		expectedString string
+	}{
+		{"fn[T](x: T) -> T { x }", "FUNCTION", "fn[T](T) -> T"},
+		{"id = fn[T](x: T) -> T { x }; id(1)", "INTEGER", "int"},
+		{`id = fn[T](x: T) -> T { x }; id("a")`, "STRING", "string"},
+		{"id = fn[T](x: T) -> T { x }; id([1, 2])", "ARRAY", "array[int]"},
+		{"first = fn[T](xs: array[T]) -> T { head(xs) }; first([[1.5]])", "ARRAY", "array[float]"},
+		{"app = fn[T, U](x: T, f: fn(T) -> U) -> U { f(x) }; app(2, fn(x: int) -> string { \"s\" * x })", "STRING", "string"},
+		{"wrap = fn[T](x: T) -> array[T] { push([]T, x) }; 3 | wrap", "ARRAY", "array[int]"},
+		{"compose = fn[A, B, C](f: fn(B) -> C, g: fn(A) -> B) -> fn(A) -> C { fn(x: A) -> C { f(g(x)) } }; compose(fn(x: float) -> bool { x > 1.0 }, fn(x: int) -> float { x * 1.5 })", "FUNCTION", "fn(int) -> bool"},
+		{"map = fn[T](xs: array[T], f: fn(T) -> T) -> array[T] { out = []T; for x in xs { out = push(out, f(x)) } out }; map([1], fn(x: int) -> int { x })", "ARRAY", "array[int]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		pType := Typeof(program, ctx)
+
+		if pType.Type() != tt.expectedType {
+			t.Errorf("pType is not %s, got=%s (%s)", tt.expectedString, pType.Type(), pType.String())
+		}
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match. want=%s, got=%s", tt.expectedString, pType.String())
+		}
+	}
+}
+
+// testImporter typechecks modules from sources rather than files
+func testImporter(sources map[string]string) types.Importer {
+	return func(path string) (*types.Context, error) {
+		src, ok := sources[path]
+		if !ok {
+			return nil, fmt.Errorf("module not found: %s", path)
+		}
+		program := parser.New(lexer.New(src)).ParseProgram()
+		ctx := types.NewContext()
+		ctx.SetModule(strings.TrimSuffix(path, ".gli"))
+		if typ := Typeof(program, ctx); typ.Type() == types.ERROR {
+			return nil, fmt.Errorf("in module %s: %s", path, typ.String())
+		}
+		return ctx, nil
+	}
+}
+
+func TestTypeofModules(t *testing.T) {
+	sources := map[string]string{
+		"geo.gli": "struct Point { x: int, y: int }; origin = Point{x: 0, y: 0}; " +
+			"shift = fn(p: Point, d: int) -> Point { Point{x: p.x + d, y: p.y} }",
+		"bad.gli": "x = 1 + true + []int",
+	}
+
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{`import "geo.gli" as geo`, "none"},
+		{`import "geo.gli" as geo; geo`, "module geo"},
+		{`import "geo.gli" as geo; geo.origin`, "geo.Point"},
+		{`import "geo.gli" as geo; [geo.origin, geo.shift(geo.origin, 1)]`, "array[geo.Point]"},
+		{`import "geo.gli" as geo; struct Point { x: int, y: int }; f = fn(p: geo.Point) -> int { p.x }; f(Point{x: 1, y: 2})`,
+			"Static TypeError at [1,97]: param type mismatch for param 1 in call"},
+		{`import "geo.gli" as geo; struct Point { x: int, y: int }; geo.shift(Point{x: 1, y: 2}, 1)`,
+			"Static TypeError at [1,68]: param type mismatch for param 1 in call"},
+		{`import "geo.gli" as geo; struct Point { x: int, y: int }; fn() -> geo.Point { Point{x: 1, y: 2} }`,
+			"Static TypeError at [1,77]: return type mismatching function type"},
+		{`import "geo.gli" as geo; geo.shift(geo.origin, 2).x`, "int"},
+		{`import "geo.gli" as geo; f = fn(p: geo.Point) -> int { p.y }; f(geo.origin)`, "int"},
+		{`import "geo.gli" as geo; geo.nope`, "Static TypeError at [1,29]: module geo has no member nope"},
+		{`import "geo.gli" as geo; geo.origin = geo.origin`, "Static TypeError at [1,37]: cannot assign to (geo.origin), module members are read-only"},
+		{`import "geo.gli" as geo; fn(p: geo.Line) -> int { 1 }`, "Static TypeError at [1,28]: type not found: geo.Line"},
+		{`import "nope.gli" as n`, "Static TypeError at [1,17]: module not found: nope.gli"},
+		{`import "bad.gli" as b`, "Static TypeError at [1,16]: in module bad.gli: Static TypeError at [1,14]: infix operator for 'int + array[int]' not found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+		ctx.SetImporter(testImporter(sources))
+
+		pType := Typeof(program, ctx)
+
+		if pType.String() != tt.expectedString {
+			t.Errorf("type string does not match. want=%s, got=%s", tt.expectedString, pType.String())
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg []string
+	}{
+		{"x = 1 + 2", []string{}},
+		{"x = 1 + \"a\"\ny = x + 1\nz = \"a\" - 1", []string{
+			"Static TypeError at [1,7]: infix operator for 'int + string' not found",
+			"Static TypeError at [3,9]: infix operator for 'string - int' not found",
+		}},
+		{"f = fn(a: int) -> int {\n  b = a + \"s\"\n  c = a * []int\n  a\n}\nf(1) + \"b\"", []string{
+			"Static TypeError at [2,9]: infix operator for 'int + string' not found",
+			"Static TypeError at [3,9]: infix operator for 'int * array[int]' not found",
+			"Static TypeError at [6,6]: infix operator for 'int + string' not found",
+		}},
+		{`if true { 1 + "a" } else { 2 - "b" }`, []string{
+			"Static TypeError at [1,13]: infix operator for 'int + string' not found",
+			"Static TypeError at [1,30]: infix operator for 'int - string' not found",
+		}},
+		{"if 1 + \"a\" { 1 + \"b\"\n  x = 2 - \"c\"\n  x + 1\n} else if undefined { 1 }", []string{
+			"Static TypeError at [1,6]: infix operator for 'int + string' not found",
+			"Static TypeError at [1,16]: infix operator for 'int + string' not found",
+			"Static TypeError at [2,9]: infix operator for 'int - string' not found",
+			"Static TypeError at [4,20]: identifier not found: undefined",
+		}},
+		{"for i in [1] { i + \"a\"; i - \"b\" }\nwhile undefined { 1 + \"c\" }", []string{
+			"Static TypeError at [1,18]: infix operator for 'int + string' not found",
+			"Static TypeError at [1,27]: infix operator for 'int - string' not found",
+			"Static TypeError at [2,16]: identifier not found: undefined",
+			"Static TypeError at [2,21]: infix operator for 'int + string' not found",
+		}},
+		{"[1 + \"a\"]\ny = undefined\ny + 1\nq", []string{
+			"Static TypeError at [1,4]: infix operator for 'int + string' not found",
+			"Static TypeError at [2,14]: identifier not found: undefined",
+			"Static TypeError at [4,2]: identifier not found: q",
+		}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		CheckParserErrors(t, p)
+		ctx := types.NewContext()
+
+		errs := Check(program, ctx)
+
+		if len(errs) != len(tt.expectedMsg) {
+			t.Errorf("wrong number of errors for %q. want=%d, got=%d: %v", tt.input, len(tt.expectedMsg), len(errs), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.String() != tt.expectedMsg[i] {
+				t.Errorf("error %d does not match. want=%s, got=%s", i, tt.expectedMsg[i], err.String())
+			}
+		}
+		for name, typ := range ctx.Members() {
+			if typ.Type() == types.ERROR {
+				t.Errorf("%s is left defined as an error", name)
+			}
+		}
+	}
+}
+
+func FuzzTypeof(f *testing.F) {
+	seeds := []string{
+		"x = 1 + 2.5 * -3",
+		"add = fn(a: int, b: int) -> int { return a + b }; add(1, 2)",
+		"for i in range(10) { if i == 2 { continue } else { break } }",
+		"struct P { x: int }; p = P{x: 1}; p.x += 1",
+		"enum Color { Red, Green }; match Color.Red { Color.Red => 1, _ => 2 }",
+		`try throw("no") catch e { e }`,
+		`test "adds" { assert_eq(1 + 1, 2) }`,
+		"first = fn<T>(xs: array[T]) -> T { xs[0] }; first([1.5])",
+		`{"a": [1]}["a"] | push(2) | pop()`,
+		"x = 1; x = true",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+		if pType := Typeof(program, types.NewContext()); pType == nil {
+			t.Fatalf("no type for %q", input)
+		}
+	})
+}
@@ -3,6 +3,9 @@ package types
 import (
 	"bytes"
 	"fmt"
+	"glimmer/diagnostics"
+	"glimmer/token"
+	"strings"
 )
 
 type GlimmerType string
@@ -15,7 +18,13 @@ const (
 	ARRAY    = "ARRAY"
 	DICT     = "DICT"
 	FUNCTION = "FUNCTION"
+	STRUCT   = "STRUCT"
+	ENUM     = "ENUM"
+	NAMED    = "NAMED"
+	TYPEVAR  = "TYPEVAR"
+	MODULE   = "MODULE"
 	NONE     = "NONE"
+	NEVER    = "NEVER"
 	ERROR    = "ERROR"
 )
 
@@ -83,6 +92,7 @@ func (dt *DictType) String() string {
 }
 
 type FunctionType struct {
+	TypeParams []*TypeVar // non-empty for generic functions, i.e. fn[T](x: T) -> T
 	ParamTypes []TypeNode
 	ReturnType TypeNode
 	FnCtx      *Context
@@ -92,12 +102,21 @@ func (ft *FunctionType) Type() GlimmerType {
 	return FUNCTION
 }
 func (ft *FunctionType) String() string {
+	typeParams := ""
+	if len(ft.TypeParams) > 0 {
+		names := []string{}
+		for _, tp := range ft.TypeParams {
+			names = append(names, tp.Name)
+		}
+		typeParams = "[" + strings.Join(names, ", ") + "]"
+	}
+
 	if len(ft.ParamTypes) == 0 {
-		return "fn() -> " + ft.ReturnType.String()
+		return "fn" + typeParams + "() -> " + ft.ReturnType.String()
 	}
 
 	var out bytes.Buffer
-	out.WriteString("fn(")
+	out.WriteString("fn" + typeParams + "(")
 
 	out.WriteString(ft.ParamTypes[0].String())
 	for _, typ := range ft.ParamTypes[1:len(ft.ParamTypes)] {
@@ -109,6 +128,134 @@ func (ft *FunctionType) String() string {
 	return out.String()
 }
 
+type StructType struct {
+	Name       string
+	Module     string // the name of the module defining it, empty for the program's own
+	FieldNames []string
+	FieldTypes []TypeNode
+}
+
+func (st *StructType) Type() GlimmerType {
+	return STRUCT
+}
+func (st *StructType) String() string {
+	return qualify(st.Module, st.Name)
+}
+
+// FieldType returns the type of the named field, if the struct has it
+func (st *StructType) FieldType(name string) (TypeNode, bool) {
+	for idx, fieldName := range st.FieldNames {
+		if fieldName == name {
+			return st.FieldTypes[idx], true
+		}
+	}
+	return nil, false
+}
+
+// EnumType is a tagged union: each of its values is one of the variants,
+// carrying that variant's payload
+type EnumType struct {
+	Name     string
+	Module   string // the name of the module defining it, empty for the program's own
+	Variants []string
+	Payloads [][]TypeNode
+}
+
+func (et *EnumType) Type() GlimmerType {
+	return ENUM
+}
+func (et *EnumType) String() string {
+	return qualify(et.Module, et.Name)
+}
+
+// qualify names a type defined in module as it is written where imported,
+// i.e. geo.Point
+func qualify(module, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "." + name
+}
+
+// Equal reports whether a and b are the same type. A struct or enum is only
+// the same as itself, not another definition of the same name.
+func Equal(a, b TypeNode) bool {
+	switch a := a.(type) {
+	case *StructType, *EnumType:
+		return TypeNode(a) == b
+	case *ArrayType:
+		b, ok := b.(*ArrayType)
+		return ok && Equal(a.HeldType, b.HeldType)
+	case *DictType:
+		b, ok := b.(*DictType)
+		return ok && Equal(a.HeldType, b.HeldType)
+	case *FunctionType:
+		b, ok := b.(*FunctionType)
+		if !ok || len(a.TypeParams) > 0 || len(b.TypeParams) > 0 {
+			return ok && a.String() == b.String()
+		}
+		if len(a.ParamTypes) != len(b.ParamTypes) {
+			return false
+		}
+		for idx, pt := range a.ParamTypes {
+			if !Equal(pt, b.ParamTypes[idx]) {
+				return false
+			}
+		}
+		return Equal(a.ReturnType, b.ReturnType)
+	default:
+		return a.String() == b.String()
+	}
+}
+
+// Unify returns the type of a value that is either of a or b, which is that of
+// the two that is not never when they do not match
+func Unify(a, b TypeNode) (TypeNode, bool) {
+	if a.Type() == NEVER {
+		return b, true
+	}
+	if b.Type() == NEVER {
+		return a, true
+	}
+	return a, Equal(a, b)
+}
+
+// Payload returns the payload types of the named variant, if the enum has it
+func (et *EnumType) Payload(variant string) ([]TypeNode, bool) {
+	for idx, name := range et.Variants {
+		if name == variant {
+			return et.Payloads[idx], true
+		}
+	}
+	return nil, false
+}
+
+// NamedType is a reference to a user-defined type by name, as written in a
+// type annotation. The typechecker resolves it against the Context.
+type NamedType struct {
+	Name string
+}
+
+func (nt *NamedType) Type() GlimmerType {
+	return NAMED
+}
+func (nt *NamedType) String() string {
+	return nt.Name
+}
+
+// TypeVar is a type parameter of a generic function, bound per call by the
+// typechecker from the types of the arguments
+type TypeVar struct {
+	Name string
+}
+
+func (tv *TypeVar) Type() GlimmerType {
+	return TYPEVAR
+}
+func (tv *TypeVar) String() string {
+	return tv.Name
+}
+
 type NoneType struct{}
 
 func (nt *NoneType) Type() GlimmerType {
@@ -118,6 +265,17 @@ func (nt *NoneType) String() string {
 	return "none"
 }
 
+// NeverType is the type of an expression that never results in a value, as a
+// call to throw, so a branch of it unifies with a branch of any other type
+type NeverType struct{}
+
+func (nt *NeverType) Type() GlimmerType {
+	return NEVER
+}
+func (nt *NeverType) String() string {
+	return "never"
+}
+
 type ErrorType struct {
 	Msg  string
 	Line int
@@ -131,6 +289,31 @@ func (et *ErrorType) String() string {
 	return fmt.Sprintf("Static TypeError at [%d,%d]: %s", et.Line, et.Col, et.Msg)
 }
 
+// Diagnostic returns the error as a diagnostic spanning the token of src it
+// is positioned at
+func (et *ErrorType) Diagnostic(src string) diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: "type-error",
+		Span: diagnostics.Locate(src, et.Line, et.Col), Message: et.Msg}
+}
+
+// ModuleType is the type of a namespace: an imported module's alias, whose
+// members are the top-level names of the module's Context, or an enum's name,
+// whose members are the constructors of its variants
+type ModuleType struct {
+	Name string
+	Ctx  *Context
+}
+
+func (mt *ModuleType) Type() GlimmerType {
+	return MODULE
+}
+func (mt *ModuleType) String() string {
+	return "module " + mt.Name
+}
+
+// Importer returns the typechecked Context of the module at path
+type Importer func(path string) (*Context, error)
+
 func NewEnclosedContext(outer *Context, retType *TypeNode) *Context {
 	ctx := NewContext()
 	ctx.outer = outer
@@ -138,15 +321,32 @@ func NewEnclosedContext(outer *Context, retType *TypeNode) *Context {
 	return ctx
 }
 
+// Recorder is told the type of every identifier the typechecker binds or
+// resolves, along with the identifier that bound it (itself, for a binding)
+type Recorder func(ident token.Token, typ TypeNode, def token.Token)
+
+// Reporter is told each error the typechecker recovers from to check the
+// statements after it
+type Reporter func(err *ErrorType)
+
 func NewContext() *Context {
 	s := make(map[string]TypeNode)
-	return &Context{store: s, outer: nil}
+	d := make(map[string]TypeNode)
+	defs := make(map[string]token.Token)
+	return &Context{store: s, typeDefs: d, defs: defs, captured: map[string]bool{}, outer: nil}
 }
 
 type Context struct {
-	store  map[string]TypeNode
-	outer  *Context
-	FnType *TypeNode
+	store    map[string]TypeNode
+	typeDefs map[string]TypeNode
+	defs     map[string]token.Token // where each name in store was first bound
+	captured map[string]bool        // the names in store a function uses from outside itself
+	outer    *Context
+	FnType   *TypeNode
+	importer Importer
+	module   string
+	recorder Recorder
+	reporter Reporter
 }
 
 func (c *Context) Get(name string) (TypeNode, bool) {
@@ -162,15 +362,170 @@ func (c *Context) Set(name string, val TypeNode) TypeNode {
 	return val
 }
 
-func (c *Context) DeepCopy() *Context {
-	newEnv := &Context{}
-	if c.outer != nil {
-		newEnv.outer = c.outer.DeepCopy()
+// Bind sets the identifier name to typ, remembering name as the binding's
+// definition if it is the first
+func (c *Context) Bind(name token.Token, typ TypeNode) TypeNode {
+	c.store[name.Literal] = typ
+	if _, ok := c.defs[name.Literal]; !ok {
+		c.defs[name.Literal] = name
+	}
+	c.Record(name, typ, c.defs[name.Literal])
+	return typ
+}
+
+// Def returns the identifier that bound name, if it was bound with Bind
+func (c *Context) Def(name string) (token.Token, bool) {
+	owner, ok := c.Owner(name)
+	if !ok {
+		return token.Token{}, false
+	}
+	def, ok := owner.defs[name]
+	return def, ok
+}
+
+// Owner returns the nearest Context, this one or an enclosing one, that
+// binds name, i.e. the scope an assignment to name updates
+func (c *Context) Owner(name string) (*Context, bool) {
+	for scope := c; scope != nil; scope = scope.outer {
+		if _, ok := scope.store[name]; ok {
+			return scope, true
+		}
+	}
+	return nil, false
+}
+
+// Capture marks name as captured by a function if it is bound outside the
+// function this Context is in, as the function shares that variable
+func (c *Context) Capture(name string) {
+	inFn := false
+	for scope := c; scope != nil; scope = scope.outer {
+		if _, ok := scope.store[name]; ok {
+			if inFn {
+				scope.captured[name] = true
+			}
+			return
+		}
+		inFn = inFn || scope.FnType != nil
+	}
+}
+
+// Captured reports whether a function captured name from this Context
+func (c *Context) Captured(name string) bool {
+	return c.captured[name]
+}
+
+// GetTypeDef looks up a user-defined type (i.e. a struct) by name
+func (c *Context) GetTypeDef(name string) (TypeNode, bool) {
+	typ, ok := c.typeDefs[name]
+	if !ok && c.outer != nil {
+		typ, ok = c.outer.GetTypeDef(name)
+	}
+	return typ, ok
+}
+
+func (c *Context) SetTypeDef(name string, typ TypeNode) TypeNode {
+	c.typeDefs[name] = typ
+	return typ
+}
+
+// Members returns the names defined directly in this Context
+func (c *Context) Members() map[string]TypeNode {
+	return c.store
+}
+
+// Copy returns a Context binding what this one does, whose bindings change
+// apart from this one's, i.e. to typecheck a program that may never run
+func (c *Context) Copy() *Context {
+	cp := *c
+	cp.store = make(map[string]TypeNode, len(c.store))
+	cp.typeDefs = make(map[string]TypeNode, len(c.typeDefs))
+	cp.defs = make(map[string]token.Token, len(c.defs))
+	cp.captured = make(map[string]bool, len(c.captured))
+	cp.Merge(c)
+	return &cp
+}
+
+// Merge binds everything other binds in this Context, i.e. the bindings of a
+// Copy of it once its program has run
+func (c *Context) Merge(other *Context) {
+	for name, typ := range other.store {
+		c.store[name] = typ
+	}
+	for name, typ := range other.typeDefs {
+		c.typeDefs[name] = typ
+	}
+	for name, def := range other.defs {
+		c.defs[name] = def
+	}
+	for name, captured := range other.captured {
+		c.captured[name] = captured
 	}
-	newStore := make(map[string]TypeNode)
-	for key, val := range c.store {
-		newStore[key] = val
+}
+
+func (c *Context) SetImporter(importer Importer) {
+	c.importer = importer
+}
+
+// SetModule names the module this Context is the top level of, to qualify
+// the types it defines
+func (c *Context) SetModule(name string) {
+	c.module = name
+}
+
+// Module returns the name of the module the Context is in, empty for the
+// program's own
+func (c *Context) Module() string {
+	if c.module == "" && c.outer != nil {
+		return c.outer.Module()
+	}
+	return c.module
+}
+
+func (c *Context) SetRecorder(recorder Recorder) {
+	c.recorder = recorder
+}
+
+// Record reports an identifier to the recorder of the outermost Context, if any
+func (c *Context) Record(ident token.Token, typ TypeNode, def token.Token) {
+	if c.recorder == nil {
+		if c.outer != nil {
+			c.outer.Record(ident, typ, def)
+		}
+		return
+	}
+	c.recorder(ident, typ, def)
+}
+
+func (c *Context) SetReporter(reporter Reporter) {
+	c.reporter = reporter
+}
+
+// Report reports err to the reporter of the outermost Context, returning
+// false if there is none to recover from it
+func (c *Context) Report(err *ErrorType) bool {
+	if c.reporter == nil {
+		if c.outer != nil {
+			return c.outer.Report(err)
+		}
+		return false
+	}
+	c.reporter(err)
+	return true
+}
+
+// Unset removes the binding of name from this Context
+func (c *Context) Unset(name string) {
+	delete(c.store, name)
+	delete(c.defs, name)
+}
+
+// Import loads the module at path with the importer of the outermost Context
+func (c *Context) Import(path string) (*Context, error) {
+	if c.importer == nil {
+		if c.outer != nil {
+			return c.outer.Import(path)
+		}
+		return nil, fmt.Errorf("imports are not supported here")
 	}
-	newEnv.store = newStore
-	return newEnv
+	return c.importer(path)
 }
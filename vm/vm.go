@@ -0,0 +1,722 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"glimmer/code"
+	"glimmer/compiler"
+	"glimmer/evaluator"
+	"glimmer/object"
+)
+
+const StackSize = 1 << 16
+const GlobalsSize = 1 << 16
+const MaxFrames = 1 << 12
+
+// the vm shares the evaluator's singletons so results compare by identity
+var NULL = evaluator.NULL
+var TRUE = evaluator.TRUE
+var FALSE = evaluator.FALSE
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // always points to the next free slot, top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	result object.Object // value of an explicit top-level return
+
+	handlers []tryHandler // open try blocks, innermost last
+
+	openUpvalues []openUpvalue // captured variables still on the stack
+}
+
+// openUpvalue is an Upvalue pointing at a stack slot of a live call
+type openUpvalue struct {
+	slot    int
+	upvalue *object.Upvalue
+}
+
+// tryHandler is where to resume when an error is raised inside a try block
+type tryHandler struct {
+	framesIndex int
+	sp          int
+	catchPos    int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		globals:     make([]object.Object, GlobalsSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore runs bytecode against the globals of a previous run,
+// i.e. the lines of a REPL session
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// Result is the value of the program's last statement, like evaluator.Eval
+func (vm *VM) Result() object.Object {
+	if vm.result != nil {
+		return vm.result
+	}
+	if vm.sp == 0 {
+		return NULL
+	}
+	return vm.stack[vm.sp-1]
+}
+
+func (vm *VM) Run() error {
+	for {
+		err := vm.run(0)
+		if err == nil || !vm.catch(err) {
+			return err
+		}
+	}
+}
+
+// catch unwinds to the innermost try block, which then runs its catch block
+// with the error's message
+func (vm *VM) catch(err error) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	handler := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.closeUpvalues(handler.sp)
+	vm.framesIndex = handler.framesIndex
+	vm.sp = handler.sp
+	vm.currentFrame().ip = handler.catchPos - 1
+
+	return vm.push(&object.String{Value: err.Error()}) == nil
+}
+
+// run executes instructions until the program ends or, for a call from a
+// builtin, a return leaves returnTo frames
+func (vm *VM) run(returnTo int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpNull:
+			if err := vm.push(NULL); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(TRUE); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(FALSE); err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual, code.OpAnd, code.OpOr, code.OpIn:
+			right := vm.pop()
+			left := vm.pop()
+			if result, ok := integerInfix(op, left, right); ok {
+				if err := vm.push(result); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := vm.pushResult(evaluator.ApplyInfixOperator(infixOperators[op], left, right)); err != nil {
+				return err
+			}
+
+		case code.OpMinus, code.OpBang:
+			operator := "-"
+			if op == code.OpBang {
+				operator = "!"
+			}
+			if err := vm.pushResult(evaluator.ApplyPrefixOperator(operator, vm.pop())); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			if err := vm.push(*vm.currentFrame().cl.Free[freeIndex].Location); err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			*vm.currentFrame().cl.Free[freeIndex].Location = vm.pop()
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpDict:
+			numPairs := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			dict, err := vm.buildDict(vm.sp-2*numPairs, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - 2*numPairs
+
+			if err := vm.push(dict); err != nil {
+				return err
+			}
+
+		case code.OpStruct:
+			layoutIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			layout := vm.constants[layoutIndex].(*object.Struct)
+			numFields := len(layout.FieldNames)
+			st := &object.Struct{Name: layout.Name, FieldNames: layout.FieldNames, Fields: make(map[string]object.Object)}
+			for i, field := range layout.FieldNames {
+				st.Fields[field] = vm.stack[vm.sp-numFields+i]
+			}
+			vm.sp = vm.sp - numFields
+
+			if err := vm.push(st); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			if err := vm.pushResult(evaluator.ApplyIndex(left, index)); err != nil {
+				return err
+			}
+
+		case code.OpSlice:
+			step := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
+			if err := vm.pushResult(evaluator.ApplySlice(vm.pop(), start, end, step)); err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+			if err := vm.pushResult(evaluator.ApplySetIndex(container, index, val)); err != nil {
+				return err
+			}
+
+		case code.OpGetField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			field := vm.constants[nameIndex].(*object.String).Value
+			if err := vm.pushResult(evaluator.ApplyFieldAccess(vm.pop(), field)); err != nil {
+				return err
+			}
+
+		case code.OpSetField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			field := vm.constants[nameIndex].(*object.String).Value
+			val := vm.pop()
+			container := vm.pop()
+			st, ok := container.(*object.Struct)
+			if !ok {
+				return fmt.Errorf("field assignment not supported: %s.%s", container.Type(), field)
+			}
+			if _, ok := st.Fields[field]; !ok {
+				return fmt.Errorf("struct %s has no field %s", st.Name, field)
+			}
+			updated := st.Copy()
+			updated.Fields[field] = val
+			if err := vm.push(updated); err != nil {
+				return err
+			}
+
+		case code.OpIter:
+			iter, err := newIterator(vm.pop())
+			if err != nil {
+				return err
+			}
+			if err := vm.push(iter); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			exitPos := int(code.ReadUint16(ins[ip+1:]))
+			numVars := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			iter := vm.pop().(*iterator)
+			if !iter.hasNext() {
+				vm.currentFrame().ip = exitPos - 1
+				continue
+			}
+			for _, val := range iter.next(numVars) {
+				if err := vm.push(val); err != nil {
+					return err
+				}
+			}
+
+		case code.OpMatch:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			nameIndex := code.ReadUint16(ins[ip+3:])
+			vm.currentFrame().ip += 4
+
+			ev, ok := vm.stack[vm.sp-1].(*object.EnumValue)
+			if !ok {
+				return fmt.Errorf("match subject must be an enum, got=%s", vm.stack[vm.sp-1].Type())
+			}
+			if ev.Variant != vm.constants[nameIndex].(*object.String).Value {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+
+			vm.pop()
+			for _, val := range ev.Payload {
+				if err := vm.push(val); err != nil {
+					return err
+				}
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			cl := vm.stack[vm.sp-1].(*object.Closure)
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			cl.Free = append(cl.Free, vm.captureUpvalue(slot))
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			cl := vm.stack[vm.sp-1].(*object.Closure)
+			cl.Free = append(cl.Free, vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 { // top-level return ends the program
+				vm.result = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.closeUpvalues(frame.basePointer)
+			vm.sp = frame.basePointer - 1
+
+			// try blocks of the returning call are left with it
+			for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+				vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			}
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+			if vm.framesIndex == returnTo {
+				return nil
+			}
+
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, tryHandler{framesIndex: vm.framesIndex, sp: vm.sp, catchPos: catchPos})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		default:
+			return fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+
+	return nil
+}
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpAnd:          "&&",
+	code.OpOr:           "||",
+	code.OpIn:           "in",
+}
+
+// integerInfix is a fast path for the common integer operators, anything
+// else (including division, for its error) is left to the evaluator
+func integerInfix(op code.Opcode, left, right object.Object) (object.Object, bool) {
+	leftInt, ok := left.(*object.Integer)
+	if !ok {
+		return nil, false
+	}
+	rightInt, ok := right.(*object.Integer)
+	if !ok {
+		return nil, false
+	}
+	leftVal, rightVal := leftInt.Value, rightInt.Value
+
+	switch op {
+	case code.OpAdd:
+		return &object.Integer{Value: leftVal + rightVal}, true
+	case code.OpSub:
+		return &object.Integer{Value: leftVal - rightVal}, true
+	case code.OpMul:
+		return &object.Integer{Value: leftVal * rightVal}, true
+	case code.OpEqual:
+		return evaluator.BoolToBoolObj(leftVal == rightVal), true
+	case code.OpNotEqual:
+		return evaluator.BoolToBoolObj(leftVal != rightVal), true
+	case code.OpLessThan:
+		return evaluator.BoolToBoolObj(leftVal < rightVal), true
+	case code.OpGreaterThan:
+		return evaluator.BoolToBoolObj(leftVal > rightVal), true
+	case code.OpLessEqual:
+		return evaluator.BoolToBoolObj(leftVal <= rightVal), true
+	case code.OpGreaterEqual:
+		return evaluator.BoolToBoolObj(leftVal >= rightVal), true
+	default:
+		return nil, false
+	}
+}
+
+func (vm *VM) buildDict(startIndex, endIndex int) (object.Object, error) {
+	pairs := make(map[string]object.Object)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key, ok := vm.stack[i].(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("key is not of type string. got=%s", vm.stack[i].Type())
+		}
+		pairs[key.Value] = vm.stack[i+1]
+	}
+
+	return &object.Dict{Pairs: pairs}, nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+
+	// the captures that follow fill in the free variables
+	return vm.push(&object.Closure{Fn: function, Free: make([]*object.Upvalue, 0, numFree)})
+}
+
+// captureUpvalue shares the variable in slot with every closure capturing it
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	for _, open := range vm.openUpvalues {
+		if open.slot == slot {
+			return open.upvalue
+		}
+	}
+
+	upvalue := &object.Upvalue{Location: &vm.stack[slot]}
+	vm.openUpvalues = append(vm.openUpvalues, openUpvalue{slot: slot, upvalue: upvalue})
+	return upvalue
+}
+
+// closeUpvalues moves the variables at or above slot off the stack before
+// their call's slots are reused
+func (vm *VM) closeUpvalues(slot int) {
+	open := vm.openUpvalues[:0]
+	for _, uv := range vm.openUpvalues {
+		if uv.slot >= slot {
+			uv.upvalue.Close()
+		} else {
+			open = append(open, uv)
+		}
+	}
+	vm.openUpvalues = open
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin, *object.Function: // a function of an imported module is tree-walked
+		return vm.callObject(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments. got=%d, want=%d", numArgs, cl.Fn.NumParameters)
+	}
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	vm.pushFrame(frame)
+
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callObject(fn object.Object, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	var result object.Object
+	if builtin, ok := fn.(*object.Builtin); ok && builtin.HigherOrder != nil {
+		result = builtin.HigherOrder(vm.callback, args...)
+	} else {
+		result = evaluator.ApplyFunction(fn, args)
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.pushResult(result)
+}
+
+// callback calls a function passed to a higher-order builtin, running a
+// closure on the vm until it returns
+func (vm *VM) callback(fn object.Object, args ...object.Object) object.Object {
+	cl, ok := fn.(*object.Closure)
+	if !ok {
+		return evaluator.ApplyFunction(fn, args)
+	}
+
+	result, err := vm.runClosure(cl, args)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return result
+}
+
+func (vm *VM) runClosure(cl *object.Closure, args []object.Object) (object.Object, error) {
+	returnTo := vm.framesIndex
+	if err := vm.push(cl); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err
+		}
+	}
+	if err := vm.callClosure(cl, len(args)); err != nil {
+		return nil, err
+	}
+
+	for {
+		err := vm.run(returnTo)
+		if err == nil {
+			return vm.pop(), nil
+		}
+		// only the try blocks opened by the call may catch its errors
+		handlers := len(vm.handlers)
+		if handlers == 0 || vm.handlers[handlers-1].framesIndex <= returnTo || !vm.catch(err) {
+			return nil, err
+		}
+	}
+}
+
+// pushResult pushes the result of an operation delegated to the evaluator,
+// turning an error object into a runtime error
+func (vm *VM) pushResult(obj object.Object) error {
+	if errObj, ok := obj.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+	if obj == nil {
+		obj = NULL
+	}
+	return vm.push(obj)
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// iterator walks an array's elements or a dict's keys (in sorted order) for
+// a compiled for loop. It is only ever held in a hidden local.
+type iterator struct {
+	array *object.Array
+	dict  *object.Dict
+	keys  []string
+	pos   int
+}
+
+func newIterator(collection object.Object) (*iterator, error) {
+	switch collection := collection.(type) {
+	case *object.Array:
+		return &iterator{array: collection}, nil
+	case *object.Dict:
+		return &iterator{dict: collection, keys: collection.Keys()}, nil
+	default:
+		return nil, fmt.Errorf("For statement must iterate over collection. got=%s", collection.Type())
+	}
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func (it *iterator) hasNext() bool {
+	if it.array != nil {
+		return it.pos < len(it.array.Elements)
+	}
+	return it.pos < len(it.keys)
+}
+
+// next returns the loop variables of the next iteration in declaration order:
+// elem or index, elem for arrays and key or key, value for dicts
+func (it *iterator) next(numVars int) []object.Object {
+	defer func() { it.pos++ }()
+
+	if it.array != nil {
+		elem := it.array.Elements[it.pos]
+		if numVars > 1 {
+			return []object.Object{&object.Integer{Value: int64(it.pos)}, elem}
+		}
+		return []object.Object{elem}
+	}
+
+	key := it.keys[it.pos]
+	if numVars > 1 {
+		return []object.Object{&object.String{Value: key}, it.dict.Pairs[key]}
+	}
+	return []object.Object{&object.String{Value: key}}
+}
@@ -0,0 +1,214 @@
+package vm
+
+import (
+	"glimmer/compiler"
+	"glimmer/evaluator"
+	"glimmer/lexer"
+	"glimmer/object"
+	"glimmer/parser"
+	"glimmer/typechecker"
+	"glimmer/types"
+	"testing"
+)
+
+func testRun(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	if typ := typechecker.Typeof(program, types.NewContext()); typ.Type() == types.ERROR {
+		t.Fatalf("type error for %q: %s", input, typ.String())
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.Result()
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	typechecker.Typeof(program, types.NewContext())
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+func TestVMResults(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3 - 4 / 2", "7"},
+		{"1 + 2.5", "3.5"},
+		{"-5 + 10", "5"},
+		{"!true", "false"},
+		{"1 < 2 && 2 > 3", "false"},
+		{`"a" * 3`, "aaa"},
+		{"x = 5; x += 2; x", "7"},
+		{"x = 5", "5"},
+		{"ife 1 > 2 { 10 } else { 20 }", "20"},
+		{"ife false { 10 } else { 20 }", "20"},
+		{"ife false { 1 } else ife true { 2 } else { 3 }", "2"},
+		{"if true { 10 }", "null"},
+		{"[1, 2, 3][1]", "2"},
+		{`{"a": 1}["a"]`, "1"},
+		{"len([1, 2, 3])", "3"},
+		{"push([1], 2)", "[1, 2]"},
+		{"add = fn(a: int, b: int) -> int { a + b }; add(1, 2)", "3"},
+		{"f = fn() -> int { return 1; 2 }; f()", "1"},
+		{"return 4; 5", "4"},
+		{"fib = fn(n: int) -> int { ife n < 2 { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", "610"},
+		{"adder = fn(x: int) -> fn(int) -> int { fn(y: int) -> int { x + y } }; adder(2)(3)", "5"},
+		{"x = 1; f = fn() -> int { x }; x = 2; f()", "2"},
+		{"3 | fn(a: int, b: int) -> int { a - b }(1)", "2"},
+		{"id = fn[T](x: T) -> T { x }; id(4)", "4"},
+		{"struct P { x: int, y: int }; p = P{x: 1, y: 2}; p.y", "2"},
+		{"struct P { x: int }; p = P{x: 1}; q = p; p.x = 5; q.x + p.x", "6"},
+		{"struct I { v: int }; struct O { i: I }; o = O{i: I{v: 1}}; o.i.v += 4; o", "O{i: I{v: 5}}"},
+		{"s = 0; for x in [1, 2, 3] { s += x } s", "6"},
+		{"s = 0; for i, x in [5, 6, 7] { s += i * x } s", "20"},
+		{`s = 0; for k, v in {"a": 1, "b": 2} { s += v } s`, "3"},
+		{"s = 0; for x in [1, 2, 3, 4] { if x == 3 { break } s += x } s", "3"},
+		{"s = 0; for x in [1, 2, 3, 4] { if x == 2 { continue } s += x } s", "8"},
+		{"i = 0; s = 0; while i < 10 { i += 1; if i == 5 { continue } if i == 8 { break } s += i } s", "23"},
+		{"f = fn() -> int { for x in [1, 2, 3] { if x == 2 { return x } } 0 }; f()", "2"},
+		{"f = fn(n: int) -> int { s = 0; i = 0; while i < n { i += 1; s += i } return s; }; f(4)", "10"},
+		{"try { 1 / 0 } catch e { 5 }", "5"},
+		{`try { ["a"][3] } catch e { e }`, "Index 3 out of range for array of length 1"},
+		{`try { throw("bad"); "ok" } catch e { e + "!" }`, "bad!"},
+		{"f = fn(x: int) -> int { 10 / x }; g = fn(x: int) -> int { f(x) + 1 }; try { g(0) } catch e { -1 }", "-1"},
+		{"f = fn() -> int { try { return 1 } catch e { 2 } }; f(); 1 / 0", "ERROR: divide by zero"},
+		{"s = 0; for x in [1, 0, 2] { try { s += 2 / x } catch e { continue } } s", "3"},
+		{"s = 0; for x in [1, 2, 3] { try { if x == 2 { break } s += x } catch e { } } 1 / 0", "ERROR: divide by zero"},
+		{`try { try { throw("in") } catch e { throw(e + "out") }; "x" } catch e { e }`, "inout"},
+		{"1 / 0", "ERROR: divide by zero"},
+		{"[1][3]", "ERROR: Index 3 out of range for array of length 1"},
+		{`throw("50%d off")`, "ERROR: 50%d off"},
+		{`try { throw("50%d off"); "" } catch e { e }`, "50%d off"},
+	}
+
+	for _, tt := range tests {
+		result := testRun(t, tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+// the vm must agree with the tree-walking evaluator
+func TestVMMatchesEvaluator(t *testing.T) {
+	inputs := []string{
+		"1 + true + 2.2",
+		`("aabbaaa" / "aa")`,
+		`"ab" * "ac"`,
+		"x = 3; y = x * 2; x = y - x; [x, y]",
+		"f = fn(x: int) -> int { x * 2 }; [1, 2, 3] | len | f",
+		"mk = fn(n: int) -> fn() -> int { fn() -> int { n } }; a = mk(1); b = mk(2); a() + b() * 10",
+		"counter = 0; inc = fn() -> int { counter += 1; counter }; inc(); inc()",
+		"mkc = fn() -> fn() -> int { c = 0; fn() -> int { c += 1; c } }; c1 = mkc(); c2 = mkc(); c1(); c1(); c2(); c1() * 10 + c2()",
+		"acc = fn(total: int) -> fn(int) -> int { fn(x: int) -> int { total = total + x; total } }; a = acc(10); a(5); a(5)",
+		"outer = fn() -> int { n = 1; bump = fn() -> none { n = n + 1 }; bump(); bump(); n }; outer()",
+		"deep = fn() -> fn() -> fn() -> int { n = 0; fn() -> fn() -> int { fn() -> int { n += 1; n } } }; f = deep()(); f(); f()",
+		"pair = fn() -> array[fn() -> int] { n = 0; [fn() -> int { n += 1; n }, fn() -> int { n * 100 }] }; p = pair(); p[0](); p[0](); p[1]()",
+		"wrap = fn() -> int { go = fn(k: int) -> int { ife k == 0 { 0 } else { k + go(k - 1) } }; go(4) }; wrap()",
+		"fs = []fn() -> int; for x in [1, 2, 3] { fs = push(fs, fn() -> int { x }) } fs[0]() + fs[2]()",
+		`fs = []fn() -> int; for i in range(2) { fs = push(fs, fn() -> int { q = i; q }); q = "s" } r = map(fs, fn(f: fn() -> int) -> int { f() }); q + "x"`,
+		"fs = []fn() -> int; for i in range(2) { fs = push(fs, fn() -> int { q = i; q }); q = 100 } [map(fs, fn(f: fn() -> int) -> int { f() }), [q]]",
+		"if false { q = 1 } f = fn() -> int { q = 2; q }; f(); q",
+		"f = fn() -> int { local = 3; local }; f(); local = 7; local",
+		`f = fn() -> int { tmp = 3; tmp }; tmp = "s"; [f(), len(tmp)]`,
+		"x = 1; f = fn() -> int { x + 1 }; x = 5; f()",
+		"g = fn() -> int { h = fn() -> int { n = 1; n }; n = 2; h() + n }; g()",
+		"g = fn() -> fn() -> int { n = 1; h = fn() -> int { n }; try { n = 2; throw(\"x\") } catch e { n = 3 }; h }; g()()",
+		"first = fn[T](xs: array[T]) -> T { xs[0] }; first([7, 8])",
+		"enum Shape { Circle(float), Rect(float, float), Empty }; [Shape.Circle(1.5), Shape.Empty]",
+		"enum Shape { Circle(float), Rect(float, float) }; area = fn(s: Shape) -> float { match s { Circle(r) => 3.0 * r * r, Rect(w, h) => w * h } }; area(Shape.Rect(2.0, 3.0)) + area(Shape.Circle(1.0))",
+		"enum Tree { Leaf, Node(Tree, int, Tree) }; sum = fn(t: Tree) -> int { match t { Leaf => 0, Node(l, v, r) => sum(l) + v + sum(r) } }; sum(Tree.Node(Tree.Node(Tree.Leaf, 1, Tree.Leaf), 2, Tree.Leaf))",
+		"enum E { A, B(int, int) }; s = 0; for e in [E.A, E.B(1, 2), E.B(3, 4)] { match e { B(_, y) => { s += y }, _ => { continue } } } s",
+		"enum E { A, B(string) }; match E.B(\"x\") { A => \"a\", B(m) => { m = m + \"!\"; m } }",
+		"struct P { x: int, y: float }; P{y: 1.5, x: 2}",
+		"out = []int; for x in [1, 2, 3] { out = push(out, x * x) } out",
+		"fn(x: int) -> int { x + 2 }",
+		"i = 0; while i < 3 { i += 1 }",
+		"fact = fn(n: int) -> int { ife n == 0 { 1 } else { n * fact(n - 1) } }; fact(10)",
+		"ife 1 == 1 && 2 == 2 { \"yes\" } else { \"no\" }",
+		"x = 0; try { x = 1; throw(\"oops\"); x = 2 } catch e { x += 10 }; x",
+		"f = fn(x: int) -> int { try { return 10 / x } catch e { 0 } }; f(0) + f(5)",
+		`"a, b ,c" | split(",") | join("") | replace(" ", "") | upper`,
+		`format("{} is {}", substr("glimmer", 0, 3), index_of("glimmer", "m"))`,
+		"n = 10; map([1, 2, 3], fn(x: int) -> int { x * n }) | reverse",
+		"reduce(filter(range(10), fn(x: int) -> bool { x > 4 }), fn(acc: int, x: int) -> int { acc + x }, 0)",
+		"mkc = fn() -> fn(int) -> int { c = 0; fn(x: int) -> int { c += x; c } }; add = mkc(); map([1, 2, 3], add)",
+		`sort_by(zip(["b", "a"], ["x", "y"]), fn(p: array[string]) -> string { p[0] })`,
+		`enumerate(["a", "b"], fn(i: int, s: string) -> string { format("{}{}", s, i) }) | sort`,
+		"map([[1, 2], [3]], fn(xs: array[int]) -> int { reduce(xs, fn(a: int, x: int) -> int { a + x }, 0) })",
+		"fact = fn(n: int) -> int { ife n == 0 { 1 } else { n * fact(n - 1) } }; map(range(5), fact)",
+		"map([0, 1, 2], fn(x: int) -> int { try { 10 / x } catch e { -1 } })",
+		`x = 0; try { map([1, 0], fn(d: int) -> int { 10 / d }); x = 1 } catch e { x = 2 }; x`,
+		`f = fn() -> int { r = try { len(map([0], fn(d: int) -> int { 1 / d })) } catch e { 7 }; r + 1 }; f()`,
+		`map([1, 0], fn(d: int) -> int { 10 / d })`,
+		`d = {}int; for w in split("a b a c a", " ") { d[w] = get(d, w, 0) + 1 } d`,
+		`m = {"in": {"x": 1}}; alias = m; m["in"]["x"] += 5; m["in"]["y"] = 2; [m, alias]`,
+		`struct P { x: int }; d = {"p": P{x: 1}}; f = fn() -> none { d["p"].x = 9 }; f(); d`,
+		`d = {"a": 1}; try { d["b"] += 1; "ok" } catch e { e }`,
+		`d = {"b": 1, "a": 2}; items(merge(d, {"c": 3}), fn(k: string, v: int) -> string { k * v }) | join("")`,
+		`[keys(delete({"a": 1, "b": 2}, "a")), values({"x": "1", "y": "2"})]`,
+		"a = [1, 2, 3]; b = a; a[0] = 9; a[2] -= 1; [a, b]",
+		`m = {"g": [[1, 2], [3]]}; m["g"][0][1] = 7; m`,
+		"a = range(10); [a[2:5], a[:3], a[7:], a[::3], a[::-3], a[-3:-1], a[8:2:-2], a[20:]]",
+		`s = "glimmer"; [s[1:4], s[::-1], s[-3:], s[:0]]`,
+		"f = fn(xs: array[int]) -> array[int] { xs[0] = 0; xs }; a = [1, 2]; [f(a), a]",
+		"a = [1]; try { a[3] = 1; 0 } catch e { len(a) }",
+		"[1, 2, 3][1::0]",
+		`[2 in [1, 2], 3 not in [1, 2], "a" in {"a": 1}, "b" not in {"a": 1}, "mm" in "glimmer", [1] in [[1]]]`,
+		"seen = []int; for x in [3, 1, 3, 2, 1] { if x not in seen { seen = push(seen, x) } } seen",
+	}
+
+	for _, input := range inputs {
+		expected := testEval(input)
+		result := testRun(t, input)
+		if result.Inspect() != expected.Inspect() {
+			t.Errorf("vm and evaluator disagree for %q. evaluator=%q, vm=%q", input, expected.Inspect(), result.Inspect())
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	result := testRun(t, "f = fn(n: int) -> int { f(n + 1) }; f(0)")
+	if result.Inspect() != "ERROR: stack overflow" {
+		t.Errorf("expected stack overflow. got=%q", result.Inspect())
+	}
+}
+
+func TestImportedModules(t *testing.T) {
+	modEnv := object.NewEnvironment()
+	modSrc := "n = 2; twice = fn(x: int) -> int { x * n }"
+	evaluator.Eval(parser.New(lexer.New(modSrc)).ParseProgram(), modEnv)
+
+	input := `import "lib.gli" as lib; f = fn(x: int) -> int { lib.twice(x) + lib.n }; f(5)`
+	comp := compiler.New()
+	comp.SetImporter(func(path string) (*object.Environment, error) {
+		return modEnv, nil
+	})
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if machine.Result().Inspect() != "12" {
+		t.Errorf("wrong result. want=%q, got=%q", "12", machine.Result().Inspect())
+	}
+}